@@ -0,0 +1,269 @@
+// Package filter evaluates the -filter expressions of list commands against
+// the items returned by the appliance, ex:
+//
+//	isContainerizable && serviceType == "Tomcat" && vmName =~ "^prod-"
+//
+// Identifiers name the JSON fields of an item, case-insensitively. Literals
+// are double or single quoted strings, numbers, true and false. The operators
+// are == != < <= > >= =~ (regular expression match) !~ && || ! and
+// parentheses. A bare identifier is true when the field is set to a non-zero
+// value. Comparisons against a list field hold when any element matches.
+// Fields and literals that both parse as numbers are compared by value.
+package filter
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Expression is a parsed filter expression.
+type Expression struct {
+	source string
+	root   node
+}
+
+type node interface {
+	evaluate(item map[string]interface{}) interface{}
+}
+
+// Parse parses a filter expression.
+func Parse(source string) (*Expression, error) {
+	tokens, err := tokenize(source)
+	if err != nil {
+		return nil, err
+	}
+
+	parser := &parser{tokens: tokens}
+	root, err := parser.or()
+	if err != nil {
+		return nil, err
+	}
+
+	if !parser.done() {
+		return nil, fmt.Errorf("filter: unexpected %q", parser.peek().text)
+	}
+
+	return &Expression{source: source, root: root}, nil
+}
+
+func (expression *Expression) String() string {
+	return expression.source
+}
+
+// Match reports whether the item satisfies the expression. The item is
+// compared by its JSON representation.
+func (expression *Expression) Match(item interface{}) (bool, error) {
+	fields, err := Fields(item)
+	if err != nil {
+		return false, err
+	}
+	return expression.MatchFields(fields), nil
+}
+
+// MatchFields reports whether the fields, keyed by JSON name, satisfy the
+// expression.
+func (expression *Expression) MatchFields(fields map[string]interface{}) bool {
+	return truthy(expression.root.evaluate(fields))
+}
+
+// Equalities returns the field == "literal" conditions that the whole
+// expression depends on, that is the ones joined to it by && only. They can
+// be sent to the appliance as query parameters to narrow the items returned
+// before the expression is evaluated.
+func (expression *Expression) Equalities() map[string]string {
+	equalities := map[string]string{}
+	collectEqualities(expression.root, equalities)
+	return equalities
+}
+
+func collectEqualities(current node, equalities map[string]string) {
+	switch typed := current.(type) {
+	case *binary:
+		if typed.operator == "&&" {
+			collectEqualities(typed.left, equalities)
+			collectEqualities(typed.right, equalities)
+		}
+	case *comparison:
+		field, isField := typed.left.(*identifier)
+		value, isLiteral := typed.right.(*literal)
+		if typed.operator == "==" && isField && isLiteral {
+			if text, isString := value.value.(string); isString {
+				equalities[field.name] = text
+			}
+		}
+	}
+}
+
+// Fields returns the JSON fields of the item.
+func Fields(item interface{}) (fields map[string]interface{}, err error) {
+	encoded, err := json.Marshal(item)
+	if err != nil {
+		return nil, err
+	}
+	err = json.Unmarshal(encoded, &fields)
+	return fields, err
+}
+
+type identifier struct {
+	name string
+}
+
+func (identifier *identifier) evaluate(item map[string]interface{}) interface{} {
+	if value, found := item[identifier.name]; found {
+		return value
+	}
+
+	for name, value := range item {
+		if strings.EqualFold(name, identifier.name) {
+			return value
+		}
+	}
+
+	return nil
+}
+
+type literal struct {
+	value interface{}
+}
+
+func (literal *literal) evaluate(map[string]interface{}) interface{} {
+	return literal.value
+}
+
+type not struct {
+	operand node
+}
+
+func (not *not) evaluate(item map[string]interface{}) interface{} {
+	return !truthy(not.operand.evaluate(item))
+}
+
+type binary struct {
+	operator string
+	left     node
+	right    node
+}
+
+func (binary *binary) evaluate(item map[string]interface{}) interface{} {
+	if binary.operator == "&&" {
+		return truthy(binary.left.evaluate(item)) && truthy(binary.right.evaluate(item))
+	}
+	return truthy(binary.left.evaluate(item)) || truthy(binary.right.evaluate(item))
+}
+
+type comparison struct {
+	operator string
+	left     node
+	right    node
+	pattern  *regexp.Regexp
+}
+
+func (comparison *comparison) evaluate(item map[string]interface{}) interface{} {
+	left := comparison.left.evaluate(item)
+	right := comparison.right.evaluate(item)
+
+	negated := comparison.operator == "!=" || comparison.operator == "!~"
+
+	if values, isList := left.([]interface{}); isList {
+		for _, value := range values {
+			if comparison.compare(value, right) != negated {
+				return !negated
+			}
+		}
+		return negated
+	}
+
+	return comparison.compare(left, right)
+}
+
+// compare applies the operator to two scalars.
+func (comparison *comparison) compare(left interface{}, right interface{}) bool {
+	switch comparison.operator {
+	case "=~":
+		return comparison.pattern.MatchString(text(left))
+	case "!~":
+		return !comparison.pattern.MatchString(text(left))
+	}
+
+	x, leftNumeric := number(left)
+	y, rightNumeric := number(right)
+
+	if leftNumeric && rightNumeric {
+		switch comparison.operator {
+		case "==":
+			return x == y
+		case "!=":
+			return x != y
+		case "<":
+			return x < y
+		case "<=":
+			return x <= y
+		case ">":
+			return x > y
+		case ">=":
+			return x >= y
+		}
+	}
+
+	a, b := text(left), text(right)
+	switch comparison.operator {
+	case "==":
+		return a == b
+	case "!=":
+		return a != b
+	case "<":
+		return a < b
+	case "<=":
+		return a <= b
+	case ">":
+		return a > b
+	case ">=":
+		return a >= b
+	}
+
+	return false
+}
+
+func truthy(value interface{}) bool {
+	switch typed := value.(type) {
+	case nil:
+		return false
+	case bool:
+		return typed
+	case float64:
+		return typed != 0
+	case string:
+		return len(typed) > 0
+	case []interface{}:
+		return len(typed) > 0
+	case map[string]interface{}:
+		return len(typed) > 0
+	}
+	return true
+}
+
+func number(value interface{}) (float64, bool) {
+	switch typed := value.(type) {
+	case float64:
+		return typed, true
+	case string:
+		parsed, err := strconv.ParseFloat(strings.TrimSpace(typed), 64)
+		return parsed, err == nil
+	}
+	return 0, false
+}
+
+func text(value interface{}) string {
+	switch typed := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return typed
+	case float64:
+		return strconv.FormatFloat(typed, 'f', -1, 64)
+	}
+	return fmt.Sprint(value)
+}
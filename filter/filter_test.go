@@ -0,0 +1,209 @@
+package filter
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+var item = map[string]interface{}{
+	"vmName":            "prod-web-01",
+	"serviceType":       "Tomcat",
+	"isContainerizable": true,
+	"memoryMB":          float64(4096),
+	"version":           "10",
+	"port":              "8080",
+	"owner":             "",
+	"ips":               []interface{}{"10.0.0.1", "10.0.0.2"},
+	"ports":             []interface{}{float64(80), float64(443)},
+	"tags":              []interface{}{},
+	"label":             "o'brien \"quoted\"",
+	"région":            "Île-de-France",
+}
+
+func TestMatch(t *testing.T) {
+	tests := []struct {
+		expression string
+		expected   bool
+	}{
+		// Precedence: ! binds tighter than &&, which binds tighter than ||.
+		{`isContainerizable && false || true`, true},
+		{`true || false && false`, true},
+		{`(true || false) && false`, false},
+		{`!isContainerizable || true`, true},
+		{`!(isContainerizable || true)`, false},
+		{`!false && !owner`, true},
+		{`!!isContainerizable`, true},
+		{`false || false || serviceType == "Tomcat"`, true},
+		{`serviceType == "Tomcat" && vmName == "x" || memoryMB > 1024`, true},
+		{`serviceType == "Tomcat" && (vmName == "x" || memoryMB > 8192)`, false},
+
+		// Quoting.
+		{`serviceType == 'Tomcat'`, true},
+		{`label == "o'brien \"quoted\""`, true},
+		{`label == 'o\'brien "quoted"'`, true},
+		{`serviceType == "tomcat"`, false},
+		{`owner == ""`, true},
+		{`vmName == "prod-web-01"`, true},
+
+		// Regular expressions.
+		{`vmName =~ "^prod-"`, true},
+		{`vmName =~ '^dev-'`, false},
+		{`vmName !~ "^dev-"`, true},
+		{`vmName !~ "web"`, false},
+		{`serviceType =~ "(?i)^tomcat$"`, true},
+		{`memoryMB =~ "^40"`, true},
+		{`missing =~ "^$"`, true},
+
+		// Numbers compare by value, other values as text.
+		{`memoryMB == 4096`, true},
+		{`memoryMB == 4096.0`, true},
+		{`memoryMB == "4096"`, true},
+		{`memoryMB > 512`, true},
+		{`memoryMB <= -1`, false},
+		{`version > 9`, true},
+		{`version > "9"`, true},
+		{`serviceType > "Apache"`, true},
+		{`serviceType < 9`, false},
+		{`port >= 8080 && port < 8443`, true},
+
+		// Bare identifiers are true when set to a non-zero value.
+		{`isContainerizable`, true},
+		{`memoryMB`, true},
+		{`owner`, false},
+		{`tags`, false},
+		{`ips`, true},
+		{`missing`, false},
+		{`ISCONTAINERIZABLE && VMName == "prod-web-01"`, true},
+
+		// Comparisons against a list hold when any element matches, and
+		// their negations when none does.
+		{`ips == "10.0.0.2"`, true},
+		{`ips == "10.0.0.3"`, false},
+		{`ips != "10.0.0.2"`, false},
+		{`ips != "10.0.0.3"`, true},
+		{`ips =~ "^10\\.0\\."`, true},
+		{`ips !~ "\\.2$"`, false},
+		{`ports > 400`, true},
+		{`ports < 80`, false},
+		{`tags == "x"`, false},
+		{`tags != "x"`, true},
+
+		// Identifiers and literals beyond ASCII.
+		{`région == "Île-de-France"`, true},
+		{`région =~ "^Île"`, true},
+		{`vmName != "données"`, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.expression, func(t *testing.T) {
+			expression, err := Parse(test.expression)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if matched := expression.MatchFields(item); matched != test.expected {
+				t.Errorf("expected %v, got %v", test.expected, matched)
+			}
+		})
+	}
+}
+
+func TestMatchItem(t *testing.T) {
+	type component struct {
+		Name  string   `json:"compName"`
+		Ports []int    `json:"ports"`
+		Tags  []string `json:"tags,omitempty"`
+	}
+
+	expression, err := Parse(`compName == "tomcat" && ports == 8080 && !tags`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, test := range []struct {
+		item     component
+		expected bool
+	}{
+		{component{Name: "tomcat", Ports: []int{8005, 8080}}, true},
+		{component{Name: "tomcat", Ports: []int{8005}}, false},
+		{component{Name: "tomcat", Ports: []int{8080}, Tags: []string{"legacy"}}, false},
+		{component{Name: "nginx", Ports: []int{8080}}, false},
+	} {
+		matched, err := expression.Match(test.item)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if matched != test.expected {
+			t.Errorf("expected %v for %+v, got %v", test.expected, test.item, matched)
+		}
+	}
+}
+
+func TestEqualities(t *testing.T) {
+	tests := []struct {
+		expression string
+		expected   map[string]string
+	}{
+		{`serviceType == "Tomcat"`, map[string]string{"serviceType": "Tomcat"}},
+		{`serviceType == "Tomcat" && vmName == 'web'`, map[string]string{"serviceType": "Tomcat", "vmName": "web"}},
+		{`serviceType == "Tomcat" && (vmName == "web" && memoryMB > 1024)`, map[string]string{"serviceType": "Tomcat", "vmName": "web"}},
+
+		// Conditions under || or ! do not narrow the whole expression.
+		{`serviceType == "Tomcat" || vmName == "web"`, map[string]string{}},
+		{`serviceType == "Tomcat" && (vmName == "web" || vmName == "db")`, map[string]string{"serviceType": "Tomcat"}},
+		{`(serviceType == "Tomcat" && vmName == "web") || isContainerizable`, map[string]string{}},
+		{`serviceType == "Tomcat" && vmName == "web" || isContainerizable`, map[string]string{}},
+		{`!(serviceType == "Tomcat")`, map[string]string{}},
+
+		// Only equalities of a field and a string literal are sent.
+		{`serviceType != "Tomcat"`, map[string]string{}},
+		{`memoryMB == 4096`, map[string]string{}},
+		{`"Tomcat" == serviceType`, map[string]string{}},
+		{`vmName =~ "^prod-"`, map[string]string{}},
+		{`région == "Île-de-France"`, map[string]string{"région": "Île-de-France"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.expression, func(t *testing.T) {
+			expression, err := Parse(test.expression)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if equalities := expression.Equalities(); !reflect.DeepEqual(equalities, test.expected) {
+				t.Errorf("expected %v, got %v", test.expected, equalities)
+			}
+		})
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		expression string
+		error      string
+	}{
+		{``, "empty expression"},
+		{`   `, "empty expression"},
+		{`vmName == "prod`, "unterminated string"},
+		{`vmName == 'prod`, "unterminated string"},
+		{`memoryMB > 1.2.3`, "invalid number"},
+		{`vmName == `, "unexpected end of expression"},
+		{`(vmName == "a"`, "missing )"},
+		{`vmName == "a")`, `unexpected ")"`},
+		{`vmName "a"`, `unexpected "\"a\""`},
+		{`vmName = "a"`, `unexpected '='`},
+		{`vmName == "a" & true`, `unexpected '&'`},
+		{`vmName == "a" ∧ true`, `unexpected '∧' at offset 14`},
+		{`vmName =~ other`, "expects a quoted regular expression"},
+		{`vmName =~ "("`, "missing closing )"},
+		{`&& true`, `unexpected "&&"`},
+	}
+
+	for _, test := range tests {
+		t.Run(test.expression, func(t *testing.T) {
+			_, err := Parse(test.expression)
+			if err == nil || !strings.Contains(err.Error(), test.error) {
+				t.Errorf("expected an error containing %q, got %v", test.error, err)
+			}
+		})
+	}
+}
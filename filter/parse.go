@@ -0,0 +1,269 @@
+package filter
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+const (
+	IDENTIFIER = "identifier"
+	STRING     = "string"
+	NUMBER     = "number"
+	OPERATOR   = "operator"
+)
+
+type token struct {
+	kind string
+	text string
+	// value holds the unquoted string or parsed number of literals.
+	value interface{}
+}
+
+// operators are matched longest first.
+var operators = []string{"&&", "||", "==", "!=", "<=", ">=", "=~", "!~", "<", ">", "!", "(", ")"}
+
+func tokenize(source string) (tokens []token, err error) {
+	for position := 0; position < len(source); {
+		current, size := utf8.DecodeRuneInString(source[position:])
+		next, _ := utf8.DecodeRuneInString(source[position+size:])
+
+		switch {
+		case unicode.IsSpace(current):
+			position += size
+		case current == '"' || current == '\'':
+			end := position + 1
+			for end < len(source) && source[end] != source[position] {
+				if source[end] == '\\' {
+					end++
+				}
+				end++
+			}
+			if end >= len(source) {
+				return nil, fmt.Errorf("filter: unterminated string %s", source[position:])
+			}
+
+			quoted := source[position : end+1]
+			text := quoted[1 : len(quoted)-1]
+			if current == '"' {
+				if text, err = strconv.Unquote(quoted); err != nil {
+					return nil, fmt.Errorf("filter: invalid string %s", quoted)
+				}
+			} else {
+				text = strings.ReplaceAll(text, `\'`, `'`)
+			}
+
+			tokens = append(tokens, token{kind: STRING, text: quoted, value: text})
+			position = end + 1
+		case unicode.IsDigit(current) || (current == '-' && unicode.IsDigit(next)):
+			end := position + size
+			for end < len(source) {
+				digit, digitSize := utf8.DecodeRuneInString(source[end:])
+				if !unicode.IsDigit(digit) && digit != '.' {
+					break
+				}
+				end += digitSize
+			}
+
+			number, err := strconv.ParseFloat(source[position:end], 64)
+			if err != nil {
+				return nil, fmt.Errorf("filter: invalid number %s", source[position:end])
+			}
+
+			tokens = append(tokens, token{kind: NUMBER, text: source[position:end], value: number})
+			position = end
+		case unicode.IsLetter(current) || current == '_':
+			end := position + size
+			for end < len(source) {
+				letter, letterSize := utf8.DecodeRuneInString(source[end:])
+				if !unicode.IsLetter(letter) && !unicode.IsDigit(letter) && letter != '_' {
+					break
+				}
+				end += letterSize
+			}
+
+			tokens = append(tokens, token{kind: IDENTIFIER, text: source[position:end]})
+			position = end
+		default:
+			matched := false
+			for _, operator := range operators {
+				if strings.HasPrefix(source[position:], operator) {
+					tokens = append(tokens, token{kind: OPERATOR, text: operator})
+					position += len(operator)
+					matched = true
+					break
+				}
+			}
+
+			if !matched {
+				return nil, fmt.Errorf("filter: unexpected %q at offset %d", current, position)
+			}
+		}
+	}
+
+	if len(tokens) == 0 {
+		return nil, fmt.Errorf("filter: empty expression")
+	}
+
+	return tokens, nil
+}
+
+// parser is a recursive descent parser over the grammar, from the lowest
+// precedence:
+//
+//	or         = and { "||" and }
+//	and        = unary { "&&" unary }
+//	unary      = "!" unary | comparison
+//	comparison = operand [ ("==" | "!=" | "<" | "<=" | ">" | ">=" | "=~" | "!~") operand ]
+//	operand    = identifier | string | number | "true" | "false" | "(" or ")"
+type parser struct {
+	tokens   []token
+	position int
+}
+
+func (parser *parser) done() bool {
+	return parser.position >= len(parser.tokens)
+}
+
+func (parser *parser) peek() token {
+	if parser.done() {
+		return token{}
+	}
+	return parser.tokens[parser.position]
+}
+
+// accept consumes the next token if it is one of the operators.
+func (parser *parser) accept(operators ...string) (string, bool) {
+	next := parser.peek()
+	if next.kind != OPERATOR {
+		return "", false
+	}
+
+	for _, operator := range operators {
+		if next.text == operator {
+			parser.position++
+			return operator, true
+		}
+	}
+
+	return "", false
+}
+
+func (parser *parser) or() (node, error) {
+	left, err := parser.and()
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		if _, found := parser.accept("||"); !found {
+			return left, nil
+		}
+
+		right, err := parser.and()
+		if err != nil {
+			return nil, err
+		}
+		left = &binary{operator: "||", left: left, right: right}
+	}
+}
+
+func (parser *parser) and() (node, error) {
+	left, err := parser.unary()
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		if _, found := parser.accept("&&"); !found {
+			return left, nil
+		}
+
+		right, err := parser.unary()
+		if err != nil {
+			return nil, err
+		}
+		left = &binary{operator: "&&", left: left, right: right}
+	}
+}
+
+func (parser *parser) unary() (node, error) {
+	if _, found := parser.accept("!"); found {
+		operand, err := parser.unary()
+		if err != nil {
+			return nil, err
+		}
+		return &not{operand}, nil
+	}
+
+	return parser.comparison()
+}
+
+func (parser *parser) comparison() (node, error) {
+	left, err := parser.operand()
+	if err != nil {
+		return nil, err
+	}
+
+	operator, found := parser.accept("==", "!=", "<=", ">=", "<", ">", "=~", "!~")
+	if !found {
+		return left, nil
+	}
+
+	right, err := parser.operand()
+	if err != nil {
+		return nil, err
+	}
+
+	result := &comparison{operator: operator, left: left, right: right}
+
+	if operator == "=~" || operator == "!~" {
+		pattern, isLiteral := right.(*literal)
+		if !isLiteral {
+			return nil, fmt.Errorf("filter: %s expects a quoted regular expression", operator)
+		}
+		if result.pattern, err = regexp.Compile(text(pattern.value)); err != nil {
+			return nil, fmt.Errorf("filter: %v", err)
+		}
+	}
+
+	return result, nil
+}
+
+func (parser *parser) operand() (node, error) {
+	if parser.done() {
+		return nil, fmt.Errorf("filter: unexpected end of expression")
+	}
+
+	next := parser.tokens[parser.position]
+	parser.position++
+
+	switch next.kind {
+	case STRING, NUMBER:
+		return &literal{next.value}, nil
+	case IDENTIFIER:
+		switch next.text {
+		case "true":
+			return &literal{true}, nil
+		case "false":
+			return &literal{false}, nil
+		}
+		return &identifier{next.text}, nil
+	}
+
+	if next.text == "(" {
+		inner, err := parser.or()
+		if err != nil {
+			return nil, err
+		}
+		if _, found := parser.accept(")"); !found {
+			return nil, fmt.Errorf("filter: missing )")
+		}
+		return inner, nil
+	}
+
+	return nil, fmt.Errorf("filter: unexpected %q", next.text)
+}
@@ -1,3 +1,8 @@
 module gitlab.eng.vmware.com/vmware-navigator-practice/tooling/tanzu-apptx-cli
 
 go 1.16
+
+require (
+	golang.org/x/term v0.5.0
+	gopkg.in/yaml.v3 v3.0.1
+)
@@ -0,0 +1,413 @@
+package render
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// jsonPath is a template in the subset of the kubectl JSONPath syntax used by
+// the jsonpath format: text with {expressions}, where an expression is a path
+// such as {.items[0].name}, {.items[*].ip} or {.items[?(@.memoryMB>=4096)].name},
+// a quoted literal such as {"\n"}, or a {range .items[*]}...{end} block whose
+// paths are relative to each item.
+type jsonPath struct {
+	nodes []jsonPathNode
+}
+
+type jsonPathNode struct {
+	text     string
+	path     []jsonPathStep
+	isPath   bool
+	children []jsonPathNode
+	isRange  bool
+}
+
+type jsonPathStep struct {
+	field    string
+	index    int
+	isIndex  bool
+	wildcard bool
+	filter   *jsonPathFilter
+}
+
+// jsonPathFilter keeps the elements of an array for which the path, relative
+// to the element, compares to the literal with the operator, ex:
+// [?(@.status=="SUCCESS")]. Without an operator, [?(@.ip)], it keeps the
+// elements where the path selects a value.
+type jsonPathFilter struct {
+	path     []jsonPathStep
+	operator string
+	literal  interface{}
+}
+
+var jsonPathOperators = []string{"==", "!=", "<=", ">=", "<", ">"}
+
+func parseJSONPath(template string) (*jsonPath, error) {
+	nodes, _, _, err := parseJSONPathNodes(template, false)
+	if err != nil {
+		return nil, err
+	}
+	return &jsonPath{nodes}, nil
+}
+
+// parseJSONPathNodes parses until the end of the template, or until {end}
+// when inRange is set, and returns what follows the {end}.
+func parseJSONPathNodes(template string, inRange bool) (nodes []jsonPathNode, rest string, ended bool, err error) {
+	for len(template) > 0 {
+		open := strings.Index(template, "{")
+		if open < 0 {
+			nodes = append(nodes, jsonPathNode{text: template})
+			break
+		}
+
+		if open > 0 {
+			nodes = append(nodes, jsonPathNode{text: template[:open]})
+		}
+
+		end := closingBrace(template, open)
+		if end < 0 {
+			return nil, "", false, fmt.Errorf("jsonpath: unclosed expression in %q", template[open:])
+		}
+
+		expression := strings.TrimSpace(template[open+1 : end])
+		template = template[end+1:]
+
+		switch {
+		case expression == "end":
+			if !inRange {
+				return nil, "", false, fmt.Errorf("jsonpath: {end} without {range}")
+			}
+			return nodes, template, true, nil
+		case strings.HasPrefix(expression, "range "):
+			path, err := parseJSONPathSteps(strings.TrimSpace(strings.TrimPrefix(expression, "range ")))
+			if err != nil {
+				return nil, "", false, err
+			}
+
+			children, rest, ended, err := parseJSONPathNodes(template, true)
+			if err != nil {
+				return nil, "", false, err
+			}
+			if !ended {
+				return nil, "", false, fmt.Errorf("jsonpath: {range} without {end}")
+			}
+
+			nodes = append(nodes, jsonPathNode{path: path, isRange: true, children: children})
+			template = rest
+		case strings.HasPrefix(expression, "\""):
+			text, err := strconv.Unquote(expression)
+			if err != nil {
+				return nil, "", false, fmt.Errorf("jsonpath: invalid literal %s", expression)
+			}
+			nodes = append(nodes, jsonPathNode{text: text})
+		default:
+			path, err := parseJSONPathSteps(expression)
+			if err != nil {
+				return nil, "", false, err
+			}
+			nodes = append(nodes, jsonPathNode{path: path, isPath: true})
+		}
+	}
+
+	return nodes, "", false, nil
+}
+
+// closingBrace returns the index of the brace closing the one at open,
+// ignoring braces in quoted literals.
+func closingBrace(template string, open int) int {
+	quoted := false
+	for i := open + 1; i < len(template); i++ {
+		switch template[i] {
+		case '\\':
+			if quoted {
+				i++
+			}
+		case '"', '\'':
+			quoted = !quoted
+		case '}':
+			if !quoted {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+func parseJSONPathSteps(expression string) (steps []jsonPathStep, err error) {
+	path := strings.TrimLeft(expression, "$@")
+
+	for len(path) > 0 {
+		switch path[0] {
+		case '.':
+			path = path[1:]
+			length := 0
+			for length < len(path) && path[length] != '.' && path[length] != '[' {
+				length++
+			}
+			if length == 0 {
+				continue
+			}
+			field := path[:length]
+			path = path[length:]
+			steps = append(steps, jsonPathStep{field: field, wildcard: field == "*"})
+		case '[':
+			end := closingBracket(path)
+			if end < 0 {
+				return nil, fmt.Errorf("jsonpath: unclosed [ in %q", expression)
+			}
+			subscript := strings.TrimSpace(path[1:end])
+			path = path[end+1:]
+
+			if strings.HasPrefix(subscript, "?(") && strings.HasSuffix(subscript, ")") {
+				filter, err := parseJSONPathFilter(strings.TrimSpace(subscript[2 : len(subscript)-1]))
+				if err != nil {
+					return nil, fmt.Errorf("jsonpath: invalid filter [%s] in %q: %v", subscript, expression, err)
+				}
+				steps = append(steps, jsonPathStep{filter: filter})
+			} else if subscript == "*" {
+				steps = append(steps, jsonPathStep{wildcard: true})
+			} else if index, err := strconv.Atoi(subscript); err == nil {
+				steps = append(steps, jsonPathStep{index: index, isIndex: true})
+			} else if len(subscript) >= 2 && (subscript[0] == '\'' || subscript[0] == '"') {
+				steps = append(steps, jsonPathStep{field: subscript[1 : len(subscript)-1]})
+			} else {
+				return nil, fmt.Errorf("jsonpath: invalid subscript [%s] in %q", subscript, expression)
+			}
+		default:
+			return nil, fmt.Errorf("jsonpath: invalid expression %q", expression)
+		}
+	}
+
+	return steps, nil
+}
+
+// closingBracket returns the index of the bracket closing the one starting
+// path, skipping the subscripts of filters and brackets in quoted literals.
+func closingBracket(path string) int {
+	var quote byte
+	depth := 0
+	for i := 0; i < len(path); i++ {
+		switch {
+		case quote != 0 && path[i] == '\\':
+			i++
+		case quote != 0:
+			if path[i] == quote {
+				quote = 0
+			}
+		case path[i] == '"' || path[i] == '\'':
+			quote = path[i]
+		case path[i] == '[':
+			depth++
+		case path[i] == ']':
+			depth--
+			if depth == 0 {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+// parseJSONPathFilter parses the expression of a [?(...)] subscript: a path
+// starting with @, optionally followed by an operator and a literal.
+func parseJSONPathFilter(expression string) (*jsonPathFilter, error) {
+	if !strings.HasPrefix(expression, "@") {
+		return nil, fmt.Errorf("the path must start with @")
+	}
+
+	left, operator, right := expression, "", ""
+	var quote byte
+	for i := 0; i < len(expression) && len(operator) == 0; i++ {
+		switch {
+		case quote != 0:
+			if expression[i] == quote {
+				quote = 0
+			}
+		case expression[i] == '"' || expression[i] == '\'':
+			quote = expression[i]
+		default:
+			for _, candidate := range jsonPathOperators {
+				if strings.HasPrefix(expression[i:], candidate) {
+					left, operator, right = expression[:i], candidate, expression[i+len(candidate):]
+					break
+				}
+			}
+		}
+	}
+
+	path, err := parseJSONPathSteps(strings.TrimSpace(left))
+	if err != nil {
+		return nil, err
+	}
+
+	filter := &jsonPathFilter{path: path, operator: operator}
+	if len(operator) == 0 {
+		return filter, nil
+	}
+
+	right = strings.TrimSpace(right)
+	switch {
+	case len(right) >= 2 && right[0] == '\'' && right[len(right)-1] == '\'':
+		filter.literal = right[1 : len(right)-1]
+	case len(right) >= 2 && right[0] == '"':
+		text, err := strconv.Unquote(right)
+		if err != nil {
+			return nil, fmt.Errorf("invalid literal %s", right)
+		}
+		filter.literal = text
+	case right == "true" || right == "false":
+		filter.literal = right == "true"
+	default:
+		number, err := strconv.ParseFloat(right, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid literal %q, quote strings", right)
+		}
+		filter.literal = number
+	}
+
+	return filter, nil
+}
+
+// matches reports whether the filter keeps the element. Numbers compare by
+// value and strings as text, other values only compare for equality.
+func (filter *jsonPathFilter) matches(element interface{}) bool {
+	values := evaluateJSONPath(filter.path, element)
+	if len(filter.operator) == 0 || len(values) == 0 {
+		return len(values) > 0
+	}
+
+	comparison, comparable := 0, false
+	switch value := values[0].(type) {
+	case float64:
+		if literal, isNumber := filter.literal.(float64); isNumber {
+			comparable = true
+			if value < literal {
+				comparison = -1
+			} else if value > literal {
+				comparison = 1
+			}
+		}
+	case string:
+		if literal, isString := filter.literal.(string); isString {
+			comparison, comparable = strings.Compare(value, literal), true
+		}
+	case bool:
+		if literal, isBool := filter.literal.(bool); isBool && (filter.operator == "==" || filter.operator == "!=") {
+			if value != literal {
+				comparison = 1
+			}
+			comparable = true
+		}
+	}
+
+	switch filter.operator {
+	case "==":
+		return comparable && comparison == 0
+	case "!=":
+		return !comparable || comparison != 0
+	case "<":
+		return comparable && comparison < 0
+	case "<=":
+		return comparable && comparison <= 0
+	case ">":
+		return comparable && comparison > 0
+	default:
+		return comparable && comparison >= 0
+	}
+}
+
+func (path *jsonPath) execute(w io.Writer, data interface{}) error {
+	return executeJSONPathNodes(w, path.nodes, data)
+}
+
+func executeJSONPathNodes(w io.Writer, nodes []jsonPathNode, data interface{}) error {
+	for _, node := range nodes {
+		switch {
+		case node.isRange:
+			for _, value := range evaluateJSONPath(node.path, data) {
+				if err := executeJSONPathNodes(w, node.children, value); err != nil {
+					return err
+				}
+			}
+		case node.isPath:
+			var texts []string
+			for _, value := range evaluateJSONPath(node.path, data) {
+				texts = append(texts, jsonPathText(value))
+			}
+			if _, err := io.WriteString(w, strings.Join(texts, " ")); err != nil {
+				return err
+			}
+		default:
+			if _, err := io.WriteString(w, node.text); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// evaluateJSONPath returns the values the path selects from data.
+func evaluateJSONPath(steps []jsonPathStep, data interface{}) []interface{} {
+	values := []interface{}{data}
+
+	for _, step := range steps {
+		var next []interface{}
+
+		for _, value := range values {
+			switch typed := value.(type) {
+			case map[string]interface{}:
+				if step.wildcard {
+					keys := make([]string, 0, len(typed))
+					for key := range typed {
+						keys = append(keys, key)
+					}
+					sort.Strings(keys)
+					for _, key := range keys {
+						next = append(next, typed[key])
+					}
+				} else if field, found := typed[step.field]; found && !step.isIndex {
+					next = append(next, field)
+				}
+			case []interface{}:
+				if step.filter != nil {
+					for _, element := range typed {
+						if step.filter.matches(element) {
+							next = append(next, element)
+						}
+					}
+				} else if step.wildcard {
+					next = append(next, typed...)
+				} else if step.isIndex {
+					index := step.index
+					if index < 0 {
+						index += len(typed)
+					}
+					if index >= 0 && index < len(typed) {
+						next = append(next, typed[index])
+					}
+				}
+			}
+		}
+
+		values = next
+	}
+
+	return values
+}
+
+// jsonPathText prints strings as they are and other values as JSON.
+func jsonPathText(value interface{}) string {
+	if text, isString := value.(string); isString {
+		return text
+	}
+
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Sprint(value)
+	}
+	return string(encoded)
+}
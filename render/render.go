@@ -0,0 +1,346 @@
+// Package render prints the result of list commands in the format chosen
+// with -output-format.
+package render
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"text/template"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Output formats
+const (
+	TABLE       = "table"
+	WIDE        = "wide"
+	JSON        = "json"
+	CSV         = "csv"
+	YAML        = "yaml"
+	NDJSON      = "ndjson"
+	GO_TEMPLATE = "go-template"
+	JSONPATH    = "jsonpath"
+)
+
+// Formats lists the accepted output formats. go-template and jsonpath take
+// their template after an equals sign, ex: jsonpath={.items[*].name}.
+var Formats = []string{TABLE, WIDE, JSON, CSV, YAML, NDJSON, GO_TEMPLATE + "=...", JSONPATH + "=..."}
+
+// Column describes a column of a table.
+type Column struct {
+	// Header is printed above the column.
+	Header string
+	// Key selects the column in -columns and -sort-by, ex: memoryMB.
+	Key string
+	// Wide columns are left out of the default table view.
+	Wide bool
+	// Numeric columns are sorted by value rather than as text.
+	Numeric bool
+}
+
+// Table holds the items of a list as text cells, one per column.
+type Table struct {
+	Columns []Column
+	Rows    [][]string
+}
+
+// List is the result of a list command.
+type List struct {
+	// Document is the response printed by the json and yaml formats.
+	Document interface{}
+	// Items are printed one per line by ndjson and exposed to templates as
+	// .items.
+	Items interface{}
+	Table Table
+}
+
+// Format is an output format together with its template and the view of
+// the table formats. It implements flag.Value so that unknown formats are
+// rejected while parsing flags.
+type Format struct {
+	Name     string
+	Template string
+	// Columns lists the keys of the columns printed by the table, wide and
+	// csv formats. Empty prints the default view of the format.
+	Columns []string
+	// SortBy is the key of the column the rows are sorted by.
+	SortBy    string
+	Reverse   bool
+	NoHeaders bool
+}
+
+// ParseFormat parses an -output-format value.
+func ParseFormat(value string) (format Format, err error) {
+	format.Name = value
+	if index := strings.Index(value, "="); index >= 0 {
+		format.Name, format.Template = value[:index], value[index+1:]
+	}
+
+	switch format.Name {
+	case TABLE, WIDE, JSON, CSV, YAML, NDJSON:
+		if len(format.Template) > 0 {
+			return format, fmt.Errorf("output format %q does not take a template", format.Name)
+		}
+	case GO_TEMPLATE:
+		_, err = template.New(GO_TEMPLATE).Parse(format.Template)
+	case JSONPATH:
+		_, err = parseJSONPath(format.Template)
+	default:
+		return format, fmt.Errorf("unknown output format %q, expected one of %s", value, strings.Join(Formats, ", "))
+	}
+
+	if err == nil && (format.Name == GO_TEMPLATE || format.Name == JSONPATH) && len(format.Template) == 0 {
+		err = fmt.Errorf("output format %q needs a template, ex: %s=...", format.Name, format.Name)
+	}
+
+	return format, err
+}
+
+func (format *Format) Set(value string) error {
+	parsed, err := ParseFormat(value)
+	format.Name, format.Template = parsed.Name, parsed.Template
+	return err
+}
+
+func (format *Format) String() string {
+	if len(format.Template) > 0 {
+		return format.Name + "=" + format.Template
+	}
+	return format.Name
+}
+
+// Validate checks that the columns and sort key of the format exist in the
+// table.
+func (format Format) Validate(table Table) error {
+	for _, key := range format.Columns {
+		if table.column(key) < 0 {
+			return fmt.Errorf("unknown column %q, expected one of %s", key, strings.Join(table.keys(), ", "))
+		}
+	}
+
+	if len(format.SortBy) > 0 && table.column(format.SortBy) < 0 {
+		return fmt.Errorf("unknown sort column %q, expected one of %s", format.SortBy, strings.Join(table.keys(), ", "))
+	}
+
+	return nil
+}
+
+// Render writes the list to w.
+func (format Format) Render(w io.Writer, list List) error {
+	if err := format.Validate(list.Table); err != nil {
+		return err
+	}
+
+	switch format.Name {
+	case TABLE, WIDE, "":
+		return format.writeTable(w, format.view(list.Table, format.Name == WIDE))
+	case JSON:
+		prettyJSON, err := json.MarshalIndent(list.Document, "", "    ")
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintf(w, "%s\n", prettyJSON)
+		return err
+	case CSV:
+		table := format.view(list.Table, true)
+		writer := csv.NewWriter(w)
+		if !format.NoHeaders {
+			writer.Write(table.headers())
+		}
+		writer.WriteAll(table.Rows)
+		return writer.Error()
+	case YAML:
+		document, err := generic(list.Document)
+		if err != nil {
+			return err
+		}
+		encoder := yaml.NewEncoder(w)
+		encoder.SetIndent(2)
+		if err := encoder.Encode(document); err != nil {
+			return err
+		}
+		return encoder.Close()
+	case NDJSON:
+		items := []json.RawMessage{}
+		if err := convert(list.Items, &items); err != nil {
+			return err
+		}
+		for _, item := range items {
+			compact := bytes.Buffer{}
+			if err := json.Compact(&compact, item); err != nil {
+				return err
+			}
+			if _, err := fmt.Fprintf(w, "%s\n", compact.Bytes()); err != nil {
+				return err
+			}
+		}
+		return nil
+	case GO_TEMPLATE:
+		root, err := templateRoot(list)
+		if err != nil {
+			return err
+		}
+		parsed, err := template.New(GO_TEMPLATE).Option("missingkey=zero").Parse(format.Template)
+		if err != nil {
+			return err
+		}
+		return parsed.Execute(w, root)
+	case JSONPATH:
+		root, err := templateRoot(list)
+		if err != nil {
+			return err
+		}
+		path, err := parseJSONPath(format.Template)
+		if err != nil {
+			return err
+		}
+		return path.execute(w, root)
+	}
+
+	return fmt.Errorf("unknown output format %q", format.Name)
+}
+
+// view returns the table sorted and narrowed to the selected columns. Without
+// a selection, wide keeps every column and the default view drops the wide
+// ones.
+func (format Format) view(table Table, wide bool) Table {
+	var selected []int
+	if len(format.Columns) > 0 {
+		for _, key := range format.Columns {
+			selected = append(selected, table.column(key))
+		}
+	} else {
+		for i, column := range table.Columns {
+			if wide || !column.Wide {
+				selected = append(selected, i)
+			}
+		}
+	}
+
+	rows := make([][]string, len(table.Rows))
+	copy(rows, table.Rows)
+
+	if len(format.SortBy) > 0 {
+		sortColumn := table.column(format.SortBy)
+		numeric := table.Columns[sortColumn].Numeric
+
+		sort.SliceStable(rows, func(i, j int) bool {
+			if format.Reverse {
+				i, j = j, i
+			}
+			return less(rows[i][sortColumn], rows[j][sortColumn], numeric)
+		})
+	} else if format.Reverse {
+		for i, j := 0, len(rows)-1; i < j; i, j = i+1, j-1 {
+			rows[i], rows[j] = rows[j], rows[i]
+		}
+	}
+
+	view := Table{}
+	for _, i := range selected {
+		view.Columns = append(view.Columns, table.Columns[i])
+	}
+	for _, row := range rows {
+		cells := make([]string, 0, len(selected))
+		for _, i := range selected {
+			cells = append(cells, row[i])
+		}
+		view.Rows = append(view.Rows, cells)
+	}
+
+	return view
+}
+
+// less compares two cells, by value when numeric is set and both parse as
+// numbers, ex: "512" < "1024", and as text otherwise.
+func less(a string, b string, numeric bool) bool {
+	if numeric {
+		x, errX := parseNumber(a)
+		y, errY := parseNumber(b)
+		if errX == nil && errY == nil {
+			return x < y
+		}
+		if errX == nil || errY == nil {
+			return errX == nil
+		}
+	}
+	return a < b
+}
+
+// parseNumber reads the number at the start of a cell, ignoring a unit, ex:
+// "16 GB".
+func parseNumber(cell string) (float64, error) {
+	fields := strings.Fields(cell)
+	if len(fields) == 0 {
+		return 0, strconv.ErrSyntax
+	}
+	return strconv.ParseFloat(fields[0], 64)
+}
+
+// column returns the index of the column with the given key or header, or -1.
+func (table Table) column(key string) int {
+	for i, column := range table.Columns {
+		if strings.EqualFold(column.Key, key) || strings.EqualFold(column.Header, key) {
+			return i
+		}
+	}
+	return -1
+}
+
+func (table Table) keys() (keys []string) {
+	for _, column := range table.Columns {
+		keys = append(keys, column.Key)
+	}
+	return keys
+}
+
+func (table Table) headers() (headers []string) {
+	for _, column := range table.Columns {
+		headers = append(headers, column.Header)
+	}
+	return headers
+}
+
+// writeTable aligns the cells in columns separated by vertical bars, with a
+// space on each side of every cell, the headers included.
+func (format Format) writeTable(w io.Writer, table Table) error {
+	const separator = " \t "
+
+	tw := tabwriter.NewWriter(w, 0, 0, 1, ' ', tabwriter.AlignRight|tabwriter.Debug)
+	if !format.NoHeaders {
+		fmt.Fprintln(tw, strings.Join(table.headers(), separator))
+	}
+	for _, row := range table.Rows {
+		fmt.Fprintln(tw, strings.Join(row, separator))
+	}
+	return tw.Flush()
+}
+
+// templateRoot returns the value templates are executed against, with the
+// items under their JSON field names.
+func templateRoot(list List) (map[string]interface{}, error) {
+	items, err := generic(list.Items)
+	return map[string]interface{}{"items": items}, err
+}
+
+// generic converts value to maps, slices and scalars keyed by the JSON field
+// names.
+func generic(value interface{}) (result interface{}, err error) {
+	err = convert(value, &result)
+	return result, err
+}
+
+func convert(value interface{}, result interface{}) error {
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(encoded, result)
+}
@@ -0,0 +1,234 @@
+package render
+
+import (
+	"bytes"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+type testItem struct {
+	Name     string   `json:"name"`
+	MemoryMB int      `json:"memoryMB"`
+	IPs      []string `json:"ips"`
+	On       bool     `json:"poweredOn"`
+}
+
+func testList() List {
+	items := []testItem{
+		{Name: "web, eu", MemoryMB: 4096, IPs: []string{"10.0.0.1", "10.0.0.2"}, On: true},
+		{Name: "db", MemoryMB: 16384, IPs: []string{"10.0.0.3"}, On: true},
+		{Name: "cache", MemoryMB: 512},
+	}
+
+	table := Table{Columns: []Column{
+		{Header: "Name", Key: "name"},
+		{Header: "Memory (MB)", Key: "memoryMB", Numeric: true},
+		{Header: "IPs", Key: "ips", Wide: true},
+	}}
+	for _, item := range items {
+		table.Rows = append(table.Rows, []string{item.Name, strconv.Itoa(item.MemoryMB), strings.Join(item.IPs, ",")})
+	}
+
+	return List{Document: map[string]interface{}{"items": items}, Items: items, Table: table}
+}
+
+func TestRender(t *testing.T) {
+	tests := []struct {
+		name     string
+		format   string
+		columns  []string
+		sortBy   string
+		expected string
+	}{
+		{"table", "table", nil, "", "" +
+			"    Name | Memory (MB)\n" +
+			" web, eu | 4096\n" +
+			"      db | 16384\n" +
+			"   cache | 512\n"},
+		{"table sorted by a numeric column", "table", nil, "memoryMB", "" +
+			"    Name | Memory (MB)\n" +
+			"   cache | 512\n" +
+			" web, eu | 4096\n" +
+			"      db | 16384\n"},
+		{"wide", "wide", nil, "", "" +
+			"    Name |  Memory (MB) | IPs\n" +
+			" web, eu |         4096 | 10.0.0.1,10.0.0.2\n" +
+			"      db |        16384 | 10.0.0.3\n" +
+			"   cache |          512 | \n"},
+		{"table columns", "table", []string{"ips", "name"}, "name", "" +
+			"               IPs | Name\n" +
+			"                   | cache\n" +
+			"          10.0.0.3 | db\n" +
+			" 10.0.0.1,10.0.0.2 | web, eu\n"},
+		{"csv", "csv", nil, "", "" +
+			"Name,Memory (MB),IPs\n" +
+			"\"web, eu\",4096,\"10.0.0.1,10.0.0.2\"\n" +
+			"db,16384,10.0.0.3\n" +
+			"cache,512,\n"},
+		{"json", "json", nil, "", `{
+    "items": [
+        {
+            "name": "web, eu",
+            "memoryMB": 4096,
+            "ips": [
+                "10.0.0.1",
+                "10.0.0.2"
+            ],
+            "poweredOn": true
+        },
+        {
+            "name": "db",
+            "memoryMB": 16384,
+            "ips": [
+                "10.0.0.3"
+            ],
+            "poweredOn": true
+        },
+        {
+            "name": "cache",
+            "memoryMB": 512,
+            "ips": null,
+            "poweredOn": false
+        }
+    ]
+}
+`},
+		{"yaml", "yaml", nil, "", `items:
+  - ips:
+      - 10.0.0.1
+      - 10.0.0.2
+    memoryMB: 4096
+    name: web, eu
+    poweredOn: true
+  - ips:
+      - 10.0.0.3
+    memoryMB: 16384
+    name: db
+    poweredOn: true
+  - ips: null
+    memoryMB: 512
+    name: cache
+    poweredOn: false
+`},
+		{"ndjson", "ndjson", nil, "", "" +
+			`{"name":"web, eu","memoryMB":4096,"ips":["10.0.0.1","10.0.0.2"],"poweredOn":true}` + "\n" +
+			`{"name":"db","memoryMB":16384,"ips":["10.0.0.3"],"poweredOn":true}` + "\n" +
+			`{"name":"cache","memoryMB":512,"ips":null,"poweredOn":false}` + "\n"},
+		{"go-template", `go-template={{range .items}}{{.name}}={{.memoryMB}};{{end}}`, nil, "", "web, eu=4096;db=16384;cache=512;"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			format, err := ParseFormat(test.format)
+			if err != nil {
+				t.Fatal(err)
+			}
+			format.Columns, format.SortBy = test.columns, test.sortBy
+
+			output := bytes.Buffer{}
+			if err := format.Render(&output, testList()); err != nil {
+				t.Fatal(err)
+			}
+			if output.String() != test.expected {
+				t.Errorf("expected:\n%s\ngot:\n%s", test.expected, output.String())
+			}
+		})
+	}
+}
+
+func TestJSONPath(t *testing.T) {
+	tests := []struct {
+		template string
+		expected string
+	}{
+		{`{.items[0].name}`, "web, eu"},
+		{`{.items[-1].name}`, "cache"},
+		{`{.items[5].name}`, ""},
+		{`{.items[*].name}`, "web, eu db cache"},
+		{`{.items[*].ips[*]}`, "10.0.0.1 10.0.0.2 10.0.0.3"},
+		{`{.items[1].*}`, `["10.0.0.3"] 16384 db true`},
+		{`{.items[0]['memoryMB']}`, "4096"},
+		{`{.items[0].ips}`, `["10.0.0.1","10.0.0.2"]`},
+		{`{.items[?(@.memoryMB>=4096)].name}`, "web, eu db"},
+		{`{.items[?(@.memoryMB < 4096)].name}`, "cache"},
+		{`{.items[?(@.memoryMB==16384)].name}`, "db"},
+		{`{.items[?(@.name=="web, eu")].memoryMB}`, "4096"},
+		{`{.items[?(@.name!='db')].name}`, "web, eu cache"},
+		{`{.items[?(@.name>"d")].name}`, "web, eu db"},
+		{`{.items[?(@.poweredOn==false)].name}`, "cache"},
+		{`{.items[?(@.ips[0])].name}`, "web, eu db"},
+		{`{.items[?(@.name=="a]b")].name}`, ""},
+		{`{.items[?(@.name=="db")].ips[*]}`, "10.0.0.3"},
+		{`{range .items[*]}{.name}{"\t"}{.memoryMB}{"\n"}{end}`, "web, eu\t4096\ndb\t16384\ncache\t512\n"},
+		{`{range .items[?(@.poweredOn==true)]}[{.name}]{end}`, "[web, eu][db]"},
+		{`names: {.items[*].name}`, "names: web, eu db cache"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.template, func(t *testing.T) {
+			format, err := ParseFormat(JSONPATH + "=" + test.template)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			output := bytes.Buffer{}
+			if err := format.Render(&output, testList()); err != nil {
+				t.Fatal(err)
+			}
+			if output.String() != test.expected {
+				t.Errorf("expected %q, got %q", test.expected, output.String())
+			}
+		})
+	}
+}
+
+func TestParseFormatErrors(t *testing.T) {
+	tests := []struct {
+		value string
+		error string
+	}{
+		{"bogus", `unknown output format "bogus"`},
+		{"xml=x", `unknown output format "xml=x"`},
+		{"json={.items}", "does not take a template"},
+		{"jsonpath", "needs a template"},
+		{"go-template=", "needs a template"},
+		{"go-template={{.items", "unclosed action"},
+		{"jsonpath={.items[0}", "unclosed ["},
+		{"jsonpath={.items", "unclosed expression"},
+		{"jsonpath={range .items[*]}{.name}", "{range} without {end}"},
+		{"jsonpath={end}", "{end} without {range}"},
+		{"jsonpath={.items[?(.name)]}", "must start with @"},
+		{"jsonpath={.items[?(@.name==db)]}", "quote strings"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.value, func(t *testing.T) {
+			_, err := ParseFormat(test.value)
+			if err == nil || !strings.Contains(err.Error(), test.error) {
+				t.Errorf("expected an error containing %q, got %v", test.error, err)
+			}
+		})
+	}
+}
+
+func TestRenderErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		format Format
+		error  string
+	}{
+		{"unknown format", Format{Name: "bogus"}, `unknown output format "bogus"`},
+		{"unknown column", Format{Name: TABLE, Columns: []string{"cpu"}}, `unknown column "cpu"`},
+		{"unknown sort column", Format{Name: CSV, SortBy: "cpu"}, `unknown sort column "cpu"`},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := test.format.Render(&bytes.Buffer{}, testList())
+			if err == nil || !strings.Contains(err.Error(), test.error) {
+				t.Errorf("expected an error containing %q, got %v", test.error, err)
+			}
+		})
+	}
+}
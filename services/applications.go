@@ -2,71 +2,70 @@ package services
 
 import (
 	"encoding/json"
-	"flag"
 	"fmt"
+	neturl "net/url"
 	"os"
+	"strconv"
 	"strings"
-	"text/tabwriter"
+
+	"gitlab.eng.vmware.com/vmware-navigator-practice/tooling/tanzu-apptx-cli/filter"
+	"gitlab.eng.vmware.com/vmware-navigator-practice/tooling/tanzu-apptx-cli/render"
 )
 
 type Applications struct {
-	url          string
-	username     string
-	password     string
-	outputFormat string
-	operation    string
+	url              string
+	username         string
+	password         string
+	outputFormat     render.Format
+	filterExpression *filter.Expression
+	listOptions      ListOptions
+	operation        string
 }
 
 func (applications Applications) Execute() {
 	applications = applications.validate()
 
 	request := Request{applications.url, applications.username, applications.password}
-	authResponse := Authenticate(request)
+	client := authenticate(request)
 
 	switch applications.operation {
 	case LIST:
-		applicationsList := applications.list(authResponse.Token)
-
-		if applications.outputFormat == "table" {
-			w := tabwriter.NewWriter(os.Stdout, 0, 0, 1, ' ', tabwriter.AlignRight|tabwriter.Debug)
-			fmt.Fprintln(w, "Application Name\tID\tComponent Name\tProcess Name\tComponent Type\tVM Name\tVM UUID\tService Type\tIs Containerizable")
-			for _, application := range applicationsList.Embedded.Applications {
-				for _, componentsGroupedByVM := range application.ComponentsGroupedByVMs {
-					for _, component := range componentsGroupedByVM.Components {
-						fmt.Fprintln(w, application.Name, "\t", application.ID, "\t", component.CompName,
-							"\t", component.ProcessName, "\t", component.Type, "\t", component.VMName,
-							"\t", component.VMUUID, "\t", component.ServiceType, "\t", component.IsContainerizable)
-					}
-				}
-			}
-			w.Flush()
-		} else if applications.outputFormat == "json" {
-			prettyJSON, err := json.MarshalIndent(applicationsList, "", "    ")
-			if err != nil {
-				fmt.Println("Failed to generate json", err)
-			}
-			fmt.Printf("%s\n", string(prettyJSON))
-		} else if applications.outputFormat == "csv" {
-			fmt.Println("Application Name,ID,Component Name,Process Name,Component Type,VM Name,VM UUID,Service Type,Is Containerizable")
-			for _, application := range applicationsList.Embedded.Applications {
-				for _, componentsGroupedByVM := range application.ComponentsGroupedByVMs {
-					for _, component := range componentsGroupedByVM.Components {
-						fmt.Println(application.Name, ",", application.ID, ",", component.CompName,
-							",", component.ProcessName, ",", component.Type, ",", component.VMName,
-							",", component.VMUUID, ",", component.ServiceType, ",", component.IsContainerizable)
-					}
+		applicationsList, err := client.ListApplications(fetchOptions(applications.filterExpression, applications.listOptions))
+		exitOnError("Failed to fetch the list of applications", err)
+
+		applications.filter(&applicationsList)
+
+		table := render.Table{Columns: []render.Column{
+			{Header: "Application Name", Key: "name"},
+			{Header: "ID", Key: "id", Wide: true},
+			{Header: "Component Name", Key: "compName"},
+			{Header: "Process Name", Key: "processName", Wide: true},
+			{Header: "Component Type", Key: "type", Wide: true},
+			{Header: "VM Name", Key: "vmName"},
+			{Header: "VM UUID", Key: "vmUUID", Wide: true},
+			{Header: "Service Type", Key: "serviceType"},
+			{Header: "Is Containerizable", Key: "isContainerizable"},
+		}}
+		for _, application := range applicationsList.Embedded.Applications {
+			for _, componentsGroupedByVM := range application.ComponentsGroupedByVMs {
+				for _, component := range componentsGroupedByVM.Components {
+					table.Rows = append(table.Rows, []string{application.Name, application.ID, component.CompName,
+						component.ProcessName, component.Type, component.VMName,
+						component.VMUUID, component.ServiceType, strconv.FormatBool(component.IsContainerizable)})
 				}
 			}
 		}
+
+		printList(applications.outputFormat, render.List{Document: applicationsList, Items: applicationsList.Embedded.Applications, Table: table},
+			len(applicationsList.Embedded.Applications), applicationsList.Pagination, "applications")
 	default:
 		fmt.Println("Operation not supported")
 		applications.printUsage()
-		os.Exit(1)
 	}
 }
 
 func (applications Applications) validate() Applications {
-	listCmd := flag.NewFlagSet(LIST, flag.ExitOnError)
+	listCmd := NewFlagSet(LIST)
 
 	if len(os.Args) < 3 {
 		applications.printUsage()
@@ -77,54 +76,89 @@ func (applications Applications) validate() Applications {
 	var url string
 	var username string
 	var password string
-	var format string
+	var format render.Format
+	var expression *filter.Expression
+	var listOptions ListOptions
 
 	if operation == LIST {
-		listCmd.StringVar(&url, "fqdn", "", "Application Transformer FQDN / IP, ex: appliance.example.com")
-		listCmd.StringVar(&username, "username", "", "Application Transformer admin username")
-		listCmd.StringVar(&password, "password", "", "Application Transformer admin password")
-		listCmd.StringVar(&format, "output-format", "table", "Output format - json,csv,table")
+		connection := addConnectionFlags(listCmd)
+		addFormatFlag(listCmd, &format)
+		addFilterFlag(listCmd, &expression, `name == "petclinic" && isContainerizable`)
+		addListFlags(listCmd, &listOptions)
 
 		listCmd.Parse(os.Args[3:])
+		url, username, password = connection.resolve()
 
-		if (len(url) == 0 || len(username) == 0 || len(password) == 0) ||
+		if !hasCredentials(url, username, password) ||
 			(strings.Contains(url, "https://")) {
 			fmt.Printf("Usage: '%s %s %s [flags]' \n", CLI_NAME, APPLICATIONS_CMD, LIST)
 			fmt.Println("Available Flags:")
 			listCmd.PrintDefaults()
-			os.Exit(1)
+			os.Exit(EXIT_USAGE)
 		}
 	} else {
 		applications.printUsage()
 	}
 
-	applications = Applications{url, username, password, format, operation}
+	applications = Applications{url, username, password, format, expression, listOptions, operation}
 	return applications
 }
 
 func (applications Applications) printUsage() {
-	fmt.Printf("Usage: '%s %s [command]' \n", CLI_NAME, APPLICATIONS_CMD)
-	fmt.Println("Available Commands:")
-	fmt.Printf("  %s \t\t\t%s \n", LIST, "List all applications")
-	os.Exit(1)
+	PrintCommandUsage(APPLICATIONS_CMD, EXIT_USAGE)
 }
 
-func (applications Applications) list(token string) (response ApplicationsListResponse) {
-	url := PROTOCOL + "://" + applications.url + "/" + PREFIX + "/" + APPLICATIONS
+// filter keeps the components matching the filter expression and the
+// applications left with any. Components are matched together with the name
+// and id of their application, as they are shown in the table.
+func (applications Applications) filter(applicationsList *ApplicationsListResponse) {
+	expression := applications.filterExpression
+	if expression == nil {
+		return
+	}
 
-	body, responseCode := processRequest(token, url, "GET", nil)
+	kept := applicationsList.Embedded.Applications[:0]
+	for _, application := range applicationsList.Embedded.Applications {
+		groups := application.ComponentsGroupedByVMs[:0]
+		for _, componentsGroupedByVM := range application.ComponentsGroupedByVMs {
+			components := componentsGroupedByVM.Components[:0]
+			for _, component := range componentsGroupedByVM.Components {
+				fields, err := filter.Fields(component)
+				exitOnError("Failed to filter the list", err)
+				fields["id"], fields["name"] = application.ID, application.Name
+
+				if expression.MatchFields(fields) {
+					components = append(components, component)
+				}
+			}
 
-	if responseCode == 200 {
-		fmt.Println("Successfully fetched the list of applications \n")
-	} else {
-		fmt.Println("Failed to fetch the list of application. Response code:", responseCode)
-	}
+			if len(components) > 0 {
+				componentsGroupedByVM.Components = components
+				groups = append(groups, componentsGroupedByVM)
+			}
+		}
 
-	err := json.Unmarshal(body, &response)
-	if err != nil {
-		fmt.Println("Failed to parse the response body.\n[ERROR] -", err)
-		os.Exit(1)
+		if len(groups) > 0 {
+			application.ComponentsGroupedByVMs = groups
+			kept = append(kept, application)
+		} else if len(application.ComponentsGroupedByVMs) == 0 && expression.MatchFields(map[string]interface{}{"id": application.ID, "name": application.Name}) {
+			kept = append(kept, application)
+		}
 	}
 
-	return response
+	applicationsList.Embedded.Applications = kept[:applications.listOptions.limit(len(kept))]
+}
+
+// ListApplications returns the applications and the components grouped into
+// them.
+func (client *Client) ListApplications(options ListOptions) (response ApplicationsListResponse, err error) {
+	response.Pagination, err = client.paginate(client.discoveryURL(APPLICATIONS), neturl.Values{}, options, func(body []byte) (Pagination, int, error) {
+		page := ApplicationsListResponse{}
+		err := json.Unmarshal(body, &page)
+		response.Embedded.Applications = append(response.Embedded.Applications, page.Embedded.Applications...)
+		return page.Pagination, len(page.Embedded.Applications), err
+	})
+
+	response.Embedded.Applications = response.Embedded.Applications[:options.limit(len(response.Embedded.Applications))]
+	return response, err
 }
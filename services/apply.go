@@ -0,0 +1,532 @@
+package services
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// Plan actions
+const (
+	ACTION_CREATE  = "create"
+	ACTION_UPDATE  = "update"
+	ACTION_REPLACE = "replace"
+	ACTION_DELETE  = "delete"
+)
+
+var actionSymbols = map[string]string{
+	ACTION_CREATE:  "+",
+	ACTION_UPDATE:  "~",
+	ACTION_REPLACE: "-/+",
+	ACTION_DELETE:  "-",
+}
+
+// plannedChange is a step of the plan apply computes to make the appliance
+// match a manifest.
+type plannedChange struct {
+	Action   string
+	Resource string
+	Name     string
+	// Details describes what differs, ex: vcenters [vc1] -> [vc1 vc2].
+	Details []string
+	// operation is the command equivalent to the change, reported in the
+	// results, ex: 'vcenter register'.
+	operation string
+	run       func() error
+}
+
+func (change plannedChange) String() string {
+	line := fmt.Sprintf("%3s %s %q", actionSymbols[change.Action], change.Resource, change.Name)
+	if len(change.Details) > 0 {
+		line += " (" + strings.Join(change.Details, ", ") + ")"
+	}
+	return line
+}
+
+type Apply struct {
+	url      string
+	username string
+	password string
+	file     string
+	prune    bool
+	planOnly bool
+}
+
+func (apply Apply) Execute() {
+	apply = apply.validate()
+
+	manifest, err := LoadManifest(apply.file)
+	exitOnError("Failed to load the manifest", err)
+
+	request := Request{apply.url, apply.username, apply.password}
+	client := authenticate(request)
+
+	changes, err := client.plan(manifest, apply.prune)
+	exitOnError("Failed to compute the plan", err)
+
+	applyPlan(changes, apply.planOnly)
+}
+
+func (apply Apply) validate() Apply {
+	applyCmd := NewFlagSet(APPLY_CMD)
+
+	var file string
+	var prune bool
+	var planOnly bool
+
+	connection := addConnectionFlags(applyCmd)
+	addOutputFlags(applyCmd)
+	addPollFlags(applyCmd)
+	applyCmd.StringVar(&file, "f", "", "Manifest to apply, YAML or JSON, - reads stdin")
+	applyCmd.BoolVar(&prune, "prune", false, "Delete the resources registered on the appliance but missing from the manifest")
+	applyCmd.BoolVar(&planOnly, "plan", false, "Print the plan and exit without making changes")
+
+	applyCmd.Parse(os.Args[2:])
+	url, username, password := connection.resolve()
+
+	if !hasCredentials(url, username, password) ||
+		len(file) == 0 ||
+		(strings.Contains(url, "https://")) {
+		apply.printUsage(applyCmd)
+	}
+
+	return Apply{url, username, password, file, prune, planOnly}
+}
+
+func (apply Apply) printUsage(applyCmd *flag.FlagSet) {
+	fmt.Printf("Usage: '%s %s -f [manifest] [flags]' \n", CLI_NAME, APPLY_CMD)
+	fmt.Println("Available Flags:")
+	applyCmd.PrintDefaults()
+	fmt.Println("\nManifest:")
+	fmt.Printf(`  apiVersion: %s
+  serviceAccounts:
+    - alias: vc-admin
+      username: administrator@vsphere.local
+      password: ${VC_PASSWORD}
+  globalDefaults:
+    VCs: vc-admin
+  vcenters:
+    - name: vc1
+      fqdn: vc1.example.com
+      serviceAccount: vc-admin
+      scanScope:
+        dataCenter: Datacenter
+        clusters: [prod]
+  vrnis:
+    - fqdn: vrni.example.com
+      alias: vrni
+      serviceAccount: vrni-admin
+      serviceAccountType: LOCAL
+      vcenters: [vc1]
+`, MANIFEST_VERSION)
+	os.Exit(EXIT_USAGE)
+}
+
+// applyPlan prints the plan and, unless planOnly or -dry-run is set, makes the
+// changes in order. It stops and exits at the first change that fails.
+func applyPlan(changes []plannedChange, planOnly bool) {
+	// The plan goes to stderr with -output json, which is left to the results.
+	var out io.Writer = os.Stdout
+	if outputMode == "json" {
+		out = os.Stderr
+	}
+
+	printPlan(out, changes)
+
+	if planOnly || dryRun || len(changes) == 0 {
+		return
+	}
+
+	fmt.Fprintln(out)
+
+	for i, change := range changes {
+		err := change.run()
+
+		result := Result{Operation: change.operation, Target: change.Name, Status: resultStatus(err)}
+		printResult(result, err, fmt.Sprintf("[%d/%d] %s", i+1, len(changes), strings.TrimSpace(change.String())))
+
+		if err != nil {
+			fmt.Fprintf(out, "Stopped after %d of %d changes\n", i, len(changes))
+			os.Exit(exitCode(err))
+		}
+	}
+
+	fmt.Fprintf(out, "Applied %d changes\n", len(changes))
+}
+
+// printPlan prints a summary line followed by one line per change.
+func printPlan(out io.Writer, changes []plannedChange) {
+	if len(changes) == 0 {
+		fmt.Fprintln(out, "No changes, the appliance matches the manifest")
+		return
+	}
+
+	counts := map[string]int{}
+	for _, change := range changes {
+		counts[change.Action]++
+	}
+
+	fmt.Fprintf(out, "Plan: %d to create, %d to update, %d to replace, %d to delete\n\n",
+		counts[ACTION_CREATE], counts[ACTION_UPDATE], counts[ACTION_REPLACE], counts[ACTION_DELETE])
+
+	for _, change := range changes {
+		fmt.Fprintln(out, change)
+	}
+}
+
+// plan returns the changes that make the appliance match the manifest, in the
+// order they must be applied: service accounts, global defaults, vCenters and
+// vRNI instances are created and updated first, then deleted in the reverse
+// order. Resources missing from the manifest are only deleted with prune.
+func (client *Client) plan(manifest Manifest, prune bool) (changes []plannedChange, err error) {
+	serviceAccounts, replaced, err := client.planServiceAccounts(manifest)
+	if err != nil {
+		return nil, err
+	}
+
+	globalDefaults, resets, err := client.planGlobalDefaults(manifest, replaced)
+	if err != nil {
+		return nil, err
+	}
+
+	vCenters, err := client.planVCenters(manifest)
+	if err != nil {
+		return nil, err
+	}
+
+	vrnis, err := client.planVRNIs(manifest, replaced)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, planned := range [][]plannedChange{serviceAccounts, globalDefaults, vCenters, vrnis} {
+		for _, change := range planned {
+			if change.Action != ACTION_DELETE {
+				changes = append(changes, change)
+			}
+		}
+	}
+
+	if prune {
+		for _, planned := range [][]plannedChange{vrnis, vCenters, resets, serviceAccounts} {
+			for _, change := range planned {
+				if change.Action == ACTION_DELETE {
+					changes = append(changes, change)
+				}
+			}
+		}
+	}
+
+	return changes, nil
+}
+
+// planServiceAccounts plans the service accounts and returns the aliases of
+// the ones replaced, whose UUID changes.
+func (client *Client) planServiceAccounts(manifest Manifest) (changes []plannedChange, replaced map[string]bool, err error) {
+	response, err := client.ListServiceAccounts("", ListOptions{})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	existing := map[string]ServiceAccount{}
+	for _, serviceAccount := range response.Embedded.ServiceAccounts {
+		existing[serviceAccount.Alias] = serviceAccount
+	}
+
+	replaced = map[string]bool{}
+
+	for _, desired := range manifest.ServiceAccounts {
+		desired := desired
+		create := func() error {
+			if len(desired.Password) == 0 {
+				return fmt.Errorf("Service Account %q needs a password to be created", desired.Alias)
+			}
+			_, err := client.CreateServiceAccount(desired.Username, desired.Password, desired.Alias)
+			return err
+		}
+
+		current, found := existing[desired.Alias]
+		delete(existing, desired.Alias)
+
+		if found && current.Username == desired.Username {
+			continue
+		}
+
+		if !found {
+			changes = append(changes, plannedChange{Action: ACTION_CREATE, Resource: "Service Account", Name: desired.Alias,
+				operation: SERVICE_ACCOUNT_CMD + " " + REGISTER, run: create})
+			continue
+		}
+
+		replaced[desired.Alias] = true
+		changes = append(changes, plannedChange{Action: ACTION_REPLACE, Resource: "Service Account", Name: desired.Alias,
+			Details:   []string{fmt.Sprintf("username %s -> %s", current.Username, desired.Username)},
+			operation: SERVICE_ACCOUNT_CMD + " " + REGISTER,
+			run: func() error {
+				if err := client.DeleteServiceAccount(desired.Alias); err != nil {
+					return err
+				}
+				return create()
+			}})
+	}
+
+	for _, alias := range sortedKeys(existing) {
+		alias := alias
+		changes = append(changes, plannedChange{Action: ACTION_DELETE, Resource: "Service Account", Name: alias,
+			operation: SERVICE_ACCOUNT_CMD + " " + UNREGISTER,
+			run:       func() error { return client.DeleteServiceAccount(alias) }})
+	}
+
+	return changes, replaced, nil
+}
+
+// planGlobalDefaults returns the assignments and, separately, the resets of
+// the global defaults. Appliances that cannot list their global defaults get
+// every default of the manifest assigned.
+func (client *Client) planGlobalDefaults(manifest Manifest, replaced map[string]bool) (assignments []plannedChange, resets []plannedChange, err error) {
+	current, err := client.ListGlobalDefaults()
+	if IsNotFound(err) {
+		current, err = nil, nil
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	for _, saType := range sortedKeys(manifest.GlobalDefaults) {
+		saType, alias := saType, manifest.GlobalDefaults[saType]
+
+		serviceAccount, found := current[saType]
+		if found && serviceAccount.Alias == alias && !replaced[alias] {
+			continue
+		}
+
+		change := plannedChange{Action: ACTION_UPDATE, Resource: "Global Default", Name: saType,
+			Details:   []string{fmt.Sprintf("service account %s -> %s", firstNonEmpty(serviceAccount.Alias, "none"), alias)},
+			operation: GLOBAL_DEFAULT_CMD + " " + ASSIGN,
+			run:       func() error { return client.AssignGlobalDefault(saType, alias) }}
+		if !found {
+			change.Action = ACTION_CREATE
+			change.Details = []string{"service account " + alias}
+		}
+		assignments = append(assignments, change)
+	}
+
+	for _, saType := range sortedKeys(current) {
+		saType := saType
+		if _, desired := manifest.GlobalDefaults[saType]; desired {
+			continue
+		}
+
+		resets = append(resets, plannedChange{Action: ACTION_DELETE, Resource: "Global Default", Name: saType,
+			operation: GLOBAL_DEFAULT_CMD + " " + RESET,
+			run:       func() error { return client.ResetGlobalDefault(saType) }})
+	}
+
+	return assignments, resets, nil
+}
+
+// planVCenters registers the vCenters of the manifest, and scans the ones
+// with a scan scope once registered. vCenters moved to another FQDN are
+// registered again.
+func (client *Client) planVCenters(manifest Manifest) (changes []plannedChange, err error) {
+	response, err := client.ListVCenters("", "")
+	if err != nil {
+		return nil, err
+	}
+
+	existing := map[string]VCenter{}
+	for _, vCenter := range response.Embedded.VCenters {
+		existing[vCenter.VCName] = vCenter
+	}
+
+	for _, desired := range manifest.VCenters {
+		desired := desired
+		register := func() error {
+			tasks, err := client.RegisterVCenter(desired.Fqdn, desired.Name, manifest.vCenterServiceAccount(desired))
+			if err == nil {
+				_, err = monitorTask(client, tasks)
+			}
+			if err != nil || desired.ScanScope == nil {
+				return err
+			}
+
+			tasks, err = client.ScanVirtualMachinesIn(desired.Name, "", desired.ScanScope.filters())
+			if err == nil {
+				_, err = monitorTask(client, tasks)
+			}
+			return err
+		}
+
+		var details []string
+		if desired.ScanScope != nil {
+			details = append(details, "scan "+desired.ScanScope.String())
+		}
+
+		current, found := existing[desired.Name]
+		delete(existing, desired.Name)
+
+		switch {
+		case !found:
+			changes = append(changes, plannedChange{Action: ACTION_CREATE, Resource: "vCenter", Name: desired.Name,
+				Details: append([]string{"fqdn " + desired.Fqdn}, details...), operation: VCENTER_CMD + " " + REGISTER, run: register})
+		case current.Fqdn != desired.Fqdn:
+			changes = append(changes, plannedChange{Action: ACTION_REPLACE, Resource: "vCenter", Name: desired.Name,
+				Details:   append([]string{fmt.Sprintf("fqdn %s -> %s", current.Fqdn, desired.Fqdn)}, details...),
+				operation: VCENTER_CMD + " " + REGISTER,
+				run: func() error {
+					if err := client.UnregisterVCenter(desired.Name, ""); err != nil {
+						return err
+					}
+					return register()
+				}})
+		}
+	}
+
+	for _, name := range sortedKeys(existing) {
+		name := name
+		changes = append(changes, plannedChange{Action: ACTION_DELETE, Resource: "vCenter", Name: name,
+			operation: VCENTER_CMD + " " + UNREGISTER,
+			run:       func() error { return client.UnregisterVCenter(name, "") }})
+	}
+
+	return changes, nil
+}
+
+// planVRNIs registers the vRNI instances of the manifest and updates the
+// credentials and vCenters of the registered ones, including the ones whose
+// service account is replaced. Instances switching between SaaS and
+// on-premises are registered again.
+func (client *Client) planVRNIs(manifest Manifest, replaced map[string]bool) (changes []plannedChange, err error) {
+	response, err := client.ListVRNIs()
+	if err != nil {
+		return nil, err
+	}
+
+	existing := map[string]VRNIResponse{}
+	for _, vrniResponse := range response {
+		existing[vrniResponse.IP] = vrniResponse
+	}
+
+	for _, desired := range manifest.VRNIs {
+		desired := desired
+		register := func() error {
+			return client.RegisterVRNI(VRNIRegistration{desired.Alias, desired.Fqdn, desired.VCenters,
+				desired.ServiceAccount, desired.ServiceAccountType, desired.SaaS, desired.APIToken})
+		}
+
+		current, found := existing[desired.Fqdn]
+		delete(existing, desired.Fqdn)
+
+		if !found || current.IsSaaS != desired.SaaS {
+			change := plannedChange{Action: ACTION_CREATE, Resource: "vRNI", Name: desired.Fqdn,
+				Details: []string{fmt.Sprintf("vcenters %v", desired.VCenters)}, operation: VRNI_CMD + " " + REGISTER, run: register}
+			if found {
+				change.Action = ACTION_REPLACE
+				change.Details = []string{fmt.Sprintf("saas %t -> %t", current.IsSaaS, desired.SaaS)}
+				change.run = func() error {
+					if err := client.UnregisterVRNI(desired.Fqdn); err != nil {
+						return err
+					}
+					return register()
+				}
+			}
+			changes = append(changes, change)
+			continue
+		}
+
+		var details []string
+		credentials := false
+		if !desired.SaaS {
+			if current.Alias != desired.Alias {
+				details = append(details, fmt.Sprintf("alias %s -> %s", current.Alias, desired.Alias))
+				credentials = true
+			}
+			if current.ServiceAccount.Alias != desired.ServiceAccount {
+				details = append(details, fmt.Sprintf("service account %s -> %s", current.ServiceAccount.Alias, desired.ServiceAccount))
+				credentials = true
+			} else if replaced[desired.ServiceAccount] {
+				details = append(details, fmt.Sprintf("service account %s replaced", desired.ServiceAccount))
+				credentials = true
+			}
+			// The type is optional, the current one is kept when it is omitted.
+			if len(desired.ServiceAccountType) > 0 && current.ServiceAccountType != desired.ServiceAccountType {
+				details = append(details, fmt.Sprintf("service account type %s -> %s", current.ServiceAccountType, desired.ServiceAccountType))
+				credentials = true
+			}
+		}
+
+		serviceAccountType := firstNonEmpty(desired.ServiceAccountType, current.ServiceAccountType)
+
+		var currentVCenters []string
+		for _, vCenter := range current.VCenters {
+			currentVCenters = append(currentVCenters, vCenter.VCName)
+		}
+		membership := !sameNames(currentVCenters, desired.VCenters)
+		if membership {
+			details = append(details, fmt.Sprintf("vcenters %v -> %v", sortedNames(currentVCenters), sortedNames(desired.VCenters)))
+		}
+
+		if len(details) == 0 {
+			continue
+		}
+
+		changes = append(changes, plannedChange{Action: ACTION_UPDATE, Resource: "vRNI", Name: desired.Fqdn, Details: details,
+			operation: VRNI_CMD + " " + UPDATE_CREDENTIALS,
+			run: func() error {
+				if credentials {
+					err := client.UpdateVRNICredentials(desired.Fqdn, desired.Alias, desired.ServiceAccount, serviceAccountType, "")
+					if err != nil {
+						return err
+					}
+				}
+				if membership {
+					return client.SetVRNIVCenters(desired.Fqdn, desired.VCenters)
+				}
+				return nil
+			}})
+	}
+
+	for _, fqdn := range sortedKeys(existing) {
+		fqdn := fqdn
+		changes = append(changes, plannedChange{Action: ACTION_DELETE, Resource: "vRNI", Name: fqdn,
+			operation: VRNI_CMD + " " + UNREGISTER,
+			run:       func() error { return client.UnregisterVRNI(fqdn) }})
+	}
+
+	return changes, nil
+}
+
+func (scope ScanScope) String() string {
+	parts := []string{firstNonEmpty(scope.DataCenter, "all datacenters")}
+	if len(scope.Clusters) > 0 {
+		parts = append(parts, fmt.Sprintf("clusters %v", scope.Clusters))
+	}
+	if len(scope.Folders) > 0 {
+		parts = append(parts, fmt.Sprintf("folders %v", scope.Folders))
+	}
+	return strings.Join(parts, " ")
+}
+
+// sortedKeys returns the keys of a map keyed by name, sorted.
+func sortedKeys(m interface{}) (keys []string) {
+	for _, key := range reflect.ValueOf(m).MapKeys() {
+		keys = append(keys, key.String())
+	}
+
+	sort.Strings(keys)
+	return keys
+}
+
+func sortedNames(names []string) []string {
+	sorted := append([]string{}, names...)
+	sort.Strings(sorted)
+	return sorted
+}
+
+func sameNames(a []string, b []string) bool {
+	return strings.Join(sortedNames(a), "\x00") == strings.Join(sortedNames(b), "\x00")
+}
@@ -0,0 +1,60 @@
+package services_test
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"gitlab.eng.vmware.com/vmware-navigator-practice/tooling/tanzu-apptx-cli/services"
+	"gitlab.eng.vmware.com/vmware-navigator-practice/tooling/tanzu-apptx-cli/simulator"
+)
+
+func TestApplyVRNIWithoutServiceAccountType(t *testing.T) {
+	sim, client := startSimulator(t, simulator.Options{TaskDuration: 50 * time.Millisecond})
+	registerVCenter(t, sim, client, "vc1")
+
+	if _, err := client.CreateServiceAccount("admin@local", "secret", "vrni-admin"); err != nil {
+		t.Fatal(err)
+	}
+
+	registration := services.VRNIRegistration{Alias: "vrni", Fqdn: sim.Address(), VCNames: []string{"vc1"}, SAAlias: "vrni-admin"}
+	if err := client.RegisterVRNI(registration); err != nil {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join(t.TempDir(), "manifest.yaml")
+	manifest := "" +
+		"apiVersion: " + services.MANIFEST_VERSION + "\n" +
+		"vrnis:\n" +
+		"  - fqdn: " + sim.Address() + "\n" +
+		"    alias: vrni\n" +
+		"    serviceAccount: vrni-admin\n" +
+		"    vcenters: [vc1]\n"
+	if err := ioutil.WriteFile(path, []byte(manifest), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	output, code := runCLI(t, sim, services.APPLY_CMD, "-f", path, "-plan")
+	if code != services.EXIT_SUCCESS || !strings.Contains(output, "No changes") {
+		t.Errorf("expected no changes when the manifest omits the service account type, got exit code %d:\n%s", code, output)
+	}
+
+	manifest = strings.Replace(manifest, "alias: vrni\n", "alias: vrni-renamed\n", 1)
+	if err := ioutil.WriteFile(path, []byte(manifest), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	if output, code := runCLI(t, sim, services.APPLY_CMD, "-f", path); code != services.EXIT_SUCCESS {
+		t.Fatalf("expected the alias to be updated, got exit code %d:\n%s", code, output)
+	}
+
+	vrnis, err := client.ListVRNIs()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(vrnis) != 1 || vrnis[0].Alias != "vrni-renamed" || vrnis[0].ServiceAccountType != "LOCAL" {
+		t.Errorf("expected the vRNI to be renamed and keep its service account type, got %+v", vrnis)
+	}
+}
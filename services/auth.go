@@ -1,46 +1,112 @@
 package services
 
 import (
-	"bytes"
 	"encoding/json"
 	"fmt"
-	"io/ioutil"
+	"net/http"
 	"os"
 )
 
-func Authenticate(request Request) (authResponse AuthResponse) {
+// Authenticate opens a session on the appliance and keeps the session token
+// on the client for subsequent requests. Without a password, the credentials
+// are looked up with the credential helper of the client, if any.
+func (client *Client) Authenticate() error {
+	if len(client.Password) == 0 && len(client.credentialHelper) > 0 {
+		credentials, err := client.credentialHelper.Get(APPLIANCE_KEY + "/" + client.URL)
+		if err != nil {
+			return &AuthError{Err: err}
+		}
+		client.sessionMutex.Lock()
+		client.Username = firstNonEmpty(client.Username, credentials.Username)
+		client.Password = credentials.Secret
+		client.sessionMutex.Unlock()
+	}
 
-	authRequest := AuthRequest{request.Username, request.Password}
+	url := PROTOCOL + "://" + client.URL + "/" + AUTHMANAGER + "/" + SESSION
 
-	client := getHTTPSClient()
+	client.sessionMutex.Lock()
+	authRequest := AuthRequest{client.Username, client.Password}
+	client.sessionMutex.Unlock()
 
-	url := PROTOCOL + "://" + request.URL + "/" + AUTHMANAGER + "/" + SESSION
-	reqBody, err := json.Marshal(authRequest)
+	return client.openSession(url, authRequest)
+}
 
-	if err != nil {
-		fmt.Println("Failed to parse the request payload.\n[ERROR] -", err)
-		os.Exit(1)
+// Refresh exchanges the refresh token obtained by Authenticate for a new
+// session token.
+func (client *Client) Refresh() error {
+	refreshToken := client.Session().RefreshToken
+	if len(refreshToken) == 0 {
+		return fmt.Errorf("no refresh token available")
 	}
 
-	resp, err := client.Post(url, "application/json", bytes.NewBuffer(reqBody))
+	url := PROTOCOL + "://" + client.URL + "/" + AUTHMANAGER + "/" + SESSION + "/" + REFRESH
+
+	return client.openSession(url, AuthResponse{RefreshToken: refreshToken})
+}
+
+// openSession posts the credentials or the refresh token to url and keeps the
+// session of the response. The request goes through the retries, the rate
+// limit and the tracing of the other requests.
+func (client *Client) openSession(url string, payload interface{}) error {
+	body, resp, err := client.send("POST", url, payload, OPEN_SESSION)
 	if err != nil {
-		fmt.Println("HTTP request failed.\n[ERROR] -", err)
-		os.Exit(1)
+		return err
 	}
 
-	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return &AuthError{Err: &APIError{Method: "POST", URL: url, StatusCode: resp.StatusCode, Body: body}}
+	}
+
+	return client.setSession(resp, body)
+}
 
-	body, err := ioutil.ReadAll(resp.Body)
+// Logout invalidates the session on the appliance. A session the appliance
+// rejects with 401 has already expired or been invalidated, which is not an
+// error.
+func (client *Client) Logout() error {
+	url := PROTOCOL + "://" + client.URL + "/" + AUTHMANAGER + "/" + SESSION
+
+	body, resp, err := client.send("DELETE", url, nil, CLOSE_SESSION)
 	if err != nil {
-		fmt.Println("Unable to parse HTTP response.\n[ERROR] -", err)
-		os.Exit(1)
+		return err
 	}
 
-	err = json.Unmarshal(body, &authResponse)
+	if resp.StatusCode != 401 && (resp.StatusCode < 200 || resp.StatusCode > 299) {
+		return &APIError{Method: "DELETE", URL: url, StatusCode: resp.StatusCode, Body: body}
+	}
 
-	if err != nil {
-		fmt.Println("Failed to parse the response body.\n[ERROR] -", err)
-		os.Exit(1)
+	client.UseSession(Session{})
+	return nil
+}
+
+// Session returns the tokens held by the client, so that they can be cached
+// and handed to a later client with UseSession.
+func (client *Client) Session() Session {
+	client.sessionMutex.Lock()
+	defer client.sessionMutex.Unlock()
+
+	return Session{Username: client.Username, Token: client.token, RefreshToken: client.refreshToken}
+}
+
+// UseSession makes the client reuse a session obtained earlier instead of
+// authenticating again.
+func (client *Client) UseSession(session Session) {
+	client.sessionMutex.Lock()
+	defer client.sessionMutex.Unlock()
+
+	client.token = session.Token
+	client.refreshToken = session.RefreshToken
+	if len(client.Username) == 0 {
+		client.Username = session.Username
+	}
+}
+
+func (client *Client) setSession(resp *http.Response, body []byte) error {
+	authResponse := AuthResponse{}
+	if len(body) > 0 {
+		if err := json.Unmarshal(body, &authResponse); err != nil {
+			return fmt.Errorf("failed to parse the response body: %w", err)
+		}
 	}
 
 	for _, cookie := range resp.Cookies() {
@@ -49,5 +115,162 @@ func Authenticate(request Request) (authResponse AuthResponse) {
 		}
 	}
 
-	return authResponse
+	client.sessionMutex.Lock()
+	if len(authResponse.Token) > 0 {
+		client.token = authResponse.Token
+	}
+
+	if len(authResponse.RefreshToken) > 0 {
+		client.refreshToken = authResponse.RefreshToken
+	}
+	client.sessionMutex.Unlock()
+
+	if client.OnSession != nil {
+		client.OnSession(client.Session())
+	}
+
+	return nil
+}
+
+// renewal is a renewal of the session in progress, shared by the requests
+// refused with the expired token while it runs.
+type renewal struct {
+	done chan struct{}
+	err  error
+}
+
+// reauthenticate renews the session after a request sent with the token
+// expired was refused. The first request refused renews it, the requests
+// refused meanwhile wait for that renewal and share its outcome, and a
+// request refused with a token renewed already is simply sent again.
+func (client *Client) reauthenticate(expired string) error {
+	client.sessionMutex.Lock()
+	if client.token != expired {
+		client.sessionMutex.Unlock()
+		return nil
+	}
+
+	if inProgress := client.renewal; inProgress != nil {
+		client.sessionMutex.Unlock()
+		<-inProgress.done
+		return inProgress.err
+	}
+
+	current := &renewal{done: make(chan struct{})}
+	client.renewal = current
+	client.sessionMutex.Unlock()
+
+	current.err = client.renew()
+
+	client.sessionMutex.Lock()
+	client.renewal = nil
+	client.sessionMutex.Unlock()
+	close(current.done)
+
+	return current.err
+}
+
+// renew opens a new session, with the refresh token when there is one and
+// otherwise with the credentials.
+func (client *Client) renew() error {
+	session := client.Session()
+
+	if len(session.RefreshToken) > 0 {
+		if err := client.Refresh(); err == nil {
+			return nil
+		}
+	}
+
+	client.sessionMutex.Lock()
+	credentials := len(client.credentialHelper) > 0 || (len(client.Username) > 0 && len(client.Password) > 0)
+	client.sessionMutex.Unlock()
+
+	if !credentials {
+		return fmt.Errorf("no credentials available to authenticate again")
+	}
+
+	return client.Authenticate()
+}
+
+// authenticate builds a client for the request. It reuses the session cached
+// by login for the appliance, refreshing it when it has expired, and falls
+// back to the credentials in the request. With -record or -replay the cached
+// sessions are not used. It exits when no session can be established.
+func authenticate(request Request) *Client {
+	client := newClient(request)
+
+	// A cassette holds the whole exchange with the appliance, starting with
+	// the authentication, and a replayed one accepts any credentials.
+	if client.cassette != nil {
+		if client.cassette.Replaying() {
+			client.Username = firstNonEmpty(client.Username, REDACTED)
+			client.Password = firstNonEmpty(client.Password, REDACTED)
+			client.credentialHelper = ""
+		}
+
+		promptPassword(client)
+		exitOnError("Failed to authenticate with Application Transformer", client.Authenticate())
+		return client
+	}
+
+	sessions, err := LoadSessions()
+	exitOnError("Failed to load the cached sessions", err)
+
+	session, cached := sessions.Session(request.URL, request.Username)
+	if cached {
+		client.UseSession(session)
+		client.OnSession = func(session Session) {
+			sessions.Set(request.URL, session)
+			if err := sessions.Save(); err != nil {
+				fmt.Fprintln(os.Stderr, "Failed to save the cached sessions.\n[ERROR] -", err)
+			}
+		}
+
+		if !tokenExpired(session.Token) || client.Refresh() == nil {
+			return client
+		}
+	}
+
+	promptPassword(client)
+
+	if len(client.Password) == 0 && len(client.credentialHelper) == 0 {
+		exitOnError("Failed to authenticate with Application Transformer",
+			&AuthError{Err: fmt.Errorf("the cached session has expired, run '%s %s' again", CLI_NAME, LOGIN_CMD)})
+	}
+
+	exitOnError("Failed to authenticate with Application Transformer", client.Authenticate())
+
+	return client
+}
+
+// promptPassword prompts for the admin password on the terminal when the
+// client has neither a password nor a credential helper.
+func promptPassword(client *Client) {
+	if len(client.Password) > 0 || len(client.credentialHelper) > 0 || len(client.Username) == 0 || !isTerminal() {
+		return
+	}
+
+	password, err := promptSecret(fmt.Sprintf("Application Transformer password for %s@%s", client.Username, client.URL))
+	exitOnError("Failed to authenticate with Application Transformer", err)
+	client.Password = password
+}
+
+// newClient builds a client for the request with the TLS, transport and
+// request settings of the operation being executed.
+func newClient(request Request) *Client {
+	client, err := NewClient(request)
+	exitOnError("Failed to configure the connection", err)
+	exitOnError("Failed to load the TLS settings", client.SetTLSOptions(tlsOptions))
+	exitOnError("Failed to configure the connection", client.SetTransportOptions(transportOptions))
+	client.SetRetryOptions(retryOptions)
+	client.SetRateLimit(rateLimit)
+	client.SetDryRun(dryRunOutput())
+	client.SetTrace(traceOutput(), int(traceLevel))
+
+	cassette, err := cassetteOf()
+	exitOnError("Failed to open the cassette", err)
+	client.SetCassette(cassette)
+
+	client.SetCredentialHelper(credentialHelper)
+	return client
 }
@@ -0,0 +1,125 @@
+package services_test
+
+import (
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"gitlab.eng.vmware.com/vmware-navigator-practice/tooling/tanzu-apptx-cli/services"
+	"gitlab.eng.vmware.com/vmware-navigator-practice/tooling/tanzu-apptx-cli/simulator"
+)
+
+// TestConcurrentRenewal introspects virtual machines from several goroutines
+// sharing one client while the session keeps expiring. Run it with -race.
+func TestConcurrentRenewal(t *testing.T) {
+	ttl := 300 * time.Millisecond
+	sim, admin := startSimulator(t, simulator.Options{TokenTTL: ttl, TaskDuration: time.Second, VirtualMachines: 4})
+	registerVCenter(t, sim, admin, "vc1")
+
+	response, err := admin.ListVirtualMachines(services.VirtualMachineFilter{}, services.ListOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	virtualMachines := response.Embedded.VirtualMachinesResponse
+	if len(virtualMachines) != 4 {
+		t.Fatalf("expected 4 virtual machines, got %d", len(virtualMachines))
+	}
+
+	// The refresh token can be used once, so renewing the session more than
+	// once per expiry fails without credentials to fall back on.
+	client := sessionClient(t, sim, admin)
+	time.Sleep(ttl)
+
+	errs := make([]error, len(virtualMachines))
+	var wait sync.WaitGroup
+	for i, virtualMachine := range virtualMachines {
+		wait.Add(1)
+		go func(i int, id string) {
+			defer wait.Done()
+
+			tasks, err := client.IntrospectVirtualMachine(id)
+			if err == nil {
+				_, err = client.WatchTask(tasks.TaskID, polling)
+			}
+			errs[i] = err
+		}(i, virtualMachine.ID)
+	}
+	wait.Wait()
+
+	for i, err := range errs {
+		if err != nil {
+			t.Errorf("failed to introspect %s: %v", virtualMachines[i].Name, err)
+		}
+	}
+}
+
+// TestReauthentication lets the session expire and checks that a request
+// renews it with the refresh token, falls back on the credentials once the
+// refresh token was used, and reports the 401 without either.
+func TestReauthentication(t *testing.T) {
+	ttl := 200 * time.Millisecond
+	sim, admin := startSimulator(t, simulator.Options{TokenTTL: ttl})
+
+	expired := admin.Session()
+	time.Sleep(ttl)
+
+	client := sessionClient(t, sim, admin)
+	if _, err := client.ListServiceAccounts("", services.ListOptions{}); err != nil {
+		t.Fatalf("expected the refresh token to renew the session, got %v", err)
+	}
+	if renewed := client.Session(); renewed.Token == expired.Token || renewed.RefreshToken == expired.RefreshToken {
+		t.Error("expected the session to be renewed")
+	}
+
+	admin.UseSession(expired)
+	if _, err := admin.ListServiceAccounts("", services.ListOptions{}); err != nil {
+		t.Fatalf("expected the credentials to renew the session, got %v", err)
+	}
+	if admin.Token() == expired.Token {
+		t.Error("expected a new session")
+	}
+
+	client.UseSession(expired)
+	var apiError *services.APIError
+	if _, err := client.ListServiceAccounts("", services.ListOptions{}); !errors.As(err, &apiError) || apiError.StatusCode != 401 {
+		t.Errorf("expected a 401 once the refresh token was used, got %v", err)
+	}
+}
+
+// TestLogoutExpiredSession logs out of a session that already expired, which
+// must succeed without renewing the session first.
+func TestLogoutExpiredSession(t *testing.T) {
+	ttl := 200 * time.Millisecond
+	sim, admin := startSimulator(t, simulator.Options{TokenTTL: ttl})
+	time.Sleep(ttl)
+
+	client := sessionClient(t, sim, admin)
+	if err := client.Logout(); err != nil {
+		t.Fatalf("expected the expired session to be logged out, got %v", err)
+	}
+	if token := client.Token(); len(token) > 0 {
+		t.Errorf("expected the session to be dropped, got the token %s", token)
+	}
+
+	// The refresh token can be used once, so it is only left when the logout
+	// did not renew the session.
+	if _, err := sessionClient(t, sim, admin).ListServiceAccounts("", services.ListOptions{}); err != nil {
+		t.Errorf("expected the logout not to renew the session, got %v", err)
+	}
+
+	home := t.TempDir()
+	if output, code := runCLIWith(t, sim, home, nil, services.LOGIN_CMD); code != services.EXIT_SUCCESS {
+		t.Fatalf("failed to log in, got exit code %d:\n%s", code, output)
+	}
+	time.Sleep(ttl)
+
+	if output, code := runCLIWith(t, sim, home, nil, services.LOGOUT_CMD); code != services.EXIT_SUCCESS {
+		t.Errorf("expected the expired session to be logged out, got exit code %d:\n%s", code, output)
+	}
+	if output, _ := runCLIWith(t, sim, home, nil, services.LOGOUT_CMD); !strings.Contains(output, "no cached session") {
+		t.Errorf("expected the cached session to be removed, got %q", output)
+	}
+}
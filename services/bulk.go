@@ -0,0 +1,301 @@
+package services
+
+import (
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"text/tabwriter"
+
+	"gopkg.in/yaml.v3"
+)
+
+// VCenterRegistration is a row of a bulk vCenter registration file. The
+// certificate thumbprint is fetched from the vCenter when it is not given.
+type VCenterRegistration struct {
+	Fqdn       string `yaml:"fqdn"`
+	Name       string `yaml:"name"`
+	SAAlias    string `yaml:"saAlias"`
+	Thumbprint string `yaml:"thumbprint,omitempty"`
+}
+
+// registrationColumns are the columns of a CSV registration file, in the
+// order used when the file has no header row.
+var registrationColumns = []string{"fqdn", "name", "sa-alias", "thumbprint"}
+
+// LoadVCenterRegistrations reads the vCenters to register from a YAML list,
+// when path ends in .yaml or .yml, or else from a CSV file with the columns
+// fqdn, name, sa-alias and an optional thumbprint. A CSV header row naming
+// the columns may give them in any order.
+func LoadVCenterRegistrations(path string) (registrations []VCenterRegistration, err error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		decoder := yaml.NewDecoder(bytes.NewReader(data))
+		decoder.KnownFields(true)
+		if err := decoder.Decode(&registrations); err != nil && err != io.EOF {
+			return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+		}
+	default:
+		registrations, err = parseRegistrationsCSV(data)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+		}
+	}
+
+	if len(registrations) == 0 {
+		return nil, fmt.Errorf("%s has no vCenters to register", path)
+	}
+
+	seen := map[string]bool{}
+	for i, registration := range registrations {
+		if len(registration.Fqdn) == 0 || len(registration.Name) == 0 || len(registration.SAAlias) == 0 {
+			return nil, fmt.Errorf("vCenter %d of %s needs an fqdn, a name and a service account alias", i+1, path)
+		}
+		if seen[registration.Name] {
+			return nil, fmt.Errorf("vCenter %q is listed more than once in %s", registration.Name, path)
+		}
+		seen[registration.Name] = true
+	}
+
+	return registrations, nil
+}
+
+func parseRegistrationsCSV(data []byte) (registrations []VCenterRegistration, err error) {
+	reader := csv.NewReader(bytes.NewReader(data))
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+	reader.Comment = '#'
+
+	records, err := reader.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+
+	columns := registrationColumns
+	if len(records) > 0 && strings.EqualFold(strings.TrimSpace(records[0][0]), "fqdn") {
+		columns = records[0]
+		records = records[1:]
+	}
+
+	for _, record := range records {
+		registration := VCenterRegistration{}
+		for i, value := range record {
+			if i >= len(columns) {
+				return nil, fmt.Errorf("line %q has more than the %d columns %v", strings.Join(record, ","), len(columns), columns)
+			}
+
+			value = strings.TrimSpace(value)
+			switch strings.ToLower(strings.TrimSpace(columns[i])) {
+			case "fqdn":
+				registration.Fqdn = value
+			case "name":
+				registration.Name = value
+			case "sa-alias":
+				registration.SAAlias = value
+			case "thumbprint":
+				registration.Thumbprint = value
+			default:
+				return nil, fmt.Errorf("unknown column %q, expected %v", columns[i], registrationColumns)
+			}
+		}
+		registrations = append(registrations, registration)
+	}
+
+	return registrations, nil
+}
+
+// registrationOutcome is the result of registering and syncing a row.
+type registrationOutcome struct {
+	registerTaskID string
+	syncTaskID     string
+	status         string
+	err            error
+}
+
+// registerVCenters registers and then syncs every vCenter of the file with
+// at most parallelism rows in flight, printing each step on stderr and a
+// summary once all the rows are done. A failed row does not stop the others.
+// It exits with the code of the failure when all the rows failed and with
+// EXIT_PARTIAL_SUCCESS when only some did.
+func registerVCenters(client *Client, registrations []VCenterRegistration, parallelism int) {
+	if parallelism < 1 {
+		parallelism = 1
+	}
+
+	targets := make([]string, len(registrations))
+	for i, registration := range registrations {
+		targets[i] = registration.Name
+	}
+
+	journal := openJournal(targets)
+	outcomes := make([]registrationOutcome, len(registrations))
+
+	var mutex sync.Mutex
+	progress := func(registration VCenterRegistration, format string, arguments ...interface{}) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		fmt.Fprintf(os.Stderr, "vCenter %s: %s\n", registration.Name, fmt.Sprintf(format, arguments...))
+	}
+
+	rows := make(chan int)
+	var waitGroup sync.WaitGroup
+
+	for worker := 0; worker < parallelism && worker < len(registrations); worker++ {
+		waitGroup.Add(1)
+		go func() {
+			defer waitGroup.Done()
+			for i := range rows {
+				outcomes[i] = registerVCenter(client, registrations[i], progress, journal)
+			}
+		}()
+	}
+
+	for i := range registrations {
+		rows <- i
+	}
+	close(rows)
+	waitGroup.Wait()
+
+	var failure error
+	failed, skipped := 0, 0
+
+	for i, registration := range registrations {
+		if outcomes[i].status == "SKIPPED" {
+			skipped++
+		}
+
+		if outcomes[i].err != nil && !errors.Is(outcomes[i].err, ErrDryRun) {
+			failed++
+			if failure == nil {
+				failure = outcomes[i].err
+			}
+		}
+
+		if outcomes[i].status == "" {
+			outcomes[i].status = resultStatus(outcomes[i].err)
+		}
+
+		if outputMode == "json" {
+			result := Result{Operation: operationName(), Target: registration.Name,
+				TaskID: firstNonEmpty(outcomes[i].syncTaskID, outcomes[i].registerTaskID), Status: outcomes[i].status}
+			if outcomes[i].err != nil && !errors.Is(outcomes[i].err, ErrDryRun) {
+				result.Error = outcomes[i].err.Error()
+			}
+			printResult(result, nil, "")
+		}
+	}
+
+	if outputMode != "json" {
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 1, ' ', tabwriter.AlignRight|tabwriter.Debug)
+		fmt.Fprintln(w, "Row\tvCenter\tFQDN\tRegister Task\tSync Task\tStatus\tError")
+		for i, registration := range registrations {
+			message := ""
+			if outcomes[i].err != nil && !errors.Is(outcomes[i].err, ErrDryRun) {
+				message = outcomes[i].err.Error()
+			}
+			fmt.Fprintln(w, i+1, "\t", registration.Name, "\t", registration.Fqdn, "\t", outcomes[i].registerTaskID, "\t",
+				outcomes[i].syncTaskID, "\t", outcomes[i].status, "\t", message)
+		}
+		w.Flush()
+
+		if dryRun {
+			fmt.Println("Dry run, no changes were made")
+		} else if skipped > 0 {
+			fmt.Printf("Registered %d of %d vCenters, %d of them in a previous run\n", len(registrations)-failed, len(registrations), skipped)
+		} else {
+			fmt.Printf("Registered %d of %d vCenters\n", len(registrations)-failed, len(registrations))
+		}
+	}
+
+	journal.finish(failed == 0)
+
+	if failed == len(registrations) {
+		os.Exit(exitCode(failure))
+	} else if failed > 0 {
+		os.Exit(EXIT_PARTIAL_SUCCESS)
+	}
+}
+
+// registerVCenter registers the vCenter of a row, waits for the registration
+// and then syncs it. With -resume, a row completed by the interrupted run is skipped and the run goes
+// on from the last task it submitted for the row.
+func registerVCenter(client *Client, registration VCenterRegistration,
+	progress func(registration VCenterRegistration, format string, arguments ...interface{}), journal *Journal) (outcome registrationOutcome) {
+	entry, resumed := journal.resumable(registration.Name)
+	if resumed && entry.Step == SYNC_VCENTERS && entry.Status == "SUCCESS" {
+		progress(registration, "registered and synced in a previous run, skipped")
+		outcome.syncTaskID = entry.TaskID
+		outcome.status = "SKIPPED"
+		return outcome
+	}
+
+	resumeRegister := resumed && entry.Step == REGISTER && entry.running()
+	resumeSync := resumed && entry.Step == SYNC_VCENTERS && entry.running()
+	registered := resumed && (entry.Step == REGISTER && entry.Status == "SUCCESS" || entry.Step == SYNC_VCENTERS)
+
+	if !registered {
+		var tasks Tasks
+		if resumeRegister {
+			tasks.TaskID = entry.TaskID
+			progress(registration, "resuming the registration, task %s", tasks.TaskID)
+		} else {
+			var err error
+			tasks, err = client.RegisterVCenterWithThumbprint(registration.Fqdn, registration.Name, registration.SAAlias, registration.Thumbprint)
+			if err != nil {
+				outcome.err = err
+				journal.record(registration.Name, REGISTER, "", resultStatus(err), err)
+				return outcome
+			}
+			journal.record(registration.Name, REGISTER, tasks.TaskID, "SUBMITTED", nil)
+			progress(registration, "registration submitted, task %s", tasks.TaskID)
+		}
+
+		outcome.registerTaskID = tasks.TaskID
+
+		if _, err := client.WatchTask(tasks.TaskID, monitorOptions); err != nil {
+			journal.record(registration.Name, REGISTER, tasks.TaskID, resultStatus(err), err)
+			outcome.err = fmt.Errorf("registration failed: %w", err)
+			return outcome
+		}
+		journal.record(registration.Name, REGISTER, tasks.TaskID, "SUCCESS", nil)
+	}
+
+	var tasks Tasks
+	if resumeSync {
+		tasks.TaskID = entry.TaskID
+		progress(registration, "registered, resuming the sync, task %s", tasks.TaskID)
+	} else {
+		var err error
+		tasks, err = client.SyncVCenter(registration.Name, "")
+		if err != nil {
+			journal.record(registration.Name, SYNC_VCENTERS, "", resultStatus(err), err)
+			outcome.err = fmt.Errorf("sync failed: %w", err)
+			return outcome
+		}
+		journal.record(registration.Name, SYNC_VCENTERS, tasks.TaskID, "SUBMITTED", nil)
+		progress(registration, "registered, sync submitted, task %s", tasks.TaskID)
+	}
+
+	outcome.syncTaskID = tasks.TaskID
+
+	if _, err := client.WatchTask(tasks.TaskID, monitorOptions); err != nil {
+		journal.record(registration.Name, SYNC_VCENTERS, tasks.TaskID, resultStatus(err), err)
+		outcome.err = fmt.Errorf("sync failed: %w", err)
+		return outcome
+	}
+
+	journal.record(registration.Name, SYNC_VCENTERS, tasks.TaskID, "SUCCESS", nil)
+	progress(registration, "registered and synced")
+	return outcome
+}
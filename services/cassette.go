@@ -0,0 +1,349 @@
+package services
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+)
+
+// ErrNotRecorded is returned when replaying a request that the cassette does
+// not hold.
+var ErrNotRecorded = errors.New("the request was not recorded in the cassette")
+
+// recordDir and replayDir hold the -record and -replay flags of the operation
+// being executed.
+var recordDir string
+var replayDir string
+
+// Interaction is a request and its response as saved in a cassette, with the
+// passwords, tokens and session cookies scrubbed. A request that failed holds
+// the error instead of the response. The certificate lookups of the vCenters
+// and vRNI instances are saved too, with the method TLS.
+type Interaction struct {
+	Method         string      `json:"method"`
+	URL            string      `json:"url"`
+	RequestHeader  http.Header `json:"requestHeader,omitempty"`
+	RequestBody    interface{} `json:"requestBody,omitempty"`
+	StatusCode     int         `json:"statusCode,omitempty"`
+	ResponseHeader http.Header `json:"responseHeader,omitempty"`
+	ResponseBody   interface{} `json:"responseBody,omitempty"`
+	Certificate    []byte      `json:"certificate,omitempty"`
+	Error          string      `json:"error,omitempty"`
+}
+
+// Cassette is a directory of interactions, one JSON file per request in the
+// order they were sent. A recording cassette saves the requests of the client
+// as they are sent, a replaying one answers them from the files without any
+// network access.
+type Cassette struct {
+	dir          string
+	replaying    bool
+	interactions []Interaction
+	replayed     []bool
+	mutex        sync.Mutex
+}
+
+// RecordCassette returns a cassette saving the interactions to dir, which is
+// created when missing and must not hold a cassette already.
+func RecordCassette(dir string) (*Cassette, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+
+	files, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	if len(files) > 0 {
+		return nil, fmt.Errorf("%s already holds a cassette, record to an empty directory", dir)
+	}
+
+	return &Cassette{dir: dir}, nil
+}
+
+// LoadCassette returns a cassette replaying the interactions recorded in dir.
+func LoadCassette(dir string) (*Cassette, error) {
+	files, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("%s holds no recorded interactions", dir)
+	}
+
+	// The files are numbered, sort 999999.json before 1000000.json.
+	sort.Slice(files, func(i, j int) bool {
+		if len(files[i]) != len(files[j]) {
+			return len(files[i]) < len(files[j])
+		}
+		return files[i] < files[j]
+	})
+
+	cassette := &Cassette{dir: dir, replaying: true}
+	for _, file := range files {
+		data, err := ioutil.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+
+		interaction := Interaction{}
+		decoder := json.NewDecoder(bytes.NewReader(data))
+		decoder.UseNumber()
+		if err := decoder.Decode(&interaction); err != nil {
+			return nil, fmt.Errorf("failed to parse %s: %w", file, err)
+		}
+		cassette.interactions = append(cassette.interactions, interaction)
+	}
+	cassette.replayed = make([]bool, len(cassette.interactions))
+
+	return cassette, nil
+}
+
+// Replaying reports whether the cassette answers the requests instead of
+// recording them.
+func (cassette *Cassette) Replaying() bool {
+	return cassette.replaying
+}
+
+// SetCassette makes the client record its requests to the cassette, or
+// replay them from it. A nil cassette sends the requests as usual.
+func (client *Client) SetCassette(cassette *Cassette) {
+	client.cassette = cassette
+	client.httpClient = client.getHTTPSClient()
+}
+
+// save writes the next interaction of a recording cassette.
+func (cassette *Cassette) save(interaction Interaction) error {
+	cassette.mutex.Lock()
+	defer cassette.mutex.Unlock()
+
+	var buffer bytes.Buffer
+	encoder := json.NewEncoder(&buffer)
+	encoder.SetEscapeHTML(false)
+	encoder.SetIndent("", "    ")
+	if err := encoder.Encode(interaction); err != nil {
+		return err
+	}
+
+	cassette.interactions = append(cassette.interactions, interaction)
+	file := filepath.Join(cassette.dir, fmt.Sprintf("%06d.json", len(cassette.interactions)))
+	return ioutil.WriteFile(file, buffer.Bytes(), 0600)
+}
+
+// replay returns the first interaction of the request not replayed yet. Once
+// all of them were, a GET request is answered with the last one again, so
+// polling a task that finished keeps getting its final status.
+func (cassette *Cassette) replay(method string, address string) (Interaction, error) {
+	cassette.mutex.Lock()
+	defer cassette.mutex.Unlock()
+
+	last := -1
+	for i, interaction := range cassette.interactions {
+		if interaction.Method != method || requestURI(interaction.URL) != requestURI(address) {
+			continue
+		}
+		if !cassette.replayed[i] {
+			cassette.replayed[i] = true
+			return interaction, nil
+		}
+		last = i
+	}
+
+	if last >= 0 && method == "GET" {
+		return cassette.interactions[last], nil
+	}
+
+	return Interaction{}, fmt.Errorf("%w: %s %s", ErrNotRecorded, method, address)
+}
+
+// certificate returns the certificate served at address, fetched with fetch
+// and saved when recording, or replayed from the cassette.
+func (cassette *Cassette) certificate(address string, fetch func() ([]byte, error)) ([]byte, error) {
+	if cassette.replaying {
+		interaction, err := cassette.replay("TLS", address)
+		if err == nil && len(interaction.Error) > 0 {
+			err = errors.New(interaction.Error)
+		}
+		return interaction.Certificate, err
+	}
+
+	certificate, err := fetch()
+	interaction := Interaction{Method: "TLS", URL: address, Certificate: certificate}
+	if err != nil {
+		interaction.Error = err.Error()
+	}
+
+	if saveErr := cassette.save(interaction); saveErr != nil {
+		return nil, fmt.Errorf("failed to record the certificate of %s: %w", address, saveErr)
+	}
+	return certificate, err
+}
+
+// requestURI returns the path and query of address, so that a cassette can be
+// replayed against any -fqdn.
+func requestURI(address string) string {
+	parsed, err := url.Parse(address)
+	if err != nil || len(parsed.Host) == 0 {
+		return address
+	}
+	return parsed.RequestURI()
+}
+
+// cassetteTransport is the transport of a client with a cassette.
+type cassetteTransport struct {
+	next     http.RoundTripper
+	cassette *Cassette
+}
+
+func (transport *cassetteTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	var requestBody []byte
+	if req.Body != nil {
+		var err error
+		requestBody, err = ioutil.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		req.Body = ioutil.NopCloser(bytes.NewReader(requestBody))
+	}
+
+	if transport.cassette.replaying {
+		return transport.replay(req)
+	}
+
+	interaction := Interaction{
+		Method:        req.Method,
+		URL:           req.URL.String(),
+		RequestHeader: scrubHeader(req.Header),
+		RequestBody:   scrubBody(requestBody),
+	}
+
+	resp, err := transport.next.RoundTrip(req)
+	if err != nil {
+		interaction.Error = err.Error()
+	} else {
+		responseBody, readErr := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		if readErr != nil {
+			return nil, readErr
+		}
+		resp.Body = ioutil.NopCloser(bytes.NewReader(responseBody))
+
+		interaction.StatusCode = resp.StatusCode
+		interaction.ResponseHeader = scrubHeader(resp.Header)
+		interaction.ResponseBody = scrubBody(responseBody)
+	}
+
+	if saveErr := transport.cassette.save(interaction); saveErr != nil {
+		return nil, fmt.Errorf("failed to record %s %s: %w", req.Method, req.URL, saveErr)
+	}
+	return resp, err
+}
+
+// replay answers the request from the cassette.
+func (transport *cassetteTransport) replay(req *http.Request) (*http.Response, error) {
+	interaction, err := transport.cassette.replay(req.Method, req.URL.String())
+	if err != nil {
+		return nil, err
+	}
+	if len(interaction.Error) > 0 {
+		return nil, errors.New(interaction.Error)
+	}
+
+	body, err := unscrubBody(interaction.ResponseBody)
+	if err != nil {
+		return nil, err
+	}
+
+	header := interaction.ResponseHeader
+	if header == nil {
+		header = http.Header{}
+	}
+
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", interaction.StatusCode, http.StatusText(interaction.StatusCode)),
+		StatusCode:    interaction.StatusCode,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          ioutil.NopCloser(bytes.NewReader(body)),
+		ContentLength: int64(len(body)),
+		Request:       req,
+	}, nil
+}
+
+// scrubHeader returns a copy of the headers with the credentials and the
+// session cookies redacted.
+func scrubHeader(header http.Header) http.Header {
+	scrubbed := http.Header{}
+	for name, values := range header {
+		for _, value := range values {
+			scrubbed.Add(name, redactHeader(name, value))
+		}
+	}
+	return scrubbed
+}
+
+// scrubBody returns a JSON body decoded with its secrets redacted, so that it
+// is saved readable, and any other body as a string.
+func scrubBody(body []byte) interface{} {
+	if len(body) == 0 {
+		return nil
+	}
+
+	var decoded interface{}
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.UseNumber()
+	if err := decoder.Decode(&decoded); err != nil {
+		return string(body)
+	}
+	return redact(decoded)
+}
+
+// unscrubBody encodes a body saved by scrubBody again.
+func unscrubBody(body interface{}) ([]byte, error) {
+	switch body := body.(type) {
+	case nil:
+		return nil, nil
+	case string:
+		return []byte(body), nil
+	}
+	return json.Marshal(body)
+}
+
+// openedCassette is the cassette of the -record or -replay flag, opened once
+// and shared by the clients of the operation.
+var openedCassette *Cassette
+
+// cassetteOf returns the cassette of the -record or -replay flag, or nil
+// without them.
+func cassetteOf() (*Cassette, error) {
+	if openedCassette != nil || (len(recordDir) == 0 && len(replayDir) == 0) {
+		return openedCassette, nil
+	}
+
+	var err error
+	switch {
+	case len(recordDir) > 0 && len(replayDir) > 0:
+		return nil, fmt.Errorf("-record and -replay cannot be combined")
+	case len(recordDir) > 0:
+		openedCassette, err = RecordCassette(recordDir)
+	default:
+		openedCassette, err = LoadCassette(replayDir)
+	}
+	return openedCassette, err
+}
+
+// replaying reports whether the operation is replayed from a cassette.
+func replaying() bool {
+	return len(replayDir) > 0
+}
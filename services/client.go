@@ -0,0 +1,106 @@
+package services
+
+import (
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// Client drives the Application Transformer API. It holds the appliance
+// address, the admin credentials and the session obtained by Authenticate.
+// Every method returns an error instead of exiting, so the package can be
+// embedded in other Go programs. A client can be used by several goroutines
+// once configured: its session is renewed once for all of them when it
+// expires.
+type Client struct {
+	URL      string
+	Username string
+	Password string
+
+	// OnSession, when set, is called whenever the client obtains a new
+	// session, ex: to cache it.
+	OnSession func(session Session)
+
+	// sessionMutex guards the tokens and the renewal in progress.
+	sessionMutex sync.Mutex
+	token        string
+	refreshToken string
+	renewal      *renewal
+
+	trust      *trustStore
+	retry      RetryOptions
+	limiter    *rateLimiter
+	httpClient *http.Client
+	transport  *http.Transport
+	dryRun     io.Writer
+	tracer     *tracer
+	cassette   *Cassette
+
+	credentialHelper CredentialHelper
+	transportOptions TransportOptions
+}
+
+// NewClient returns a Client for the appliance described by request. Call
+// Authenticate before any other method. Certificates are verified against the
+// system trust store until SetTLSOptions says otherwise. The requests of the
+// client share one transport, which keeps the connections alive.
+func NewClient(request Request) (*Client, error) {
+	trust, err := newTrustStore(TLSOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	client := &Client{
+		URL:              request.URL,
+		Username:         request.Username,
+		Password:         request.Password,
+		trust:            trust,
+		retry:            DefaultRetryOptions(),
+		transportOptions: DefaultTransportOptions(),
+	}
+
+	transport, err := newTransport(trust, request.URL, client.transportOptions)
+	if err != nil {
+		return nil, err
+	}
+	client.setTransport(transport)
+
+	return client, nil
+}
+
+// SetTLSOptions changes how the certificates of the appliance, vCenters and
+// vRNI instances are verified.
+func (client *Client) SetTLSOptions(options TLSOptions) error {
+	trust, err := newTrustStore(options)
+	if err != nil {
+		return err
+	}
+
+	transport, err := newTransport(trust, client.URL, client.transportOptions)
+	if err != nil {
+		return err
+	}
+
+	client.trust = trust
+	client.setTransport(transport)
+	return nil
+}
+
+// SetCredentialHelper makes Authenticate look up the credentials with helper
+// when the client has no password.
+func (client *Client) SetCredentialHelper(helper CredentialHelper) {
+	client.credentialHelper = helper
+}
+
+// Token returns the session token obtained by Authenticate.
+func (client *Client) Token() string {
+	client.sessionMutex.Lock()
+	defer client.sessionMutex.Unlock()
+
+	return client.token
+}
+
+func (client *Client) discoveryURL(paths ...string) string {
+	return PROTOCOL + "://" + client.URL + "/" + PREFIX + "/" + strings.Join(paths, "/")
+}
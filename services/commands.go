@@ -0,0 +1,423 @@
+package services
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+)
+
+// Command is a top-level command of the command tree, ex: vcenter, and the
+// operations it supports. Run parses the rest of os.Args itself. Commands
+// without operations, ex: login, take their flags right after the command.
+type Command struct {
+	Name       string
+	Summary    string
+	Operations []Operation
+	Run        func()
+	// Hidden commands are left out of the usage and of completion.
+	Hidden bool
+}
+
+// Operation is an operation of a command, ex: vcenter register.
+type Operation struct {
+	Name    string
+	Summary string
+}
+
+// commandTree holds the commands given to Run.
+var commandTree []Command
+
+// Commands returns the commands implemented by this package. The caller may
+// add its own before passing them to Run.
+func Commands() []Command {
+	return []Command{
+		{Name: SERVICE_ACCOUNT_CMD, Summary: "Service Accounts operations", Run: ServiceAccounts{}.Execute, Operations: []Operation{
+			{REGISTER, "Register service account"},
+			{UNREGISTER, "Unregister service account"},
+		}},
+		{Name: GLOBAL_DEFAULT_CMD, Summary: "Global Defaults operations", Run: GlobalDefaults{}.Execute, Operations: []Operation{
+			{ASSIGN, "Set service account as a global default"},
+			{RESET, "Reset the global default"},
+		}},
+		{Name: VCENTER_CMD, Summary: "vCenter operations", Run: VCenters{}.Execute, Operations: []Operation{
+			{REGISTER, "Register vCenter instance, or the vCenters of a file"},
+			{UNREGISTER, "Remove vCenter instance"},
+			{SYNC_VCENTERS, "Sync vCenter inventory"},
+			{SCAN_VIRTUAL_MACHINES, "Scan for virtual machines managed by a vCenter"},
+			{SCAN_COMPONENTS, "Scan for components running on the virtual machines managed by a vCenter"},
+			{DISCOVER_TOPOLOGY, "Discover topology for the components running on the virtual machines managed by a vCenter"},
+		}},
+		{Name: VRNI_CMD, Summary: "vRNI operations", Run: VRNI{}.Execute, Operations: []Operation{
+			{REGISTER, "Register vRNI instance"},
+			{UNREGISTER, "Remove vRNI instance"},
+			{UPDATE_CREDENTIALS, "Update credentials for the vRNI instance"},
+			{ADD_VCENTERS, "Add vCenters to the vRNI instance"},
+			{REMOVE_VCENTERS, "Remove vCenters from the vRNI instance"},
+		}},
+		{Name: VIRTUAL_MACHINES_CMD, Summary: "Virtual Machines operations", Run: VirtualMachines{}.Execute, Operations: []Operation{
+			{LIST, "List all virtual machines"},
+			{INTROSPECT, "Introspect the virtual machines matching the flags"},
+		}},
+		{Name: COMPONENTS_CMD, Summary: "Components operations", Run: Components{}.Execute, Operations: []Operation{
+			{LIST, "List all components"},
+		}},
+		{Name: APPLICATIONS_CMD, Summary: "Applications operations", Run: Applications{}.Execute, Operations: []Operation{
+			{LIST, "List all applications"},
+		}},
+		{Name: TASKS_CMD, Summary: "Tasks operations", Run: TasksCommand{}.Execute, Operations: []Operation{
+			{LIST, "List tasks"},
+			{GET, "Show the details of a task"},
+			{WATCH, "Wait for a task to finish, showing its progress"},
+			{WAIT, "Wait for one or more tasks to finish"},
+			{CANCEL, "Cancel a running task"},
+		}},
+		{Name: LOGIN_CMD, Summary: "Log in and cache the session", Run: Sessions{}.Execute},
+		{Name: LOGOUT_CMD, Summary: "Log out and remove the cached session", Run: Sessions{}.Execute},
+		{Name: CONFIG_CMD, Summary: "Configuration contexts operations", Run: Contexts{}.Execute, Operations: []Operation{
+			{USE_CONTEXT, "Set the current context"},
+			{GET_CONTEXTS, "List the contexts in the configuration file"},
+			{SET_CONTEXT, "Create or update a context"},
+			{EXPORT, "Export the appliance configuration, without secrets"},
+			{IMPORT, "Recreate an exported configuration on an appliance"},
+		}},
+		{Name: APPLY_CMD, Summary: "Apply a configuration manifest to the appliance", Run: Apply{}.Execute},
+		{Name: COMPLETION_CMD, Summary: "Print the shell completion script", Run: printCompletionScript, Operations: []Operation{
+			{BASH, "Completion script for bash, ex: source <(" + CLI_NAME + " completion bash)"},
+			{ZSH, "Completion script for zsh"},
+			{FISH, "Completion script for fish"},
+			{POWERSHELL, "Completion script for PowerShell"},
+		}},
+		{Name: HELP_CMD, Summary: "Show the usage of a command or operation", Run: help},
+		{Name: COMPLETE_CMD, Run: complete, Hidden: true},
+	}
+}
+
+// Run executes the command named by os.Args. Connection flags given before
+// the command apply to every operation, ex: '-context lab vcenter list'. A
+// mistyped command or operation is reported together with the closest names.
+func Run(commands []Command) {
+	commandTree = commands
+
+	globals, args := splitGlobalFlags(os.Args[1:])
+	if len(args) == 0 {
+		printRootUsage(EXIT_USAGE)
+	}
+
+	command, found := findCommand(args[0])
+	if !found {
+		if isHelp(args[0]) {
+			printRootUsage(EXIT_SUCCESS)
+		}
+		unknown("command", args[0], commandNames(), "")
+	}
+
+	args = args[1:]
+	if len(command.Operations) > 0 {
+		var more []string
+		more, args = splitGlobalFlags(args)
+		globals = append(globals, more...)
+
+		if len(args) == 0 {
+			PrintCommandUsage(command.Name, EXIT_USAGE)
+		}
+		if isHelp(args[0]) {
+			PrintCommandUsage(command.Name, EXIT_SUCCESS)
+		}
+		if _, found := findOperation(command, args[0]); !found {
+			unknown("operation", args[0], operationNames(command), command.Name)
+		}
+
+		os.Args = append([]string{os.Args[0], command.Name, args[0]}, append(globals, args[1:]...)...)
+	} else {
+		os.Args = append([]string{os.Args[0], command.Name}, append(globals, args...)...)
+	}
+
+	command.Run()
+}
+
+// globalFlags returns a flag set with the connection flags accepted before
+// the command. Its values are not used, the flags are passed on to the
+// operation.
+func globalFlags() *flag.FlagSet {
+	flagSet := flag.NewFlagSet(CLI_NAME, flag.ContinueOnError)
+	addConnectionFlags(flagSet)
+	return flagSet
+}
+
+// splitGlobalFlags returns the leading connection flags of args, with their
+// values, and the arguments that follow them.
+func splitGlobalFlags(args []string) (globals []string, rest []string) {
+	flagSet := globalFlags()
+
+	for len(args) > 0 && strings.HasPrefix(args[0], "-") && len(args[0]) > 1 {
+		name := strings.TrimLeft(args[0], "-")
+		if isHelp(args[0]) {
+			break
+		}
+
+		value := strings.Contains(name, "=")
+		name = strings.SplitN(name, "=", 2)[0]
+
+		definition := flagSet.Lookup(name)
+		if definition == nil {
+			fmt.Printf("Unknown global flag %q, it may only be given after the operation\n", args[0])
+			printRootUsage(EXIT_USAGE)
+		}
+
+		count := 2
+		if value || isBoolFlag(definition) {
+			count = 1
+		}
+		if count > len(args) {
+			fmt.Printf("Global flag %q needs a value\n", args[0])
+			os.Exit(EXIT_USAGE)
+		}
+
+		globals = append(globals, args[:count]...)
+		args = args[count:]
+	}
+
+	return globals, args
+}
+
+func isHelp(arg string) bool {
+	switch arg {
+	case "-h", "-help", "--help", HELP_CMD:
+		return true
+	}
+	return false
+}
+
+func findCommand(name string) (Command, bool) {
+	for _, command := range commandTree {
+		if strings.EqualFold(command.Name, name) {
+			return command, true
+		}
+	}
+	return Command{}, false
+}
+
+func findOperation(command Command, name string) (Operation, bool) {
+	for _, operation := range command.Operations {
+		if operation.Name == name {
+			return operation, true
+		}
+	}
+	return Operation{}, false
+}
+
+func commandNames() (names []string) {
+	for _, command := range commandTree {
+		if !command.Hidden {
+			names = append(names, command.Name)
+		}
+	}
+	return names
+}
+
+func operationNames(command Command) (names []string) {
+	for _, operation := range command.Operations {
+		names = append(names, operation.Name)
+	}
+	return names
+}
+
+// unknown reports a mistyped command or operation, with the closest known
+// names, and exits.
+func unknown(kind string, name string, known []string, command string) {
+	fmt.Printf("Unknown %s %q\n", kind, name)
+
+	if suggestions := suggest(name, known); len(suggestions) > 0 {
+		fmt.Println("\nDid you mean this?")
+		for _, suggestion := range suggestions {
+			fmt.Println("  " + strings.TrimSpace(command+" "+suggestion))
+		}
+		fmt.Println()
+	}
+
+	if len(command) > 0 {
+		fmt.Printf("Run '%s %s --help' for the available operations.\n", CLI_NAME, command)
+	} else {
+		fmt.Printf("Run '%s --help' for the available commands.\n", CLI_NAME)
+	}
+	os.Exit(EXIT_USAGE)
+}
+
+// suggest returns the known names within a small edit distance of name, or
+// that start with it, closest first.
+func suggest(name string, known []string) (suggestions []string) {
+	name = strings.ToLower(name)
+	distances := map[string]int{}
+
+	for _, candidate := range known {
+		distance := editDistance(name, strings.ToLower(candidate))
+		if distance <= 2 || (len(name) > 1 && strings.HasPrefix(strings.ToLower(candidate), name)) {
+			suggestions = append(suggestions, candidate)
+			distances[candidate] = distance
+		}
+	}
+
+	sort.SliceStable(suggestions, func(i, j int) bool {
+		return distances[suggestions[i]] < distances[suggestions[j]]
+	})
+	return suggestions
+}
+
+// editDistance returns the Levenshtein distance between a and b.
+func editDistance(a string, b string) int {
+	previous := make([]int, len(b)+1)
+	current := make([]int, len(b)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+
+	for i := 1; i <= len(a); i++ {
+		current[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			current[j] = minInt(previous[j]+1, current[j-1]+1, previous[j-1]+cost)
+		}
+		previous, current = current, previous
+	}
+
+	return previous[len(b)]
+}
+
+func minInt(values ...int) int {
+	min := values[0]
+	for _, value := range values[1:] {
+		if value < min {
+			min = value
+		}
+	}
+	return min
+}
+
+// printRootUsage prints the commands, the global flags and the exit codes, and
+// exits with code.
+func printRootUsage(code int) {
+	fmt.Printf("Usage: '%s [global flags] [command] [operation] [flags]' \n\n", CLI_NAME)
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 4, ' ', 0)
+	fmt.Fprintln(w, "Available Commands:")
+	for _, command := range commandTree {
+		if !command.Hidden {
+			fmt.Fprintf(w, "  %s\t%s\n", command.Name, command.Summary)
+		}
+	}
+	w.Flush()
+
+	fmt.Println("\nGlobal Flags:")
+	flagSet := globalFlags()
+	flagSet.SetOutput(os.Stdout)
+	flagSet.PrintDefaults()
+
+	w = tabwriter.NewWriter(os.Stdout, 0, 0, 4, ' ', 0)
+	fmt.Fprintln(w, "\nExit Codes:")
+	fmt.Fprintf(w, "  %d\t%s\n", EXIT_SUCCESS, "Success")
+	fmt.Fprintf(w, "  %d\t%s\n", EXIT_ERROR, "Unexpected error")
+	fmt.Fprintf(w, "  %d\t%s\n", EXIT_USAGE, "Invalid command, operation or flags")
+	fmt.Fprintf(w, "  %d\t%s\n", EXIT_AUTH, "Authentication failed")
+	fmt.Fprintf(w, "  %d\t%s\n", EXIT_NOT_FOUND, "Resource not found")
+	fmt.Fprintf(w, "  %d\t%s\n", EXIT_CONFLICT, "Resource already exists")
+	fmt.Fprintf(w, "  %d\t%s\n", EXIT_TASK_FAILED, "Task failed")
+	fmt.Fprintf(w, "  %d\t%s\n", EXIT_PARTIAL_SUCCESS, "Task partially succeeded")
+	fmt.Fprintf(w, "  %d\t%s\n", EXIT_TIMEOUT, "Timed out waiting for a task")
+	fmt.Fprintf(w, "  %d\t%s\n", EXIT_INTERRUPTED, "Interrupted at a prompt")
+	w.Flush()
+
+	fmt.Printf("\nRun '%s [command] --help' for the operations of a command.\n", CLI_NAME)
+	os.Exit(code)
+}
+
+// PrintCommandUsage prints the operations of the command and exits with
+// code.
+func PrintCommandUsage(name string, code int) {
+	command, _ := findCommand(name)
+
+	fmt.Printf("Usage: '%s %s [operation] [flags]' \n\n", CLI_NAME, name)
+	if len(command.Summary) > 0 {
+		fmt.Println(command.Summary + "\n")
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 4, ' ', 0)
+	fmt.Fprintln(w, "Available Operations:")
+	for _, operation := range command.Operations {
+		fmt.Fprintf(w, "  %s\t%s\n", operation.Name, operation.Summary)
+	}
+	w.Flush()
+
+	fmt.Printf("\nRun '%s %s [operation] --help' for the flags of an operation.\n", CLI_NAME, name)
+	os.Exit(code)
+}
+
+// NewFlagSet returns the flag set of an operation, or of a command without
+// operations. Its usage, printed by -help and on invalid flags, names the
+// command and describes the operation.
+func NewFlagSet(name string) *flag.FlagSet {
+	flagSet := flag.NewFlagSet(name, flag.ExitOnError)
+	flagSet.SetOutput(os.Stdout)
+
+	flagSet.Usage = func() {
+		if completing {
+			printCandidates("", completedFlag, flagNames(flagSet))
+			return
+		}
+
+		path := name
+		summary := ""
+		if len(os.Args) > 1 {
+			command, _ := findCommand(os.Args[1])
+			summary = command.Summary
+			if !strings.EqualFold(command.Name, name) {
+				path = os.Args[1] + " " + name
+				operation, _ := findOperation(command, name)
+				summary = operation.Summary
+			}
+		}
+
+		fmt.Printf("Usage: '%s %s [flags]' \n", CLI_NAME, path)
+		if len(summary) > 0 {
+			fmt.Println("\n" + summary)
+		}
+		fmt.Println("\nAvailable Flags:")
+		flagSet.PrintDefaults()
+	}
+
+	return flagSet
+}
+
+// help prints the usage of the command or operation given as arguments.
+func help() {
+	args := os.Args[2:]
+	if len(args) == 0 {
+		printRootUsage(EXIT_SUCCESS)
+	}
+
+	command, found := findCommand(args[0])
+	if !found {
+		unknown("command", args[0], commandNames(), "")
+	}
+
+	if len(command.Operations) == 0 || len(args) < 2 {
+		if len(command.Operations) > 0 {
+			PrintCommandUsage(command.Name, EXIT_SUCCESS)
+		}
+		os.Args = []string{os.Args[0], command.Name, "-help"}
+		command.Run()
+		return
+	}
+
+	if _, found := findOperation(command, args[1]); !found {
+		unknown("operation", args[1], operationNames(command), command.Name)
+	}
+
+	os.Args = []string{os.Args[0], command.Name, args[1], "-help"}
+	command.Run()
+}
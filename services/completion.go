@@ -0,0 +1,353 @@
+package services
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"gitlab.eng.vmware.com/vmware-navigator-practice/tooling/tanzu-apptx-cli/render"
+)
+
+// completing is set while __complete runs an operation to list its flags,
+// their usage then prints the flag names starting with completedFlag instead.
+var completing bool
+var completedFlag string
+
+// completionScripts are the scripts printed by the completion command. They
+// call '__complete <words>' with the words typed so far, the last one being
+// completed, and offer the lines it prints. Files are offered when it prints
+// nothing.
+var completionScripts = map[string]string{
+	BASH: `# bash completion for {{CLI}}, load with: source <({{CLI}} completion bash)
+_{{FUNC}}() {
+    local cur words cword
+    if declare -F _get_comp_words_by_ref >/dev/null 2>&1; then
+        _get_comp_words_by_ref -n =: cur words cword
+    else
+        cur="${COMP_WORDS[COMP_CWORD]}"
+        words=("${COMP_WORDS[@]}")
+        cword=$COMP_CWORD
+    fi
+
+    local IFS=$'\n'
+    COMPREPLY=($({{CLI}} {{COMPLETE}} "${words[@]:1:$cword}" 2>/dev/null))
+
+    if declare -F __ltrim_colon_completions >/dev/null 2>&1; then
+        __ltrim_colon_completions "$cur"
+    fi
+    if [ ${#COMPREPLY[@]} -eq 0 ]; then
+        compopt -o default 2>/dev/null
+    fi
+}
+complete -F _{{FUNC}} {{CLI}}
+`,
+	ZSH: `#compdef {{CLI}}
+# zsh completion for {{CLI}}, load with: source <({{CLI}} completion zsh)
+_{{FUNC}}() {
+    local -a candidates
+    candidates=("${(@f)$({{CLI}} {{COMPLETE}} "${(@)words[2,CURRENT]}" 2>/dev/null)}")
+    candidates=(${candidates:#})
+
+    if (( ${#candidates} == 0 )); then
+        _files
+    else
+        compadd -- "${candidates[@]}"
+    fi
+}
+compdef _{{FUNC}} {{CLI}}
+`,
+	FISH: `# fish completion for {{CLI}}, load with: {{CLI}} completion fish | source
+function __{{FUNC}}_complete
+    set -l words (commandline -opc)
+    set -l current (commandline -ct)
+    {{CLI}} {{COMPLETE}} $words[2..-1] "$current" 2>/dev/null
+end
+complete -c {{CLI}} -f -a '(__{{FUNC}}_complete)'
+`,
+	POWERSHELL: `# PowerShell completion for {{CLI}}, load with: {{CLI}} completion powershell | Out-String | Invoke-Expression
+Register-ArgumentCompleter -Native -CommandName '{{CLI}}' -ScriptBlock {
+    param($wordToComplete, $commandAst, $cursorPosition)
+
+    $words = @($commandAst.CommandElements | Select-Object -Skip 1 |
+        Where-Object { $_.Extent.EndOffset -le $cursorPosition } | ForEach-Object { $_.ToString() })
+    if ($wordToComplete -eq '') {
+        $words += '""'
+    }
+
+    & '{{CLI}}' {{COMPLETE}} @words 2>$null | ForEach-Object {
+        [System.Management.Automation.CompletionResult]::new($_, $_, 'ParameterValue', $_)
+    }
+}
+`,
+}
+
+// resourceFlags maps the flags naming a resource to the function listing the
+// names of that resource on the appliance.
+var resourceFlags = map[string]func(client *Client) ([]string, error){
+	"vc-name":   vCenterNames,
+	"vc-names":  vCenterNames,
+	"vc-fqdn":   vCenterFqdns,
+	"vrni-fqdn": vrniFqdns,
+	"vrni-name": vrniAliases,
+	"sa-alias":  serviceAccountAliases,
+	"vm-name":   virtualMachineNames,
+}
+
+// valueFlags maps the flags taking one of a fixed set of values to them.
+var valueFlags = map[string][]string{
+	"output":        {"text", "json"},
+	"output-format": {render.TABLE, render.WIDE, render.JSON, render.CSV, render.YAML, render.NDJSON, render.GO_TEMPLATE + "=", render.JSONPATH + "="},
+	"o":             {render.TABLE, render.WIDE, render.JSON, render.CSV, render.YAML, render.NDJSON, render.GO_TEMPLATE + "=", render.JSONPATH + "="},
+	"format":        {"yaml", "json"},
+}
+
+// printCompletionScript prints the completion script of the shell named by
+// the operation.
+func printCompletionScript() {
+	shell := os.Args[2]
+
+	script := strings.NewReplacer(
+		"{{CLI}}", CLI_NAME,
+		"{{FUNC}}", strings.ReplaceAll(CLI_NAME, "-", "_"),
+		"{{COMPLETE}}", COMPLETE_CMD,
+	).Replace(completionScripts[shell])
+
+	fmt.Print(script)
+}
+
+// complete prints the candidates for the last of the words given as
+// arguments: commands, operations, flags, or the names of the vCenters, vRNI
+// instances, service accounts and virtual machines on the appliance for the
+// flags naming them.
+func complete() {
+	words := os.Args[2:]
+	current := ""
+	if len(words) > 0 {
+		current = words[len(words)-1]
+		words = words[:len(words)-1]
+	}
+	current = strings.Trim(current, `"'`)
+
+	// The names of the command and operation typed so far, ex: vcenter
+	// register, skipping the global flags and their values.
+	var path []string
+	globals := globalFlags()
+	for i := 0; i < len(words); i++ {
+		if !strings.HasPrefix(words[i], "-") {
+			path = append(path, words[i])
+			continue
+		}
+
+		definition := globals.Lookup(strings.TrimLeft(words[i], "-"))
+		if definition != nil && !strings.Contains(words[i], "=") && !isBoolFlag(definition) {
+			i++
+		}
+	}
+
+	if len(path) == 0 && !strings.HasPrefix(current, "-") {
+		printCandidates("", current, commandNames())
+		return
+	}
+	if len(path) == 0 {
+		printCandidates("", current, flagNames(globalFlags()))
+		return
+	}
+
+	command, found := findCommand(path[0])
+	if !found {
+		return
+	}
+
+	if command.Name == HELP_CMD {
+		if len(path) == 1 {
+			printCandidates("", current, commandNames())
+		} else if helped, found := findCommand(path[1]); found && len(path) == 2 {
+			printCandidates("", current, operationNames(helped))
+		}
+		return
+	}
+
+	if len(command.Operations) > 0 && len(path) == 1 && !strings.HasPrefix(current, "-") {
+		printCandidates("", current, operationNames(command))
+		return
+	}
+
+	if command.Name == COMPLETION_CMD {
+		return
+	}
+
+	// The value of a flag, given as '-flag value' or '-flag=value'.
+	flagName, prefix := "", ""
+	if strings.HasPrefix(current, "-") && strings.Contains(current, "=") {
+		parts := strings.SplitN(current, "=", 2)
+		flagName, prefix, current = strings.TrimLeft(parts[0], "-"), parts[0]+"=", parts[1]
+	} else if len(words) > 0 && strings.HasPrefix(words[len(words)-1], "-") && !strings.Contains(words[len(words)-1], "=") {
+		flagName = strings.TrimLeft(words[len(words)-1], "-")
+	}
+
+	if names, known := resourceFlags[flagName]; known {
+		completeResource(words, prefix, current, names)
+		return
+	}
+	if values, known := valueFlags[flagName]; known {
+		printCandidates(prefix, current, values)
+		return
+	}
+	if flagName == "context" {
+		config, _ := LoadConfig()
+		var names []string
+		for _, context := range config.Contexts {
+			names = append(names, context.Name)
+		}
+		printCandidates(prefix, current, names)
+		return
+	}
+
+	if strings.HasPrefix(current, "-") {
+		printOperationFlags(command, path, current)
+	}
+}
+
+// printOperationFlags prints the flags of the operation starting with
+// current. It runs the operation with -help while completing, which makes
+// its usage print the flag names and exit.
+func printOperationFlags(command Command, path []string, current string) {
+	args := []string{os.Args[0], command.Name}
+	if len(command.Operations) > 0 {
+		if _, found := findOperation(command, path[1]); !found {
+			return
+		}
+		args = append(args, path[1])
+	}
+	os.Args = append(args, "-help")
+
+	completing, completedFlag = true, current
+	command.Run()
+}
+
+// completeResource prints the names of a resource on the appliance, using
+// the connection flags typed so far, the environment and the current
+// context. Failures print nothing, so the shell offers no candidates.
+func completeResource(words []string, prefix string, current string, names func(client *Client) ([]string, error)) {
+	// Only the last name of a comma separated list is completed.
+	if index := strings.LastIndex(current, ","); index >= 0 {
+		prefix, current = prefix+current[:index+1], current[index+1:]
+	}
+
+	flagSet := flag.NewFlagSet(COMPLETE_CMD, flag.ContinueOnError)
+	connection := addConnectionFlags(flagSet)
+	flagSet.Parse(knownFlags(flagSet, words))
+	connection.passwordFlags.stdin = false
+
+	// Errors are printed on stdout, where the shell reads the candidates.
+	stdout := os.Stdout
+	os.Stdout, _ = os.Open(os.DevNull)
+	retryOptions.MaxRetries = 0
+
+	url, username, password := connection.resolve()
+	var candidates []string
+	if hasCredentials(url, username, password) {
+		client := authenticate(Request{url, username, password})
+		candidates, _ = names(client)
+	}
+
+	os.Stdout = stdout
+	printCandidates(prefix, current, candidates)
+}
+
+// knownFlags returns the flags of words defined in the flag set, with their
+// values, leaving out the others and the positional arguments.
+func knownFlags(flagSet *flag.FlagSet, words []string) (known []string) {
+	for i := 0; i < len(words); i++ {
+		if !strings.HasPrefix(words[i], "-") {
+			continue
+		}
+
+		name := strings.SplitN(strings.TrimLeft(words[i], "-"), "=", 2)[0]
+		definition := flagSet.Lookup(name)
+		if definition == nil {
+			continue
+		}
+
+		known = append(known, words[i])
+		if !strings.Contains(words[i], "=") && !isBoolFlag(definition) && i+1 < len(words) {
+			i++
+			known = append(known, words[i])
+		}
+	}
+	return known
+}
+
+// isBoolFlag reports whether the flag takes no value, ex: -insecure.
+func isBoolFlag(definition *flag.Flag) bool {
+	boolFlag, ok := definition.Value.(interface{ IsBoolFlag() bool })
+	return ok && boolFlag.IsBoolFlag()
+}
+
+func flagNames(flagSet *flag.FlagSet) (names []string) {
+	flagSet.VisitAll(func(definition *flag.Flag) {
+		names = append(names, "-"+definition.Name)
+	})
+	return names
+}
+
+// printCandidates prints the sorted candidates starting with current, one
+// per line, after prefix, ex: the flag of '-vc-name=vc'.
+func printCandidates(prefix string, current string, candidates []string) {
+	sort.Strings(candidates)
+	for _, candidate := range candidates {
+		if strings.HasPrefix(candidate, current) {
+			fmt.Println(prefix + candidate)
+		}
+	}
+}
+
+func vCenterNames(client *Client) (names []string, err error) {
+	vCenters, err := client.ListVCenters("", "")
+	for _, vCenter := range vCenters.Embedded.VCenters {
+		names = append(names, vCenter.VCName)
+	}
+	return names, err
+}
+
+func vCenterFqdns(client *Client) (names []string, err error) {
+	vCenters, err := client.ListVCenters("", "")
+	for _, vCenter := range vCenters.Embedded.VCenters {
+		names = append(names, vCenter.Fqdn)
+	}
+	return names, err
+}
+
+func vrniFqdns(client *Client) (names []string, err error) {
+	vrnis, err := client.ListVRNIs()
+	for _, vrni := range vrnis {
+		names = append(names, vrni.IP)
+	}
+	return names, err
+}
+
+func vrniAliases(client *Client) (names []string, err error) {
+	vrnis, err := client.ListVRNIs()
+	for _, vrni := range vrnis {
+		names = append(names, vrni.Alias)
+	}
+	return names, err
+}
+
+func serviceAccountAliases(client *Client) (names []string, err error) {
+	serviceAccounts, err := client.ListServiceAccounts("", ListOptions{})
+	for _, serviceAccount := range serviceAccounts.Embedded.ServiceAccounts {
+		names = append(names, serviceAccount.Alias)
+	}
+	return names, err
+}
+
+func virtualMachineNames(client *Client) (names []string, err error) {
+	virtualMachines, err := client.ListVirtualMachines(VirtualMachineFilter{}, ListOptions{})
+	for _, virtualMachine := range virtualMachines.Embedded.VirtualMachinesResponse {
+		names = append(names, virtualMachine.Name)
+	}
+	return names, err
+}
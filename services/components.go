@@ -2,69 +2,74 @@ package services
 
 import (
 	"encoding/json"
-	"flag"
 	"fmt"
+	neturl "net/url"
 	"os"
+	"strconv"
 	"strings"
-	"text/tabwriter"
+
+	"gitlab.eng.vmware.com/vmware-navigator-practice/tooling/tanzu-apptx-cli/filter"
+	"gitlab.eng.vmware.com/vmware-navigator-practice/tooling/tanzu-apptx-cli/render"
 )
 
 type Components struct {
-	url          string
-	username     string
-	password     string
-	outputFormat string
-	operation    string
+	url              string
+	username         string
+	password         string
+	outputFormat     render.Format
+	filterExpression *filter.Expression
+	listOptions      ListOptions
+	operation        string
 }
 
 func (components Components) Execute() {
 	components = components.validate()
 
 	request := Request{components.url, components.username, components.password}
-	authResponse := Authenticate(request)
+	client := authenticate(request)
 
 	switch components.operation {
 	case LIST:
-		list(authResponse.Token, components)
+		list(client, components)
 	default:
 		fmt.Println("Operation not supported")
 		components.printUsage()
-		os.Exit(1)
 	}
 }
 
-func list(token string, components Components) {
-	componentsList := components.list(token)
-
-	if components.outputFormat == "table" {
-		w := tabwriter.NewWriter(os.Stdout, 0, 0, 1, ' ', tabwriter.AlignRight|tabwriter.Debug)
-		fmt.Fprintln(w, "Component Name\tProcess Name\tComponent Type\tVM Name\tVM UUID\tService Type\tIs Containerizable")
-		for _, component := range componentsList.Embedded.Components {
-			fmt.Fprintln(w, component.CompName,
-				"\t", component.ProcessName, "\t", component.Type, "\t", component.VMName,
-				"\t", component.VMUUID, "\t", component.ServiceType, "\t", component.IsContainerizable)
-
-		}
-		w.Flush()
-	} else if components.outputFormat == "json" {
-		prettyJSON, err := json.MarshalIndent(componentsList, "", "    ")
-		if err != nil {
-			fmt.Println("Failed to generate json", err)
-		}
-		fmt.Printf("%s\n", string(prettyJSON))
-	} else if components.outputFormat == "csv" {
-		fmt.Println("Component Name,Process Name,Component Type,VM Name,VM UUID,Service Type,Is Containerizable")
-		for _, component := range componentsList.Embedded.Components {
-			fmt.Println(component.CompName,
-				",", component.ProcessName, ",", component.Type, ",", component.VMName,
-				",", component.VMUUID, ",", component.ServiceType, ",", component.IsContainerizable)
+func list(client *Client, components Components) {
+	componentsList, err := client.ListComponents(fetchOptions(components.filterExpression, components.listOptions))
+	exitOnError("Failed to fetch the list of components", err)
 
+	filtered := componentsList.Embedded.Components[:0]
+	for _, component := range componentsList.Embedded.Components {
+		if matches(components.filterExpression, component) {
+			filtered = append(filtered, component)
 		}
 	}
+	componentsList.Embedded.Components = filtered[:components.listOptions.limit(len(filtered))]
+
+	table := render.Table{Columns: []render.Column{
+		{Header: "Component Name", Key: "compName"},
+		{Header: "Process Name", Key: "processName"},
+		{Header: "Component Type", Key: "type", Wide: true},
+		{Header: "VM Name", Key: "vmName"},
+		{Header: "VM UUID", Key: "vmUUID", Wide: true},
+		{Header: "Service Type", Key: "serviceType"},
+		{Header: "Is Containerizable", Key: "isContainerizable"},
+	}}
+	for _, component := range componentsList.Embedded.Components {
+		table.Rows = append(table.Rows, []string{component.CompName,
+			component.ProcessName, component.Type, component.VMName,
+			component.VMUUID, component.ServiceType, strconv.FormatBool(component.IsContainerizable)})
+	}
+
+	printList(components.outputFormat, render.List{Document: componentsList, Items: componentsList.Embedded.Components, Table: table},
+		len(componentsList.Embedded.Components), componentsList.Pagination, "components")
 }
 
 func (components Components) validate() Components {
-	listCmd := flag.NewFlagSet(LIST, flag.ExitOnError)
+	listCmd := NewFlagSet(LIST)
 
 	if len(os.Args) < 3 {
 		components.printUsage()
@@ -75,54 +80,47 @@ func (components Components) validate() Components {
 	var url string
 	var username string
 	var password string
-	var format string
+	var format render.Format
+	var expression *filter.Expression
+	var listOptions ListOptions
 
 	if operation == LIST {
-		listCmd.StringVar(&url, "fqdn", "", "Application Transformer FQDN / IP, ex: appliance.example.com")
-		listCmd.StringVar(&username, "username", "", "Application Transformer admin username")
-		listCmd.StringVar(&password, "password", "", "Application Transformer admin password")
-		listCmd.StringVar(&format, "output-format", "table", "Output format - (json,csv,table) (Default: table)")
+		connection := addConnectionFlags(listCmd)
+		addFormatFlag(listCmd, &format)
+		addFilterFlag(listCmd, &expression, `isContainerizable && serviceType == "Tomcat" && vmName =~ "^prod-"`)
+		addListFlags(listCmd, &listOptions)
 
 		listCmd.Parse(os.Args[3:])
+		url, username, password = connection.resolve()
 
-		if (len(url) == 0 || len(username) == 0 || len(password) == 0) ||
+		if !hasCredentials(url, username, password) ||
 			(strings.Contains(url, "https://")) {
 			fmt.Printf("Usage: '%s %s %s [flags]' \n", CLI_NAME, COMPONENTS_CMD, LIST)
 			fmt.Println("Available Flags:")
 			listCmd.PrintDefaults()
-			os.Exit(1)
+			os.Exit(EXIT_USAGE)
 		}
 	} else {
 		components.printUsage()
 	}
 
-	components = Components{url, username, password, format, operation}
+	components = Components{url, username, password, format, expression, listOptions, operation}
 	return components
 }
 
 func (components Components) printUsage() {
-	fmt.Printf("Usage: '%s %s [command]' \n", CLI_NAME, COMPONENTS_CMD)
-	fmt.Println("Available Commands:")
-	fmt.Printf("  %s \t\t\t%s \n", LIST, "List all components")
-	os.Exit(1)
+	PrintCommandUsage(COMPONENTS_CMD, EXIT_USAGE)
 }
 
-func (components Components) list(token string) (response ComponentsListResponse) {
-	url := PROTOCOL + "://" + components.url + "/" + PREFIX + "/" + COMPONENTS
-
-	body, responseCode := processRequest(token, url, "GET", nil)
-
-	if responseCode == 200 {
-		fmt.Println("Successfully fetched the list of components \n")
-	} else {
-		fmt.Println("Failed to fetch the list of components. Response code:", responseCode)
-	}
-
-	err := json.Unmarshal(body, &response)
-	if err != nil {
-		fmt.Println("Failed to parse the response body.\n[ERROR] -", err)
-		os.Exit(1)
-	}
-
-	return response
+// ListComponents returns the components discovered on the virtual machines.
+func (client *Client) ListComponents(options ListOptions) (response ComponentsListResponse, err error) {
+	response.Pagination, err = client.paginate(client.discoveryURL(COMPONENTS), neturl.Values{}, options, func(body []byte) (Pagination, int, error) {
+		page := ComponentsListResponse{}
+		err := json.Unmarshal(body, &page)
+		response.Embedded.Components = append(response.Embedded.Components, page.Embedded.Components...)
+		return page.Pagination, len(page.Embedded.Components), err
+	})
+
+	response.Embedded.Components = response.Embedded.Components[:options.limit(len(response.Embedded.Components))]
+	return response, err
 }
@@ -0,0 +1,207 @@
+package services
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Config is the CLI configuration file. It holds named connection contexts
+// so that the appliance FQDN and credentials don't have to be passed on every
+// invocation.
+type Config struct {
+	CurrentContext string    `yaml:"current-context"`
+	Contexts       []Context `yaml:"contexts"`
+}
+
+// Context is a named connection to an Application Transformer appliance.
+type Context struct {
+	Name     string `yaml:"name"`
+	Fqdn     string `yaml:"fqdn"`
+	Username string `yaml:"username,omitempty"`
+	Password string `yaml:"password,omitempty"`
+	CACert   string `yaml:"ca-cert,omitempty"`
+	Insecure bool   `yaml:"insecure,omitempty"`
+	// Proxy is the proxy the appliance is reached through.
+	Proxy string `yaml:"proxy,omitempty"`
+	// CredentialHelper supplies the password, see CredentialHelper.
+	CredentialHelper string `yaml:"credential-helper,omitempty"`
+}
+
+// ConfigPath returns the location of the configuration file,
+// $XDG_CONFIG_HOME/tanzu-apptx-cli/config.yaml or
+// ~/.config/tanzu-apptx-cli/config.yaml.
+func ConfigPath() (string, error) {
+	configHome := os.Getenv("XDG_CONFIG_HOME")
+	if len(configHome) == 0 {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", err
+		}
+		configHome = filepath.Join(home, ".config")
+	}
+
+	return filepath.Join(configHome, CLI_NAME, CONFIG_FILE), nil
+}
+
+// LoadConfig reads the configuration file. A missing file yields an empty
+// configuration.
+func LoadConfig() (config Config, err error) {
+	path, err := ConfigPath()
+	if err != nil {
+		return config, err
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return config, nil
+	} else if err != nil {
+		return config, err
+	}
+
+	if err := yaml.Unmarshal(data, &config); err != nil {
+		return config, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+
+	return config, nil
+}
+
+// Save writes the configuration file, readable only by the current user as
+// it may hold passwords.
+func (config Config) Save() error {
+	path, err := ConfigPath()
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+
+	data, err := yaml.Marshal(config)
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(path, data, 0600)
+}
+
+// Context returns the context with the given name, or the current context
+// when name is empty.
+func (config Config) Context(name string) (context Context, err error) {
+	if len(name) == 0 {
+		name = config.CurrentContext
+	}
+
+	if len(name) == 0 {
+		return context, nil
+	}
+
+	for _, context := range config.Contexts {
+		if context.Name == name {
+			return context, nil
+		}
+	}
+
+	return context, &NotFoundError{Resource: "context", Name: name}
+}
+
+// SetContext adds the context, or replaces the context with the same name.
+func (config *Config) SetContext(context Context) {
+	for i := range config.Contexts {
+		if config.Contexts[i].Name == context.Name {
+			config.Contexts[i] = context
+			return
+		}
+	}
+
+	config.Contexts = append(config.Contexts, context)
+}
+
+// connection holds the appliance flags shared by every operation.
+type connection struct {
+	url              string
+	username         string
+	password         string
+	passwordFlags    *secretFlags
+	credentialHelper string
+	context          string
+	caCert           string
+	insecure         bool
+	proxy            string
+}
+
+// tlsOptions holds the TLS settings resolved for the operation being executed.
+var tlsOptions TLSOptions
+
+// addConnectionFlags registers the appliance and admin credential flags on
+// the flag set.
+func addConnectionFlags(flagSet *flag.FlagSet) *connection {
+	connection := &connection{}
+
+	flagSet.StringVar(&connection.url, "fqdn", "", "Application Transformer FQDN / IP, ex: appliance.example.com (env: "+ENV_FQDN+")")
+	flagSet.StringVar(&connection.username, "username", "", "Application Transformer admin username (env: "+ENV_USERNAME+")")
+	flagSet.StringVar(&connection.password, "password", "", "Application Transformer admin password, visible to other users, prefer the prompt, -password-stdin or a credential helper (env: "+ENV_PASSWORD+")")
+	connection.passwordFlags = addSecretFlags(flagSet, "password", "Application Transformer admin password")
+	flagSet.StringVar(&connection.credentialHelper, "credential-helper", "", "Command run as '<command> get <key>' to print credentials as JSON, ex: key appliance/<fqdn> (env: "+ENV_CREDENTIAL_HELPER+")")
+	flagSet.StringVar(&connection.context, "context", "", "Named context from the configuration file, defaults to the current context. When given, the APPTX_* environment variables are ignored")
+	flagSet.StringVar(&connection.caCert, "ca-cert", "", "PEM bundle of CA certificates trusted in addition to the system trust store")
+	flagSet.BoolVar(&connection.insecure, "insecure", false, "Skip certificate chain verification, certificates are still pinned on first use")
+	flagSet.StringVar(&connection.proxy, "proxy", "", "Proxy the appliance, vCenters and vRNI instances are reached through, ex: http://proxy.example.com:3128 (Default: HTTPS_PROXY and NO_PROXY)")
+	addRequestFlags(flagSet)
+
+	return connection
+}
+
+// resolve fills in the values not given as flags, first from the environment
+// and then from the selected context. A context selected with -context wins
+// over the environment, which is then ignored.
+func (connection *connection) resolve() (url string, username string, password string) {
+	config, err := LoadConfig()
+	exitOnError("Failed to load the configuration file", err)
+
+	context, err := config.Context(connection.context)
+	exitOnError("Failed to load the context", err)
+
+	if len(connection.password) > 0 {
+		fmt.Fprintln(os.Stderr, "WARNING! Using -password on the command line is insecure, use -password-stdin or a credential helper")
+	}
+
+	secret, err := connection.passwordFlags.read()
+	exitOnError("Failed to read the password", err)
+
+	getenv := os.Getenv
+	if len(connection.context) > 0 {
+		getenv = func(string) string { return "" }
+	}
+
+	url = firstNonEmpty(connection.url, getenv(ENV_FQDN), context.Fqdn)
+	username = firstNonEmpty(connection.username, getenv(ENV_USERNAME), context.Username)
+	password = firstNonEmpty(connection.password, secret, getenv(ENV_PASSWORD), context.Password)
+	credentialHelper = CredentialHelper(firstNonEmpty(connection.credentialHelper, getenv(ENV_CREDENTIAL_HELPER), context.CredentialHelper))
+
+	knownHosts, err := KnownHostsPath()
+	exitOnError("Failed to locate the known hosts file", err)
+
+	tlsOptions = TLSOptions{
+		CACertFile:     firstNonEmpty(connection.caCert, context.CACert),
+		Insecure:       connection.insecure || context.Insecure,
+		KnownHostsFile: knownHosts,
+	}
+	transportOptions.Proxy = firstNonEmpty(connection.proxy, context.Proxy)
+
+	return url, username, password
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, value := range values {
+		if len(value) > 0 {
+			return value
+		}
+	}
+	return ""
+}
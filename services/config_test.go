@@ -0,0 +1,29 @@
+package services_test
+
+import (
+	"testing"
+	"time"
+
+	"gitlab.eng.vmware.com/vmware-navigator-practice/tooling/tanzu-apptx-cli/services"
+	"gitlab.eng.vmware.com/vmware-navigator-practice/tooling/tanzu-apptx-cli/simulator"
+)
+
+func TestContextWinsOverEnvironment(t *testing.T) {
+	sim, _ := startSimulator(t, simulator.Options{TaskDuration: 50 * time.Millisecond})
+	home := t.TempDir()
+
+	if output, code := runCLIWith(t, sim, home, nil, services.CONFIG_CMD, services.SET_CONTEXT, "lab",
+		"-fqdn", sim.Address(), "-username", "admin", "-password", "admin"); code != services.EXIT_SUCCESS {
+		t.Fatalf("failed to create the context, got exit code %d:\n%s", code, output)
+	}
+
+	elsewhere := []string{services.ENV_FQDN + "=127.0.0.1:1", services.ENV_PASSWORD + "=wrong"}
+
+	if _, code := runCLIWith(t, sim, home, elsewhere, services.TASKS_CMD, services.LIST, "-context", "lab"); code != services.EXIT_SUCCESS {
+		t.Errorf("expected -context to win over the environment, got exit code %d", code)
+	}
+
+	if _, code := runCLIWith(t, sim, home, elsewhere, services.TASKS_CMD, services.LIST, "-max-retries", "0"); code == services.EXIT_SUCCESS {
+		t.Error("expected the environment to win over the current context")
+	}
+}
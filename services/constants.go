@@ -12,6 +12,7 @@ const (
 	APPLICATIONS     = "applications"
 	COMPONENTS       = "components"
 	SESSION          = "session"
+	REFRESH          = "refresh"
 	SERVICE_ACCOUNTS = "serviceaccounts"
 	QUESTIONS        = "questions"
 	VCENTERS         = "vcenters"
@@ -31,8 +32,54 @@ const (
 	VIRTUAL_MACHINES_CMD = "virtual-machines"
 	APPLICATIONS_CMD     = "applications"
 	COMPONENTS_CMD       = "components"
+	CONFIG_CMD           = "config"
+	LOGIN_CMD            = "login"
+	LOGOUT_CMD           = "logout"
+	TASKS_CMD            = "tasks"
+	SIMULATOR_CMD        = "simulator"
+	APPLY_CMD            = "apply"
+	COMPLETION_CMD       = "completion"
+	HELP_CMD             = "help"
+	COMPLETE_CMD         = "__complete" // Called by the completion scripts
 )
 
+// Shells supported by the completion command
+const (
+	BASH       = "bash"
+	ZSH        = "zsh"
+	FISH       = "fish"
+	POWERSHELL = "powershell"
+)
+
+// Configuration file and environment variables
+const (
+	CONFIG_FILE   = "config.yaml"
+	SESSIONS_FILE = "sessions.yaml"
+
+	KNOWN_HOSTS_FILE = "known_hosts"
+	JOURNALS_DIR     = "journals"
+
+	ENV_FQDN     = "APPTX_FQDN"
+	ENV_USERNAME = "APPTX_USERNAME"
+	ENV_PASSWORD = "APPTX_PASSWORD"
+
+	ENV_CREDENTIAL_HELPER = "APPTX_CREDENTIAL_HELPER"
+)
+
+// Manifest version read by apply, and the service account type whose global
+// default registers the vCenters of a manifest
+const (
+	MANIFEST_VERSION = "apptx.tanzu.vmware.com/v1"
+	VCENTERS_SA_TYPE = "VCs"
+)
+
+// Key prefix of the appliance credentials looked up with a credential helper,
+// the keys of the other secrets start with the name of their command
+const APPLIANCE_KEY = "appliance"
+
+// Replaces the secrets of the requests printed by a dry run
+const REDACTED = "********"
+
 // Operations supported by each command
 const (
 	ASSIGN                = "assign"
@@ -51,4 +98,27 @@ const (
 	SCAN_COMPONENTS       = "scan-components"
 	INTROSPECT            = "introspect"
 	DISCOVER_TOPOLOGY     = "discover-topology"
+	USE_CONTEXT           = "use-context"
+	GET_CONTEXTS          = "get-contexts"
+	SET_CONTEXT           = "set-context"
+	WATCH                 = "watch"
+	WAIT                  = "wait"
+	CANCEL                = "cancel"
+	SERVE                 = "serve"
+	EXPORT                = "export"
+	IMPORT                = "import"
+)
+
+// Exit codes
+const (
+	EXIT_SUCCESS         = 0
+	EXIT_ERROR           = 1 // Any failure not covered below
+	EXIT_USAGE           = 2 // Invalid command, operation or flags
+	EXIT_AUTH            = 3 // Credentials or session rejected
+	EXIT_NOT_FOUND       = 4 // Named resource does not exist
+	EXIT_CONFLICT        = 5 // Resource already exists
+	EXIT_TASK_FAILED     = 6 // Task finished with status FAILED
+	EXIT_PARTIAL_SUCCESS = 7 // Task finished with status PARTIAL_SUCCESS
+	EXIT_TIMEOUT         = 124
+	EXIT_INTERRUPTED     = 130 // Interrupted with Ctrl-C, as by a shell
 )
@@ -0,0 +1,221 @@
+package services
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+)
+
+type Contexts struct {
+	name             string
+	url              string
+	username         string
+	password         string
+	caCert           string
+	insecure         *bool
+	proxy            string
+	file             string
+	format           string
+	credentialHelper string
+	planOnly         bool
+	operation        string
+}
+
+func (contexts Contexts) Execute() {
+	contexts = contexts.validate()
+
+	config, err := LoadConfig()
+	exitOnError("Failed to load the configuration file", err)
+
+	switch contexts.operation {
+	case USE_CONTEXT:
+		_, err := config.Context(contexts.name)
+		exitOnError("Failed to switch context", err)
+
+		config.CurrentContext = contexts.name
+		exitOnError("Failed to save the configuration file", config.Save())
+		fmt.Printf("Switched to context %q\n", contexts.name)
+	case GET_CONTEXTS:
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 1, ' ', tabwriter.AlignRight|tabwriter.Debug)
+		fmt.Fprintln(w, "Current\tName\tFQDN\tUsername")
+		for _, context := range config.Contexts {
+			current := ""
+			if context.Name == config.CurrentContext {
+				current = "*"
+			}
+			fmt.Fprintln(w, current, "\t", context.Name, "\t", context.Fqdn, "\t", context.Username)
+		}
+		w.Flush()
+	case SET_CONTEXT:
+		context, err := config.Context(contexts.name)
+		if err != nil && !IsNotFound(err) {
+			exitOnError("Failed to set context", err)
+		}
+
+		context.Name = contexts.name
+		context.Fqdn = firstNonEmpty(contexts.url, context.Fqdn)
+		context.Username = firstNonEmpty(contexts.username, context.Username)
+		context.Password = firstNonEmpty(contexts.password, context.Password)
+		context.CACert = firstNonEmpty(contexts.caCert, context.CACert)
+		context.CredentialHelper = firstNonEmpty(contexts.credentialHelper, context.CredentialHelper)
+		if contexts.insecure != nil {
+			context.Insecure = *contexts.insecure
+		}
+		context.Proxy = firstNonEmpty(contexts.proxy, context.Proxy)
+
+		config.SetContext(context)
+		if len(config.CurrentContext) == 0 {
+			config.CurrentContext = context.Name
+		}
+
+		exitOnError("Failed to save the configuration file", config.Save())
+		fmt.Printf("Context %q set\n", contexts.name)
+	case EXPORT:
+		client := authenticate(Request{contexts.url, contexts.username, contexts.password})
+
+		manifest, err := client.ExportManifest()
+		exitOnError("Failed to export the configuration", err)
+
+		for _, vCenter := range manifest.VCenters {
+			if len(vCenter.ServiceAccount) == 0 {
+				fmt.Fprintf(os.Stderr, "vCenter %q has no service account, set one before importing\n", vCenter.Name)
+			}
+		}
+
+		err = writeManifest(manifest, contexts.file, exportFormat(contexts.format, contexts.file))
+		exitOnError("Failed to write the configuration", err)
+
+		if len(contexts.file) > 0 && contexts.file != "-" {
+			fmt.Println("Exported the configuration to", contexts.file)
+		}
+	case IMPORT:
+		manifest, err := LoadManifest(contexts.file)
+		exitOnError("Failed to load the configuration", err)
+
+		client := authenticate(Request{contexts.url, contexts.username, contexts.password})
+
+		if !contexts.planOnly && !dryRun {
+			err = client.resolveSecrets(&manifest, secretResolver{credentialHelper})
+			exitOnError("Failed to resolve the secrets of the configuration", err)
+		}
+
+		changes, err := client.plan(manifest, false)
+		exitOnError("Failed to compute the plan", err)
+
+		applyPlan(changes, contexts.planOnly)
+	default:
+		fmt.Println("Operation not supported")
+		contexts.printUsage()
+	}
+}
+
+func (contexts Contexts) validate() Contexts {
+	useContextCmd := NewFlagSet(USE_CONTEXT)
+	getContextsCmd := NewFlagSet(GET_CONTEXTS)
+	setContextCmd := NewFlagSet(SET_CONTEXT)
+	exportCmd := NewFlagSet(EXPORT)
+	importCmd := NewFlagSet(IMPORT)
+
+	if len(os.Args) < 3 {
+		contexts.printUsage()
+	}
+
+	operation := os.Args[2]
+
+	var name string
+	var url string
+	var username string
+	var password string
+	var caCert string
+	var insecure bool
+	var insecureFlag *bool
+	var proxy string
+	var file string
+	var format string
+	var credentialHelper string
+	var planOnly bool
+
+	if operation == USE_CONTEXT {
+		args := parseArgs(useContextCmd, os.Args[3:])
+
+		if len(args) != 1 {
+			fmt.Printf("Usage: '%s %s %s [name]' \n", CLI_NAME, CONFIG_CMD, USE_CONTEXT)
+			os.Exit(EXIT_USAGE)
+		}
+
+		name = args[0]
+	} else if operation == GET_CONTEXTS {
+		getContextsCmd.Parse(os.Args[3:])
+	} else if operation == SET_CONTEXT {
+		setContextCmd.StringVar(&url, "fqdn", "", "Application Transformer FQDN / IP, ex: appliance.example.com")
+		setContextCmd.StringVar(&username, "username", "", "Application Transformer admin username")
+		setContextCmd.StringVar(&password, "password", "", "Application Transformer admin password, stored in clear text, prefer -credential-helper")
+		setContextCmd.StringVar(&credentialHelper, "credential-helper", "", "Command run as '<command> get <key>' to print the credentials as JSON, ex: key appliance/<fqdn>")
+		setContextCmd.StringVar(&caCert, "ca-cert", "", "PEM bundle of CA certificates trusted in addition to the system trust store")
+		setContextCmd.BoolVar(&insecure, "insecure", false, "Skip certificate chain verification, certificates are still pinned on first use")
+		setContextCmd.StringVar(&proxy, "proxy", "", "Proxy the appliance is reached through, ex: http://proxy.example.com:3128")
+
+		args := parseArgs(setContextCmd, os.Args[3:])
+		if len(args) == 1 {
+			name = args[0]
+		}
+
+		setContextCmd.Visit(func(f *flag.Flag) {
+			if f.Name == "insecure" {
+				insecureFlag = &insecure
+			}
+		})
+
+		if len(name) == 0 || (strings.Contains(url, "https://")) {
+			fmt.Printf("Usage: '%s %s %s [name] [flags]' \n", CLI_NAME, CONFIG_CMD, SET_CONTEXT)
+			fmt.Println("Available Flags:")
+			setContextCmd.PrintDefaults()
+			os.Exit(EXIT_USAGE)
+		}
+	} else if operation == EXPORT {
+		connection := addConnectionFlags(exportCmd)
+		exportCmd.StringVar(&file, "f", "", "File to export the configuration to (Default: stdout)")
+		exportCmd.StringVar(&format, "format", "", "Format of the export - (yaml,json) (Default: json for .json files, yaml otherwise)")
+
+		exportCmd.Parse(os.Args[3:])
+		url, username, password = connection.resolve()
+
+		if !hasCredentials(url, username, password) ||
+			(format != "" && format != "yaml" && format != "json") ||
+			(strings.Contains(url, "https://")) {
+			fmt.Printf("Usage: '%s %s %s [flags]' \n", CLI_NAME, CONFIG_CMD, EXPORT)
+			fmt.Println("Available Flags:")
+			exportCmd.PrintDefaults()
+			os.Exit(EXIT_USAGE)
+		}
+	} else if operation == IMPORT {
+		connection := addConnectionFlags(importCmd)
+		addOutputFlags(importCmd)
+		addPollFlags(importCmd)
+		importCmd.StringVar(&file, "f", "", "Exported configuration to import, - reads stdin")
+		importCmd.BoolVar(&planOnly, "plan", false, "Print the plan and exit without making changes")
+
+		importCmd.Parse(os.Args[3:])
+		url, username, password = connection.resolve()
+
+		if !hasCredentials(url, username, password) ||
+			len(file) == 0 ||
+			(strings.Contains(url, "https://")) {
+			fmt.Printf("Usage: '%s %s %s -f [file] [flags]' \n", CLI_NAME, CONFIG_CMD, IMPORT)
+			fmt.Println("Available Flags:")
+			importCmd.PrintDefaults()
+			os.Exit(EXIT_USAGE)
+		}
+	} else {
+		contexts.printUsage()
+	}
+
+	contexts = Contexts{name, url, username, password, caCert, insecureFlag, proxy, file, format, credentialHelper, planOnly, operation}
+	return contexts
+}
+
+func (contexts Contexts) printUsage() {
+	PrintCommandUsage(CONFIG_CMD, EXIT_USAGE)
+}
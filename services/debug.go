@@ -0,0 +1,232 @@
+package services
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Trace levels of -v. TRACE_REQUESTS logs the method, URL, status and latency
+// of every request, TRACE_BODIES adds the headers and the bodies.
+const (
+	TRACE_OFF      = 0
+	TRACE_REQUESTS = 1
+	TRACE_BODIES   = 2
+)
+
+// traceLevel holds the -v and -debug flags of the operation being executed.
+var traceLevel verbosity
+
+// verbosity is the value of -v. It is a boolean flag, so '-v' alone sets
+// TRACE_REQUESTS, while '-v=2' sets a level.
+type verbosity int
+
+func (level *verbosity) String() string {
+	if level == nil {
+		return "0"
+	}
+	return strconv.Itoa(int(*level))
+}
+
+func (level *verbosity) Set(value string) error {
+	switch value {
+	case "true":
+		*level = TRACE_REQUESTS
+		return nil
+	case "false":
+		*level = TRACE_OFF
+		return nil
+	}
+
+	number, err := strconv.Atoi(value)
+	if err != nil || number < TRACE_OFF || number > TRACE_BODIES {
+		return fmt.Errorf("expected a level from %d to %d", TRACE_OFF, TRACE_BODIES)
+	}
+
+	*level = verbosity(number)
+	return nil
+}
+
+func (level *verbosity) IsBoolFlag() bool {
+	return true
+}
+
+// debugFlag is the value of -debug, a shorthand for -v=2.
+type debugFlag struct {
+	level *verbosity
+}
+
+func (debug debugFlag) String() string {
+	return "false"
+}
+
+func (debug debugFlag) Set(value string) error {
+	enabled, err := strconv.ParseBool(value)
+	if err != nil {
+		return err
+	}
+
+	if enabled {
+		*debug.level = TRACE_BODIES
+	}
+	return nil
+}
+
+func (debug debugFlag) IsBoolFlag() bool {
+	return true
+}
+
+// SetTrace makes the client log its HTTP requests and responses to out, with
+// the passwords, tokens and session cookies redacted. level is one of
+// TRACE_OFF, TRACE_REQUESTS and TRACE_BODIES.
+func (client *Client) SetTrace(out io.Writer, level int) {
+	client.tracer = nil
+	if out != nil && level > TRACE_OFF {
+		client.tracer = &tracer{out: out, level: level}
+	}
+	client.httpClient = client.getHTTPSClient()
+}
+
+// tracer logs the requests sent through a transport.
+type tracer struct {
+	out   io.Writer
+	level int
+	mutex sync.Mutex
+}
+
+// tracingTransport is the transport of a client with a tracer.
+type tracingTransport struct {
+	next   http.RoundTripper
+	tracer *tracer
+}
+
+func (transport *tracingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	var requestBody []byte
+	if req.Body != nil && transport.tracer.level >= TRACE_BODIES {
+		var err error
+		requestBody, err = ioutil.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		req.Body = ioutil.NopCloser(bytes.NewReader(requestBody))
+	}
+
+	start := time.Now()
+	resp, err := transport.next.RoundTrip(req)
+	latency := time.Since(start).Round(100 * time.Microsecond)
+
+	var responseBody []byte
+	if err == nil && transport.tracer.level >= TRACE_BODIES {
+		responseBody, err = ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			// A RoundTripper returns either a response or an error.
+			resp = nil
+		} else {
+			resp.Body = ioutil.NopCloser(bytes.NewReader(responseBody))
+		}
+	}
+
+	transport.tracer.print(req, requestBody, resp, responseBody, latency, err)
+	return resp, err
+}
+
+// print logs a request and its response, or the error that prevented it.
+func (tracer *tracer) print(req *http.Request, requestBody []byte, resp *http.Response, responseBody []byte, latency time.Duration, err error) {
+	var buffer bytes.Buffer
+
+	if err != nil {
+		fmt.Fprintf(&buffer, "%s %s failed after %s: %v\n", req.Method, req.URL, latency, err)
+	} else {
+		fmt.Fprintf(&buffer, "%s %s %s (%s)\n", req.Method, req.URL, resp.Status, latency)
+	}
+
+	if tracer.level >= TRACE_BODIES {
+		printHeaders(&buffer, "> ", req.Header)
+		printBody(&buffer, "> ", requestBody)
+		if resp != nil {
+			fmt.Fprintf(&buffer, "< %s %s\n", resp.Proto, resp.Status)
+			printHeaders(&buffer, "< ", resp.Header)
+			printBody(&buffer, "< ", responseBody)
+		}
+	}
+
+	tracer.mutex.Lock()
+	defer tracer.mutex.Unlock()
+	tracer.out.Write(buffer.Bytes())
+}
+
+// printHeaders prints the headers sorted by name, redacting the credentials
+// and the session cookies.
+func printHeaders(buffer *bytes.Buffer, prefix string, header http.Header) {
+	names := make([]string, 0, len(header))
+	for name := range header {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		for _, value := range header[name] {
+			fmt.Fprintf(buffer, "%s%s: %s\n", prefix, name, redactHeader(name, value))
+		}
+	}
+}
+
+func redactHeader(name string, value string) string {
+	switch strings.ToLower(name) {
+	case "authorization":
+		if fields := strings.Fields(value); len(fields) > 1 {
+			return fields[0] + " " + REDACTED
+		}
+		return REDACTED
+	case "cookie", "set-cookie":
+		var cookies []string
+		for _, cookie := range strings.Split(value, ";") {
+			parts := strings.SplitN(strings.TrimSpace(cookie), "=", 2)
+			if len(parts) == 2 && strings.EqualFold(parts[0], AUTH_TOKEN) {
+				cookie = parts[0] + "=" + REDACTED
+			}
+			cookies = append(cookies, strings.TrimSpace(cookie))
+		}
+		return strings.Join(cookies, "; ")
+	}
+	return value
+}
+
+// printBody prints a JSON body indented with its secrets redacted, and any
+// other body as is.
+func printBody(buffer *bytes.Buffer, prefix string, body []byte) {
+	if len(body) == 0 {
+		return
+	}
+
+	var decoded interface{}
+	if err := json.Unmarshal(body, &decoded); err == nil {
+		if indented, err := json.MarshalIndent(redact(decoded), "", "    "); err == nil {
+			body = indented
+		}
+	}
+
+	for _, line := range strings.Split(strings.TrimRight(string(body), "\n"), "\n") {
+		fmt.Fprintln(buffer, prefix+line)
+	}
+}
+
+// traceOutput returns where the requests are traced, stderr so that the
+// output of the operation is left untouched.
+func traceOutput() io.Writer {
+	if traceLevel == TRACE_OFF {
+		return nil
+	}
+	return os.Stderr
+}
@@ -0,0 +1,57 @@
+package services_test
+
+import (
+	"bytes"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"gitlab.eng.vmware.com/vmware-navigator-practice/tooling/tanzu-apptx-cli/services"
+)
+
+// TestTraceTruncatedBody checks that a response whose body cannot be read is
+// traced and reported as an error rather than returned with it, which
+// net/http logs as a broken RoundTripper.
+func TestTraceTruncatedBody(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Length", "100")
+		w.WriteHeader(200)
+		w.Write([]byte(`{"id":`))
+		w.(http.Flusher).Flush()
+
+		connection, _, err := w.(http.Hijacker).Hijack()
+		if err == nil {
+			connection.Close()
+		}
+	}))
+	defer server.Close()
+
+	client, err := services.NewClient(services.Request{URL: strings.TrimPrefix(server.URL, "https://")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := client.SetTLSOptions(services.TLSOptions{Insecure: true}); err != nil {
+		t.Fatal(err)
+	}
+	client.SetRetryOptions(services.RetryOptions{})
+
+	trace := bytes.Buffer{}
+	client.SetTrace(&trace, services.TRACE_BODIES)
+
+	logged := bytes.Buffer{}
+	log.SetOutput(&logged)
+	defer log.SetOutput(os.Stderr)
+
+	if _, err := client.GetTask("task-1"); err == nil || !strings.Contains(err.Error(), "unexpected EOF") {
+		t.Errorf("expected the truncated body to be reported, got %v", err)
+	}
+	if !strings.Contains(trace.String(), "failed after") {
+		t.Errorf("expected the failure to be traced, got:\n%s", trace.String())
+	}
+	if logged.Len() > 0 {
+		t.Errorf("expected nothing logged, got %s", logged.String())
+	}
+}
@@ -0,0 +1,139 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+)
+
+// ErrDryRun is returned instead of the response of a request that would
+// change the appliance when the client is in dry-run mode. The request is
+// printed, not sent.
+var ErrDryRun = errors.New("dry run, the request was not sent")
+
+// dryRun holds the -dry-run flag of the operation being executed.
+var dryRun bool
+
+// SetDryRun makes the client print the requests that would change the
+// appliance to out, with their secrets redacted, and return ErrDryRun instead
+// of sending them. GET requests are still sent, so names are resolved to
+// UUIDs as usual. A nil out turns dry-run mode off.
+func (client *Client) SetDryRun(out io.Writer) {
+	client.dryRun = out
+}
+
+// dryRunOutput returns where a dry run prints the requests, stderr with
+// -output json, which is left to the results.
+func dryRunOutput() io.Writer {
+	if !dryRun {
+		return nil
+	}
+	if outputMode == "json" {
+		return os.Stderr
+	}
+	return os.Stdout
+}
+
+// printRequest prints the method, URL and indented body of a request that is
+// not sent.
+func (client *Client) printRequest(method string, url string, payload interface{}) error {
+	fmt.Fprintln(client.dryRun, method, url)
+
+	if payload == nil {
+		return nil
+	}
+
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("failed to parse the request payload: %w", err)
+	}
+
+	var body interface{}
+	if err := json.Unmarshal(data, &body); err != nil {
+		return err
+	}
+
+	data, err = json.MarshalIndent(redact(body), "", "    ")
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintln(client.dryRun, string(data))
+	return nil
+}
+
+// redact replaces the passwords, tokens, session cookies and other secrets of
+// a decoded JSON body.
+func redact(value interface{}) interface{} {
+	switch value := value.(type) {
+	case map[string]interface{}:
+		for key, field := range value {
+			name := strings.ToLower(key)
+			if field != "" && (strings.Contains(name, "password") || strings.Contains(name, "token") ||
+				strings.Contains(name, "secret") || strings.Contains(name, "cookie")) {
+				value[key] = REDACTED
+			} else {
+				value[key] = redact(field)
+			}
+		}
+	case []interface{}:
+		for i, item := range value {
+			value[i] = redact(item)
+		}
+	}
+	return value
+}
+
+// printMembershipDiff prints the vCenters a dry run would add to and remove
+// from the vRNI instance, by name.
+func (client *Client) printMembershipDiff(vrniResponse VRNIResponse, vCenterUUIDs []string) error {
+	vCenters, err := client.ListVCenters("", "")
+	if err != nil {
+		return err
+	}
+
+	names := map[string]string{}
+	for _, vCenter := range vCenters.Embedded.VCenters {
+		names[vCenter.VCenterUUID] = vCenter.VCName
+	}
+
+	current := map[string]bool{}
+	for _, vCenter := range vrniResponse.VCenters {
+		current[vCenter.VCenterUUID] = true
+		names[vCenter.VCenterUUID] = vCenter.VCName
+	}
+
+	wanted := map[string]bool{}
+	for _, vCenterUUID := range vCenterUUIDs {
+		wanted[vCenterUUID] = true
+	}
+
+	var lines []string
+	for vCenterUUID := range wanted {
+		if !current[vCenterUUID] {
+			lines = append(lines, fmt.Sprintf("  + %s (%s)", names[vCenterUUID], vCenterUUID))
+		}
+	}
+	for vCenterUUID := range current {
+		if !wanted[vCenterUUID] {
+			lines = append(lines, fmt.Sprintf("  - %s (%s)", names[vCenterUUID], vCenterUUID))
+		}
+	}
+	sort.Slice(lines, func(i, j int) bool {
+		return lines[i][4:] < lines[j][4:]
+	})
+
+	fmt.Fprintf(client.dryRun, "vCenters of vRNI %s:\n", vrniResponse.IP)
+	if len(lines) == 0 {
+		fmt.Fprintln(client.dryRun, "  no changes")
+	}
+	for _, line := range lines {
+		fmt.Fprintln(client.dryRun, line)
+	}
+
+	return nil
+}
@@ -0,0 +1,149 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// APIError is returned when Application Transformer responds with a status
+// code the client did not expect.
+type APIError struct {
+	Method     string
+	URL        string
+	StatusCode int
+	Body       []byte
+}
+
+func (err *APIError) Error() string {
+	message := fmt.Sprintf("%s %s returned an unexpected response. Response Code: %d", err.Method, err.URL, err.StatusCode)
+	if serverMessage := err.Message(); len(serverMessage) > 0 {
+		message += ", Message: " + serverMessage
+	}
+	return message
+}
+
+// Message returns the error message of the response body, ex: the message
+// field of {"status": 409, "message": "..."}, or the body itself when it is a
+// short text. It is empty when the body holds no message.
+func (err *APIError) Message() string {
+	var body map[string]interface{}
+	if json.Unmarshal(err.Body, &body) == nil {
+		for _, key := range []string{"message", "errorMessage", "error_description", "error", "detail"} {
+			if message, ok := body[key].(string); ok && len(message) > 0 {
+				return message
+			}
+		}
+
+		if items, ok := body["errors"].([]interface{}); ok {
+			var messages []string
+			for _, item := range items {
+				if item, ok := item.(map[string]interface{}); ok {
+					if message, ok := item["message"].(string); ok && len(message) > 0 {
+						messages = append(messages, message)
+					}
+				}
+			}
+			return strings.Join(messages, "; ")
+		}
+		return ""
+	}
+
+	text := strings.TrimSpace(string(err.Body))
+	if len(text) > 0 && len(text) <= 200 && !strings.HasPrefix(text, "<") && !strings.ContainsAny(text, "\n{[") {
+		return text
+	}
+	return ""
+}
+
+// AuthError is returned when the appliance rejects the credentials or the
+// session token.
+type AuthError struct {
+	Err error
+}
+
+func (err *AuthError) Error() string {
+	return "authentication failed: " + err.Err.Error()
+}
+
+func (err *AuthError) Unwrap() error {
+	return err.Err
+}
+
+// NotFoundError is returned when a named resource does not exist, or when no
+// resource matches Filter.
+type NotFoundError struct {
+	Resource string
+	Name     string
+	Filter   string
+}
+
+func (err *NotFoundError) Error() string {
+	if len(err.Name) == 0 && len(err.Filter) > 0 {
+		return fmt.Sprintf("no %s matches %s", strings.ToLower(err.Resource), err.Filter)
+	}
+	return fmt.Sprintf("%s %q does not exist", err.Resource, err.Name)
+}
+
+// AlreadyExistsError is returned when creating a resource that is already
+// registered.
+type AlreadyExistsError struct {
+	Resource string
+	Name     string
+}
+
+func (err *AlreadyExistsError) Error() string {
+	return fmt.Sprintf("%s %q already exists", err.Resource, err.Name)
+}
+
+// TaskError is returned when an asynchronous task finishes with a status other
+// than SUCCESS.
+type TaskError struct {
+	TaskID string
+	Status string
+}
+
+func (err *TaskError) Error() string {
+	return fmt.Sprintf("task %s finished with status %s", err.TaskID, err.Status)
+}
+
+// TaskTimeoutError is returned when a task is still running after the
+// monitoring timeout.
+type TaskTimeoutError struct {
+	TaskID  string
+	Status  string
+	Timeout time.Duration
+}
+
+func (err *TaskTimeoutError) Error() string {
+	return fmt.Sprintf("task %s is still %s after %s", err.TaskID, err.Status, err.Timeout)
+}
+
+// CertificateMismatchError is returned when a host presents a certificate
+// other than the one recorded in the known hosts file.
+type CertificateMismatchError struct {
+	Host           string
+	Expected       string
+	Actual         string
+	KnownHostsFile string
+}
+
+func (err *CertificateMismatchError) Error() string {
+	return fmt.Sprintf("the certificate presented by %s has changed (expected SHA256 %s, got %s); remove the entry from %s if the change is expected",
+		err.Host, err.Expected, err.Actual, err.KnownHostsFile)
+}
+
+// IsNotFound reports whether err, or any error it wraps, is a *NotFoundError.
+func IsNotFound(err error) bool {
+	var notFound *NotFoundError
+	return errors.As(err, &notFound)
+}
+
+// IsAlreadyExists reports whether err, or any error it wraps, is an
+// *AlreadyExistsError.
+func IsAlreadyExists(err error) bool {
+	var alreadyExists *AlreadyExistsError
+	return errors.As(err, &alreadyExists)
+}
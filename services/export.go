@@ -0,0 +1,176 @@
+package services
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ExportManifest returns the configuration of the appliance as a manifest,
+// without the service account passwords and vRNI API tokens, which cannot be
+// read back. vCenters are exported with the VCs global default as their
+// service account, the one they were registered with is not reported.
+func (client *Client) ExportManifest() (manifest Manifest, err error) {
+	manifest.APIVersion = MANIFEST_VERSION
+
+	serviceAccounts, err := client.ListServiceAccounts("", ListOptions{})
+	if err != nil {
+		return manifest, err
+	}
+
+	for _, serviceAccount := range serviceAccounts.Embedded.ServiceAccounts {
+		manifest.ServiceAccounts = append(manifest.ServiceAccounts, ServiceAccountManifest{Alias: serviceAccount.Alias, Username: serviceAccount.Username})
+	}
+	sort.Slice(manifest.ServiceAccounts, func(i, j int) bool {
+		return manifest.ServiceAccounts[i].Alias < manifest.ServiceAccounts[j].Alias
+	})
+
+	globalDefaults, err := client.ListGlobalDefaults()
+	if err != nil && !IsNotFound(err) {
+		return manifest, err
+	}
+
+	for saType, serviceAccount := range globalDefaults {
+		if manifest.GlobalDefaults == nil {
+			manifest.GlobalDefaults = map[string]string{}
+		}
+		manifest.GlobalDefaults[saType] = serviceAccount.Alias
+	}
+
+	vCenters, err := client.ListVCenters("", "")
+	if err != nil {
+		return manifest, err
+	}
+
+	for _, vCenter := range vCenters.Embedded.VCenters {
+		manifest.VCenters = append(manifest.VCenters, VCenterManifest{Name: vCenter.VCName, Fqdn: vCenter.Fqdn,
+			ServiceAccount: manifest.GlobalDefaults[VCENTERS_SA_TYPE]})
+	}
+	sort.Slice(manifest.VCenters, func(i, j int) bool {
+		return manifest.VCenters[i].Name < manifest.VCenters[j].Name
+	})
+
+	vrnis, err := client.ListVRNIs()
+	if err != nil {
+		return manifest, err
+	}
+
+	for _, vrniResponse := range vrnis {
+		vrni := VRNIManifest{Fqdn: vrniResponse.IP, Alias: vrniResponse.Alias, SaaS: vrniResponse.IsSaaS}
+		if !vrniResponse.IsSaaS {
+			vrni.ServiceAccount = vrniResponse.ServiceAccount.Alias
+			vrni.ServiceAccountType = vrniResponse.ServiceAccountType
+		}
+		for _, vCenter := range vrniResponse.VCenters {
+			vrni.VCenters = append(vrni.VCenters, vCenter.VCName)
+		}
+		sort.Strings(vrni.VCenters)
+		manifest.VRNIs = append(manifest.VRNIs, vrni)
+	}
+	sort.Slice(manifest.VRNIs, func(i, j int) bool {
+		return manifest.VRNIs[i].Fqdn < manifest.VRNIs[j].Fqdn
+	})
+
+	return manifest, nil
+}
+
+// writeManifest writes the manifest as YAML, or as JSON when format is json,
+// to path, or to stdout when path is empty or "-".
+func writeManifest(manifest Manifest, path string, format string) error {
+	var data []byte
+	var err error
+
+	if format == "json" {
+		data, err = json.MarshalIndent(manifest, "", "    ")
+		data = append(data, '\n')
+	} else {
+		buffer := bytes.Buffer{}
+		encoder := yaml.NewEncoder(&buffer)
+		encoder.SetIndent(2)
+		err = encoder.Encode(manifest)
+		data = buffer.Bytes()
+	}
+	if err != nil {
+		return err
+	}
+
+	if len(path) == 0 || path == "-" {
+		_, err = os.Stdout.Write(data)
+		return err
+	}
+
+	return ioutil.WriteFile(path, data, 0644)
+}
+
+// exportFormat returns the format of an export, the one given or else the
+// one of the file extension.
+func exportFormat(format string, path string) string {
+	if len(format) > 0 {
+		return format
+	}
+
+	if strings.EqualFold(filepath.Ext(path), ".json") {
+		return "json"
+	}
+	return "yaml"
+}
+
+// resolveSecrets fills in the passwords of the service accounts and the API
+// tokens of the SaaS vRNI instances the manifest creates or replaces, as they
+// are left out of exports. The secrets of resources already on the appliance
+// are not asked for.
+func (client *Client) resolveSecrets(manifest *Manifest, resolver secretResolver) error {
+	serviceAccounts, err := client.ListServiceAccounts("", ListOptions{})
+	if err != nil {
+		return err
+	}
+
+	usernames := map[string]string{}
+	for _, serviceAccount := range serviceAccounts.Embedded.ServiceAccounts {
+		usernames[serviceAccount.Alias] = serviceAccount.Username
+	}
+
+	for i, serviceAccount := range manifest.ServiceAccounts {
+		if len(serviceAccount.Password) > 0 || usernames[serviceAccount.Alias] == serviceAccount.Username {
+			continue
+		}
+
+		password, err := resolver.resolve(SERVICE_ACCOUNT_CMD+"/"+serviceAccount.Alias,
+			fmt.Sprintf("password of service account %q (%s)", serviceAccount.Alias, serviceAccount.Username))
+		if err != nil {
+			return err
+		}
+		manifest.ServiceAccounts[i].Password = password
+	}
+
+	vrnis, err := client.ListVRNIs()
+	if err != nil {
+		return err
+	}
+
+	registered := map[string]bool{}
+	for _, vrniResponse := range vrnis {
+		registered[vrniResponse.IP] = true
+	}
+
+	for i, vrni := range manifest.VRNIs {
+		if !vrni.SaaS || len(vrni.APIToken) > 0 || registered[vrni.Fqdn] {
+			continue
+		}
+
+		apiToken, err := resolver.resolve(VRNI_CMD+"/"+vrni.Fqdn, fmt.Sprintf("API token of SaaS vRNI %q", vrni.Fqdn))
+		if err != nil {
+			return err
+		}
+		manifest.VRNIs[i].APIToken = apiToken
+	}
+
+	return nil
+}
@@ -0,0 +1,55 @@
+package services
+
+import (
+	"flag"
+	"strings"
+
+	"gitlab.eng.vmware.com/vmware-navigator-practice/tooling/tanzu-apptx-cli/filter"
+)
+
+// addFilterFlag registers the -filter flag of list operations. Invalid
+// expressions are rejected while parsing.
+func addFilterFlag(flagSet *flag.FlagSet, expression **filter.Expression, example string) {
+	flagSet.Func("filter", "Only list the items matching the expression, ex: "+example, func(value string) (err error) {
+		*expression, err = filter.Parse(value)
+		return err
+	})
+}
+
+// fetchOptions returns the options to fetch a filtered list with. The limit
+// is applied once the items are filtered, so every page is read.
+func fetchOptions(expression *filter.Expression, options ListOptions) ListOptions {
+	if expression != nil {
+		options.Limit = 0
+	}
+	return options
+}
+
+// matches reports whether the item satisfies the expression. Every item
+// matches when no filter was given.
+func matches(expression *filter.Expression, item interface{}) bool {
+	if expression == nil {
+		return true
+	}
+
+	matched, err := expression.Match(item)
+	exitOnError("Failed to filter the list", err)
+	return matched
+}
+
+// pushDown copies the field == "value" conditions of the expression on the
+// given fields into the query parameters, unless a flag already set them.
+// The expression is still evaluated on the items returned.
+func pushDown(expression *filter.Expression, fields map[string]*string) {
+	if expression == nil {
+		return
+	}
+
+	for name, value := range expression.Equalities() {
+		for field, parameter := range fields {
+			if strings.EqualFold(name, field) && len(*parameter) == 0 {
+				*parameter = value
+			}
+		}
+	}
+}
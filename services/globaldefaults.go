@@ -1,7 +1,6 @@
 package services
 
 import (
-	"flag"
 	"fmt"
 	"os"
 	"strings"
@@ -20,23 +19,24 @@ func (globalDefaults GlobalDefaults) Execute() {
 	globalDefaults = globalDefaults.validate()
 
 	request := Request{globalDefaults.url, globalDefaults.username, globalDefaults.password}
-	authResponse := Authenticate(request)
+	client := authenticate(request)
 
 	switch globalDefaults.operation {
 	case ASSIGN:
-		globalDefaults.assign(authResponse.Token, request)
+		err := client.AssignGlobalDefault(globalDefaults.saType, globalDefaults.saAlias)
+		report(globalDefaults.saType, err, "Failed to assign the service credential to the global default", "Successfully assigned the service credential to the global default")
 	case RESET:
-		globalDefaults.reset(authResponse.Token)
+		err := client.ResetGlobalDefault(globalDefaults.saType)
+		report(globalDefaults.saType, err, "Failed to reset the global default", "Successfully reset the global default")
 	default:
 		fmt.Println("Operation not supported")
 		globalDefaults.printUsage()
-		os.Exit(1)
 	}
 }
 
 func (globalDefaults GlobalDefaults) validate() GlobalDefaults {
-	assignCmd := flag.NewFlagSet(ASSIGN, flag.ExitOnError)
-	resetCmd := flag.NewFlagSet(RESET, flag.ExitOnError)
+	assignCmd := NewFlagSet(ASSIGN)
+	resetCmd := NewFlagSet(RESET)
 
 	if len(os.Args) < 3 {
 		globalDefaults.printUsage()
@@ -51,37 +51,37 @@ func (globalDefaults GlobalDefaults) validate() GlobalDefaults {
 	var saType string
 
 	if operation == ASSIGN {
-		assignCmd.StringVar(&url, "fqdn", "", "Application Transformer FQDN / IP, ex: appliance.example.com")
-		assignCmd.StringVar(&username, "username", "", "Application Transformer admin username")
-		assignCmd.StringVar(&password, "password", "", "Application Transformer admin password")
+		connection := addConnectionFlags(assignCmd)
+		addOutputFlags(assignCmd)
 		assignCmd.StringVar(&saType, "service-account-type", "", "service account type, ex: VCs, VRNIs, LINUX_VMs")
 		assignCmd.StringVar(&saAlias, "sa-alias", "", "service account alias")
 
 		assignCmd.Parse(os.Args[3:])
+		url, username, password = connection.resolve()
 
-		if (len(url) == 0 || len(username) == 0 || len(password) == 0) ||
+		if !hasCredentials(url, username, password) ||
 			(len(saType) == 0 || len(saAlias) == 0) ||
 			(strings.Contains(url, "https://")) {
 			fmt.Printf("Usage: '%s %s %s [flags]' \n", CLI_NAME, GLOBAL_DEFAULT_CMD, ASSIGN)
 			fmt.Println("Available Flags:")
 			assignCmd.PrintDefaults()
-			os.Exit(1)
+			os.Exit(EXIT_USAGE)
 		}
 	} else if operation == RESET {
-		resetCmd.StringVar(&url, "fqdn", "", "Application Transformer FQDN / IP, ex: appliance.example.com")
-		resetCmd.StringVar(&username, "username", "", "Application Transformer admin username")
-		resetCmd.StringVar(&password, "password", "", "Application Transformer admin password")
+		connection := addConnectionFlags(resetCmd)
+		addOutputFlags(resetCmd)
 		resetCmd.StringVar(&saType, "service-account-type", "", "service account type, ex: VCs, VRNIs, LINUX_VMs")
 
 		resetCmd.Parse(os.Args[3:])
+		url, username, password = connection.resolve()
 
-		if (len(url) == 0 || len(username) == 0 || len(password) == 0) ||
+		if !hasCredentials(url, username, password) ||
 			(len(saType) == 0) ||
 			(strings.Contains(url, "https://")) {
 			fmt.Printf("Usage: '%s %s %s [flags]' \n", CLI_NAME, GLOBAL_DEFAULT_CMD, RESET)
 			fmt.Println("Available Flags:")
 			resetCmd.PrintDefaults()
-			os.Exit(1)
+			os.Exit(EXIT_USAGE)
 		}
 	} else {
 		globalDefaults.printUsage()
@@ -92,48 +92,33 @@ func (globalDefaults GlobalDefaults) validate() GlobalDefaults {
 }
 
 func (globalDefaults GlobalDefaults) printUsage() {
-	fmt.Printf("Usage: '%s %s [command]' \n", CLI_NAME, GLOBAL_DEFAULT_CMD)
-	fmt.Println("Available Commands:")
-	fmt.Printf("  %s \t\t\t%s \n", ASSIGN, "Set service account as a global default")
-	fmt.Printf("  %s \t\t\t%s \n", RESET, "Reset the global default")
-	os.Exit(1)
+	PrintCommandUsage(GLOBAL_DEFAULT_CMD, EXIT_USAGE)
 }
 
-func (globalDefaults GlobalDefaults) assign(token string, request Request) {
-	serviceAccounts := ServiceAccounts{}
-	response := serviceAccounts.findServiceAccount(globalDefaults.saAlias, token, request)
-
-	if len(response.Embedded.ServiceAccounts) > 0 {
-
-		for _, serviceAccount := range response.Embedded.ServiceAccounts {
-			if serviceAccount.Alias == globalDefaults.saAlias {
-				url := PROTOCOL + "://" + request.URL + "/" + PREFIX + "/" + SERVICE_ACCOUNTS + "/defaults/" + globalDefaults.saType
-
-				request := GlobalDefaultRequest{serviceAccount.UUID}
-				_, responseCode := processRequest(token, url, "POST", request)
+// AssignGlobalDefault makes the service account registered under alias the
+// global default for saType, ex: VCs, VRNIs, LINUX_VMs.
+func (client *Client) AssignGlobalDefault(saType string, alias string) error {
+	serviceAccount, err := client.FindServiceAccount(alias)
+	if err != nil {
+		return err
+	}
 
-				if responseCode == 200 {
-					fmt.Println("Successfully assigned the service credential to the global default")
-				} else {
-					fmt.Println("Failed to assign the service credential to the global default. Response code:", responseCode)
-				}
-			} else {
-				fmt.Println("Cannot complete the operation as the Service Account does not exist")
-			}
-		}
+	url := client.discoveryURL(SERVICE_ACCOUNTS, "defaults", saType)
+	request := GlobalDefaultRequest{serviceAccount.UUID}
 
-	} else {
-		fmt.Println("Cannot complete the operation as the Service Account does not exist")
-	}
+	return client.expect("POST", url, request, nil, 200)
 }
 
-func (globalDefaults GlobalDefaults) reset(token string) {
-	url := PROTOCOL + "://" + globalDefaults.url + "/" + PREFIX + "/" + SERVICE_ACCOUNTS + "/defaults/" + globalDefaults.saType
-	_, responseCode := processRequest(token, url, "DELETE", nil)
+// ResetGlobalDefault clears the global default service account for saType.
+func (client *Client) ResetGlobalDefault(saType string) error {
+	url := client.discoveryURL(SERVICE_ACCOUNTS, "defaults", saType)
+	return client.expect("DELETE", url, nil, nil, 200)
+}
 
-	if responseCode == 200 {
-		fmt.Println("Successfully reset the global default")
-	} else {
-		fmt.Println("Failed to reset the global default. Response code:", responseCode)
-	}
+// ListGlobalDefaults returns the global default service account of each
+// service account type that has one, keyed by type.
+func (client *Client) ListGlobalDefaults() (defaults map[string]ServiceAccount, err error) {
+	url := client.discoveryURL(SERVICE_ACCOUNTS, "defaults")
+	err = client.expect("GET", url, nil, &defaults, 200)
+	return defaults, err
 }
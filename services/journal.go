@@ -0,0 +1,282 @@
+package services
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// journalPath and resumePath hold the -journal and -resume flags of the batch
+// operation being executed.
+var journalPath string
+var resumePath string
+
+// addJournalFlags registers the flags of the batch operations that keep a
+// journal.
+func addJournalFlags(flagSet *flag.FlagSet) {
+	flagSet.StringVar(&journalPath, "journal", "", "File recording the submitted tasks and the completed targets (Default: with several targets, a new file in the journals directory next to the configuration file, removed once all of them succeed)")
+	flagSet.StringVar(&resumePath, "resume", "", "Journal of an interrupted run of the same operation, the targets that succeeded are skipped and the tasks still running are waited for")
+}
+
+// JournalEntry is the state of a target of a batch operation. Step names the
+// task of the target, ex: register or sync, and Status is SUBMITTED until the
+// task finishes.
+type JournalEntry struct {
+	Target string    `json:"target"`
+	Step   string    `json:"step,omitempty"`
+	TaskID string    `json:"taskId,omitempty"`
+	Status string    `json:"status"`
+	Error  string    `json:"error,omitempty"`
+	Time   time.Time `json:"time"`
+}
+
+// running reports whether the task of the entry may still be running: it was
+// submitted, or the run stopped waiting for it.
+func (entry JournalEntry) running() bool {
+	return len(entry.TaskID) > 0 && (entry.Status == "SUBMITTED" || entry.Status == "TIMEOUT")
+}
+
+// journalHeader is the first line of a journal. Targets lists the targets of
+// the run, so that it is only resumed over the same ones.
+type journalHeader struct {
+	Operation string    `json:"operation"`
+	Targets   []string  `json:"targets"`
+	Started   time.Time `json:"started"`
+}
+
+// Journal records the progress of a batch operation in a file, one JSON line
+// per change, so that an interrupted run can be resumed. Each line is synced
+// to disk before the operation goes on.
+type Journal struct {
+	path    string
+	file    *os.File
+	entries map[string]JournalEntry
+	mutex   sync.Mutex
+
+	// temporary is set for the journals of the journals directory, which are
+	// removed once every target succeeded.
+	temporary bool
+}
+
+// CreateJournal starts a journal of the operation over the targets in a new
+// file at path.
+func CreateJournal(path string, operation string, targets []string) (*Journal, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return nil, err
+	}
+
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return nil, err
+	}
+
+	journal := &Journal{path: path, file: file, entries: map[string]JournalEntry{}}
+	if err := journal.write(journalHeader{Operation: operation, Targets: sortedTargets(targets), Started: time.Now()}); err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	return journal, nil
+}
+
+// OpenJournal loads the journal of an interrupted run of the operation over
+// the same targets and appends to it. A last line cut short by the
+// interruption is ignored.
+func OpenJournal(path string, operation string, targets []string) (*Journal, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	lines := bytes.Split(data, []byte("\n"))
+
+	header := journalHeader{}
+	if err := json.Unmarshal(lines[0], &header); err != nil || len(header.Operation) == 0 {
+		return nil, fmt.Errorf("%s is not a journal", path)
+	}
+	if header.Operation != operation {
+		return nil, fmt.Errorf("%s is the journal of '%s', not of '%s'", path, header.Operation, operation)
+	}
+	if strings.Join(header.Targets, "\n") != strings.Join(sortedTargets(targets), "\n") {
+		return nil, fmt.Errorf("%s is the journal of a run over other targets, resume it with the flags or the file of that run", path)
+	}
+
+	journal := &Journal{path: path, entries: map[string]JournalEntry{}}
+	for _, line := range lines[1:] {
+		entry := JournalEntry{}
+		if err := json.Unmarshal(line, &entry); err != nil || len(entry.Target) == 0 {
+			continue
+		}
+		journal.entries[entry.Target] = entry
+	}
+
+	journal.file, err = os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return nil, err
+	}
+
+	// The next line must not be appended to a line cut short.
+	if len(data) > 0 && data[len(data)-1] != '\n' {
+		if _, err := journal.file.Write([]byte("\n")); err != nil {
+			journal.file.Close()
+			return nil, fmt.Errorf("failed to write the journal %s: %w", path, err)
+		}
+	}
+
+	return journal, nil
+}
+
+// Path returns the file of the journal.
+func (journal *Journal) Path() string {
+	return journal.path
+}
+
+// Entry returns the last state recorded for the target.
+func (journal *Journal) Entry(target string) (entry JournalEntry, found bool) {
+	journal.mutex.Lock()
+	defer journal.mutex.Unlock()
+
+	entry, found = journal.entries[target]
+	return entry, found
+}
+
+// Record appends the state of a target to the journal.
+func (journal *Journal) Record(entry JournalEntry) error {
+	journal.mutex.Lock()
+	defer journal.mutex.Unlock()
+
+	if entry.Time.IsZero() {
+		entry.Time = time.Now()
+	}
+
+	journal.entries[entry.Target] = entry
+	return journal.write(entry)
+}
+
+func (journal *Journal) write(line interface{}) error {
+	data, err := json.Marshal(line)
+	if err != nil {
+		return err
+	}
+
+	if _, err := journal.file.Write(append(data, '\n')); err != nil {
+		return fmt.Errorf("failed to write the journal %s: %w", journal.path, err)
+	}
+
+	return journal.file.Sync()
+}
+
+// Close closes the file of the journal.
+func (journal *Journal) Close() error {
+	return journal.file.Close()
+}
+
+// sortedTargets returns a sorted copy of the targets, in the order they are
+// recorded.
+func sortedTargets(targets []string) []string {
+	sorted := append([]string{}, targets...)
+	sort.Strings(sorted)
+	return sorted
+}
+
+// JournalsDir returns the directory of the journals created by default,
+// next to the configuration file.
+func JournalsDir() (string, error) {
+	path, err := ConfigPath()
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(filepath.Dir(path), JOURNALS_DIR), nil
+}
+
+// openJournal returns the journal of the batch operation being executed over
+// the targets: the journal of -resume, the file of -journal or, when there
+// are several targets, a new file in JournalsDir. No journal is kept in
+// dry-run mode.
+func openJournal(targets []string) *Journal {
+	if dryRun {
+		return nil
+	}
+
+	operation := operationName()
+
+	if len(resumePath) > 0 {
+		journal, err := OpenJournal(resumePath, operation, targets)
+		exitOnError("Failed to open the journal", err)
+		dir, err := JournalsDir()
+		journal.temporary = err == nil && filepath.Dir(filepath.Clean(resumePath)) == dir
+		fmt.Fprintf(os.Stderr, "Resuming from the journal %s\n", journal.Path())
+		return journal
+	}
+
+	path := journalPath
+	if len(path) == 0 {
+		if len(targets) < 2 {
+			return nil
+		}
+		dir, err := JournalsDir()
+		exitOnError("Failed to locate the journals directory", err)
+		// Runs started in the same second by other processes must not
+		// collide, hence the microseconds and the process ID.
+		name := fmt.Sprintf("%s-%s-%d.jsonl", strings.ReplaceAll(operation, " ", "-"), time.Now().Format("20060102-150405.000000"), os.Getpid())
+		path = filepath.Join(dir, name)
+	}
+
+	journal, err := CreateJournal(path, operation, targets)
+	exitOnError("Failed to create the journal", err)
+	journal.temporary = len(journalPath) == 0
+	fmt.Fprintf(os.Stderr, "Recording the progress in %s, resume an interrupted run with -resume %s\n", path, path)
+	return journal
+}
+
+// finish closes the journal, when there is one, and removes a journal of the
+// journals directory once every target succeeded as there is nothing left to
+// resume.
+func (journal *Journal) finish(succeeded bool) {
+	if journal == nil {
+		return
+	}
+
+	journal.Close()
+
+	if succeeded && journal.temporary {
+		if err := os.Remove(journal.path); err != nil {
+			fmt.Fprintln(os.Stderr, "Failed to remove the journal.\n[ERROR] -", err)
+		}
+	}
+}
+
+// record appends the state of a target to the journal, when there is one. A
+// journal that cannot be written is reported but does not stop the batch.
+func (journal *Journal) record(target string, step string, taskID string, status string, err error) {
+	if journal == nil {
+		return
+	}
+
+	entry := JournalEntry{Target: target, Step: step, TaskID: taskID, Status: status}
+	if err != nil {
+		entry.Error = err.Error()
+	}
+
+	if err := journal.Record(entry); err != nil {
+		fmt.Fprintln(os.Stderr, "Failed to record the progress.\n[ERROR] -", err)
+	}
+}
+
+// resumable returns the state recorded for the target by an interrupted run,
+// when there is a journal.
+func (journal *Journal) resumable(target string) (JournalEntry, bool) {
+	if journal == nil {
+		return JournalEntry{}, false
+	}
+	return journal.Entry(target)
+}
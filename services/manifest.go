@@ -0,0 +1,216 @@
+package services
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"regexp"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Manifest describes the configuration of an appliance: its service
+// accounts, global defaults, vCenters and vRNI instances. It is the format
+// read by apply.
+type Manifest struct {
+	APIVersion      string                   `yaml:"apiVersion" json:"apiVersion"`
+	ServiceAccounts []ServiceAccountManifest `yaml:"serviceAccounts,omitempty" json:"serviceAccounts,omitempty"`
+	// GlobalDefaults maps a service account type, ex: VCs, to the alias of
+	// its default service account.
+	GlobalDefaults map[string]string `yaml:"globalDefaults,omitempty" json:"globalDefaults,omitempty"`
+	VCenters       []VCenterManifest `yaml:"vcenters,omitempty" json:"vcenters,omitempty"`
+	VRNIs          []VRNIManifest    `yaml:"vrnis,omitempty" json:"vrnis,omitempty"`
+}
+
+// ServiceAccountManifest describes a service account. Passwords cannot be
+// read back from the appliance, so they are only sent when the service
+// account is created.
+type ServiceAccountManifest struct {
+	Alias    string `yaml:"alias" json:"alias"`
+	Username string `yaml:"username" json:"username"`
+	Password string `yaml:"password,omitempty" json:"password,omitempty"`
+}
+
+// VCenterManifest describes a vCenter registration. The service account,
+// the VCs global default of the manifest when empty, is only used to register
+// the vCenter, it cannot be read back to be compared.
+type VCenterManifest struct {
+	Name           string `yaml:"name" json:"name"`
+	Fqdn           string `yaml:"fqdn" json:"fqdn"`
+	ServiceAccount string `yaml:"serviceAccount,omitempty" json:"serviceAccount,omitempty"`
+	// ScanScope limits the virtual machine scan run once the vCenter is
+	// registered. Without it the vCenter is not scanned.
+	ScanScope *ScanScope `yaml:"scanScope,omitempty" json:"scanScope,omitempty"`
+}
+
+// ScanScope names the datacenter, and optionally the clusters and folders in
+// it, whose virtual machines are scanned. An empty scope scans the whole
+// vCenter.
+type ScanScope struct {
+	DataCenter string   `yaml:"dataCenter,omitempty" json:"dataCenter,omitempty"`
+	Clusters   []string `yaml:"clusters,omitempty" json:"clusters,omitempty"`
+	Folders    []string `yaml:"folders,omitempty" json:"folders,omitempty"`
+}
+
+// VRNIManifest describes a vRNI registration and the vCenters it monitors.
+// SaaS instances authenticate with APIToken, on-premises instances with
+// ServiceAccount of type ServiceAccountType.
+type VRNIManifest struct {
+	Fqdn               string   `yaml:"fqdn" json:"fqdn"`
+	Alias              string   `yaml:"alias" json:"alias"`
+	SaaS               bool     `yaml:"saas,omitempty" json:"saas,omitempty"`
+	APIToken           string   `yaml:"apiToken,omitempty" json:"apiToken,omitempty"`
+	ServiceAccount     string   `yaml:"serviceAccount,omitempty" json:"serviceAccount,omitempty"`
+	ServiceAccountType string   `yaml:"serviceAccountType,omitempty" json:"serviceAccountType,omitempty"`
+	VCenters           []string `yaml:"vcenters,omitempty" json:"vcenters,omitempty"`
+}
+
+// filters returns the scope in the form taken by the scan request.
+func (scope ScanScope) filters() (filters Datacenter) {
+	filters.Name = scope.DataCenter
+
+	for _, cluster := range scope.Clusters {
+		filters.Clusters = append(filters.Clusters, Cluster{Name: cluster})
+	}
+
+	for _, folder := range scope.Folders {
+		filters.Folders = append(filters.Folders, InventoryItem{Name: folder})
+	}
+
+	return filters
+}
+
+// vCenterServiceAccount returns the alias of the service account the vCenter
+// is registered with.
+func (manifest Manifest) vCenterServiceAccount(vCenter VCenterManifest) string {
+	return firstNonEmpty(vCenter.ServiceAccount, manifest.GlobalDefaults[VCENTERS_SA_TYPE])
+}
+
+// variablePattern matches the ${NAME} references expanded by LoadManifest.
+var variablePattern = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)\}`)
+
+// LoadManifest reads a YAML or JSON manifest from path, or from stdin when
+// path is "-". ${NAME} references in the values of the manifest are replaced
+// by the environment variable NAME, so that secrets can be kept out of the
+// file. They are replaced once the manifest is parsed, so that the variables
+// can hold any text. Unknown fields and undefined variables are rejected.
+func LoadManifest(path string) (manifest Manifest, err error) {
+	var data []byte
+	if path == "-" {
+		data, err = ioutil.ReadAll(os.Stdin)
+	} else {
+		data, err = ioutil.ReadFile(path)
+	}
+	if err != nil {
+		return manifest, err
+	}
+
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(&manifest); err != nil {
+		return manifest, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+
+	var undefined []string
+	expandVariables(reflect.ValueOf(&manifest).Elem(), func(text string) string {
+		return variablePattern.ReplaceAllStringFunc(text, func(reference string) string {
+			name := variablePattern.FindStringSubmatch(reference)[1]
+			value, found := os.LookupEnv(name)
+			if !found {
+				undefined = append(undefined, name)
+			}
+			return value
+		})
+	})
+
+	if len(undefined) > 0 {
+		return manifest, fmt.Errorf("%s refers to undefined environment variables %v", path, undefined)
+	}
+
+	return manifest, manifest.validate()
+}
+
+// expandVariables replaces the strings held by value, and by the structs,
+// pointers, slices and maps it holds, with expand of them.
+func expandVariables(value reflect.Value, expand func(string) string) {
+	switch value.Kind() {
+	case reflect.String:
+		value.SetString(expand(value.String()))
+	case reflect.Ptr:
+		if !value.IsNil() {
+			expandVariables(value.Elem(), expand)
+		}
+	case reflect.Struct:
+		for i := 0; i < value.NumField(); i++ {
+			expandVariables(value.Field(i), expand)
+		}
+	case reflect.Slice:
+		for i := 0; i < value.Len(); i++ {
+			expandVariables(value.Index(i), expand)
+		}
+	case reflect.Map:
+		for _, key := range value.MapKeys() {
+			element := reflect.New(value.Type().Elem()).Elem()
+			element.Set(value.MapIndex(key))
+			expandVariables(element, expand)
+			value.SetMapIndex(key, element)
+		}
+	}
+}
+
+// validate checks the version of the manifest, its required fields and that
+// no resource is described twice.
+func (manifest Manifest) validate() error {
+	if manifest.APIVersion != MANIFEST_VERSION {
+		return fmt.Errorf("unsupported apiVersion %q, expected %s", manifest.APIVersion, MANIFEST_VERSION)
+	}
+
+	seen := map[string]bool{}
+	unique := func(resource string, name string) error {
+		if len(name) == 0 {
+			return fmt.Errorf("a %s is missing its name", resource)
+		}
+		if seen[resource+"/"+name] {
+			return fmt.Errorf("%s %q is described more than once", resource, name)
+		}
+		seen[resource+"/"+name] = true
+		return nil
+	}
+
+	for _, serviceAccount := range manifest.ServiceAccounts {
+		if err := unique("Service Account", serviceAccount.Alias); err != nil {
+			return err
+		}
+		if len(serviceAccount.Username) == 0 {
+			return fmt.Errorf("Service Account %q is missing its username", serviceAccount.Alias)
+		}
+	}
+
+	for saType, alias := range manifest.GlobalDefaults {
+		if len(alias) == 0 {
+			return fmt.Errorf("Global Default %q is missing its service account", saType)
+		}
+	}
+
+	for _, vCenter := range manifest.VCenters {
+		if err := unique("vCenter", vCenter.Name); err != nil {
+			return err
+		}
+		if len(vCenter.Fqdn) == 0 || len(manifest.vCenterServiceAccount(vCenter)) == 0 {
+			return fmt.Errorf("vCenter %q needs an fqdn and a serviceAccount, or a %s global default", vCenter.Name, VCENTERS_SA_TYPE)
+		}
+	}
+
+	for _, vrni := range manifest.VRNIs {
+		if err := unique("vRNI", vrni.Fqdn); err != nil {
+			return err
+		}
+		if !vrni.SaaS && len(vrni.ServiceAccount) == 0 {
+			return fmt.Errorf("vRNI %q needs a serviceAccount, or saas and an apiToken", vrni.Fqdn)
+		}
+	}
+
+	return nil
+}
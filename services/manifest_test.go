@@ -0,0 +1,66 @@
+package services_test
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"gitlab.eng.vmware.com/vmware-navigator-practice/tooling/tanzu-apptx-cli/services"
+)
+
+func TestLoadManifestVariables(t *testing.T) {
+	secrets := map[string]string{
+		"comment":  "p@ss #1",
+		"mapping":  "user: admin",
+		"quotes":   `it's "quoted"`,
+		"newline":  "first\nsecond",
+		"brackets": "[a, {b}]",
+	}
+
+	for name, secret := range secrets {
+		t.Run(name, func(t *testing.T) {
+			t.Setenv("APPTX_TEST_SECRET", secret)
+			t.Setenv("APPTX_TEST_FQDN", "vrni.example.com")
+
+			path := filepath.Join(t.TempDir(), "manifest.yaml")
+			manifest := "" +
+				"apiVersion: " + services.MANIFEST_VERSION + "\n" +
+				"serviceAccounts:\n" +
+				"  - alias: vc-admin\n" +
+				"    username: administrator@vsphere.local\n" +
+				"    password: ${APPTX_TEST_SECRET}\n" +
+				"vrnis:\n" +
+				"  - fqdn: ${APPTX_TEST_FQDN}\n" +
+				"    alias: vrni\n" +
+				"    saas: true\n" +
+				"    apiToken: \"token-${APPTX_TEST_SECRET}\"\n"
+			if err := ioutil.WriteFile(path, []byte(manifest), 0600); err != nil {
+				t.Fatal(err)
+			}
+
+			loaded, err := services.LoadManifest(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if password := loaded.ServiceAccounts[0].Password; password != secret {
+				t.Errorf("expected the password %q, got %q", secret, password)
+			}
+			if token := loaded.VRNIs[0].APIToken; token != "token-"+secret {
+				t.Errorf("expected the token %q, got %q", "token-"+secret, token)
+			}
+			if fqdn := loaded.VRNIs[0].Fqdn; fqdn != "vrni.example.com" {
+				t.Errorf("expected the fqdn vrni.example.com, got %q", fqdn)
+			}
+		})
+	}
+
+	path := filepath.Join(t.TempDir(), "manifest.yaml")
+	manifest := "apiVersion: " + services.MANIFEST_VERSION + "\nglobalDefaults:\n  VCs: ${APPTX_TEST_UNDEFINED}\n"
+	if err := ioutil.WriteFile(path, []byte(manifest), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := services.LoadManifest(path); err == nil || !strings.Contains(err.Error(), "APPTX_TEST_UNDEFINED") {
+		t.Errorf("expected the undefined variable to be reported, got %v", err)
+	}
+}
@@ -1,5 +1,11 @@
 package services
 
+import (
+	"encoding/json"
+	"strconv"
+	"time"
+)
+
 type Request struct {
 	URL      string
 	Username string
@@ -27,7 +33,7 @@ type ApplicationsListResponse struct {
 					VMName            string `json:"vmName"`
 					VMUUID            string `json:"vmUUID"`
 					Type              string `json:"type"`
-					ProcessName       string `json:"processName`
+					ProcessName       string `json:"processName"`
 					IsContainerizable bool   `json:"isContainerizable"`
 					ServiceType       string `json:"serviceType"`
 					CompName          string `json:"compName"`
@@ -35,6 +41,7 @@ type ApplicationsListResponse struct {
 			} `json:"componentsGroupedByVMs"`
 		} `json:"applications"`
 	} `json:"_embedded"`
+	Pagination
 }
 
 type ComponentsListResponse struct {
@@ -44,7 +51,7 @@ type ComponentsListResponse struct {
 			VMName            string `json:"vmName"`
 			VMUUID            string `json:"vmUUID"`
 			Type              string `json:"type"`
-			ProcessName       string `json:"processName`
+			ProcessName       string `json:"processName"`
 			IsContainerizable bool   `json:"isContainerizable"`
 			ServiceType       string `json:"serviceType"`
 			CompName          string `json:"compName"`
@@ -52,6 +59,7 @@ type ComponentsListResponse struct {
 			LastIntrospect    string `json:"lastIntrospect"`
 		} `json:"components"`
 	} `json:"_embedded"`
+	Pagination
 }
 
 type GlobalDefaultRequest struct {
@@ -64,20 +72,17 @@ type serviceAccountRequest struct {
 	Alias    string `json:"alias"`
 }
 
-type serviceAccount struct {
+type ServiceAccount struct {
 	UUID     string `json:"uuid"`
 	Alias    string `json:"alias"`
 	Username string `json:"username"`
 }
 
-type response struct {
+type ServiceAccountListResponse struct {
 	Embedded struct {
-		ServiceAccounts []struct {
-			UUID     string `json:"uuid"`
-			Alias    string `json:"alias"`
-			Username string `json:"username"`
-		} `json:"serviceAccounts"`
+		ServiceAccounts []ServiceAccount `json:"serviceAccounts"`
 	} `json:"_embedded"`
+	Pagination
 }
 
 type VCenterRequest struct {
@@ -95,30 +100,32 @@ type VCenter struct {
 }
 
 type Datacenter struct {
-	ModID    string `json:"modId"`
-	Name     string `json:"name"`
-	Type     string `json:"type"`
-	Clusters []struct {
-		ModID         string `json:"modId"`
-		Name          string `json:"name"`
-		Type          string `json:"type"`
-		ResourcePools []struct {
-			ModID string `json:"modId"`
-			Name  string `json:"name"`
-			Type  string `json:"type"`
-		} `json:"resourcePools"`
-	} `json:"clusters"`
-	Folders []struct {
-		ModID string `json:"modId"`
-		Name  string `json:"name"`
-		Type  string `json:"type"`
-	} `json:"folders"`
+	ModID    string          `json:"modId"`
+	Name     string          `json:"name"`
+	Type     string          `json:"type"`
+	Clusters []Cluster       `json:"clusters"`
+	Folders  []InventoryItem `json:"folders"`
+}
+
+type Cluster struct {
+	ModID         string          `json:"modId"`
+	Name          string          `json:"name"`
+	Type          string          `json:"type"`
+	ResourcePools []InventoryItem `json:"resourcePools"`
+}
+
+// InventoryItem is a resource pool or folder of a vCenter inventory.
+type InventoryItem struct {
+	ModID string `json:"modId"`
+	Name  string `json:"name"`
+	Type  string `json:"type"`
 }
 
 type VCenterListResponse struct {
 	Embedded struct {
 		VCenters []VCenter `json:"vcenters"`
 	} `json:"_embedded"`
+	Pagination
 }
 
 type VCenterScanVMRequest struct {
@@ -145,16 +152,29 @@ type VirtualMachinesResponse struct {
 	VcenterFqdn  string   `json:"vcenterFqdn"`
 	DataCenter   string   `json:"dataCenter"`
 	Cluster      string   `json:"cluster"`
-	ResourcePool string   `json:"resourcePool'`
+	ResourcePool string   `json:"resourcePool"`
 	Folder       string   `json:"folder"`
 	NumOfDisks   int      `json:"numOfDisks"`
 	SizeOfDisks  string   `json:"sizeOfDisks"`
 }
 
+// VirtualMachineFilter narrows the virtual machines returned by
+// ListVirtualMachines. Empty fields are ignored.
+type VirtualMachineFilter struct {
+	VCenterFqdn  string
+	Datacenter   string
+	Cluster      string
+	ResourcePool string
+	Folder       string
+	Name         string
+	IP           string
+}
+
 type VirtualMachinesListResponse struct {
 	Embedded struct {
 		VirtualMachinesResponse []VirtualMachinesResponse `json:"virtualmachines"`
 	} `json:"_embedded"`
+	Pagination
 }
 
 type VRNIRequest struct {
@@ -168,13 +188,26 @@ type VRNIRequest struct {
 	ServiceAccountType    string   `json:"vrniType"`
 }
 
+// VRNIRegistration describes a vRNI instance to register. SaaS instances
+// authenticate with APIToken, on-premises instances with the service account
+// SAAlias of type SAType.
+type VRNIRegistration struct {
+	Alias    string
+	Fqdn     string
+	VCNames  []string
+	SAAlias  string
+	SAType   string
+	IsSaaS   bool
+	APIToken string
+}
+
 type VRNIResponse struct {
 	Alias              string `json:"alias"`
 	Id                 string `json:"id"`
 	IP                 string `json:"ip"`
 	ServiceAccountType string `json:"vrniType"`
-	IsSaaS             bool   `json:"isSaaS`
-	ApiToken           string `json:"apiToken`
+	IsSaaS             bool   `json:"isSaaS"`
+	ApiToken           string `json:"apiToken"`
 	VCenters           []struct {
 		Fqdn        string `json:"fqdn"`
 		VCenterUUID string `json:"irisVcenterUUID"`
@@ -185,3 +218,67 @@ type VRNIResponse struct {
 		Alias string `json:"alias"`
 	} `json:"serviceAccount"`
 }
+
+// Timestamp is a point in time sent either as epoch milliseconds or as an
+// RFC 3339 string.
+type Timestamp struct {
+	time.Time
+}
+
+func (timestamp *Timestamp) UnmarshalJSON(data []byte) error {
+	if string(data) == "null" {
+		return nil
+	}
+
+	if millis, err := strconv.ParseInt(string(data), 10, 64); err == nil {
+		timestamp.Time = time.Unix(0, millis*int64(time.Millisecond))
+		return nil
+	}
+
+	var value string
+	if err := json.Unmarshal(data, &value); err != nil {
+		return err
+	}
+
+	if len(value) == 0 {
+		return nil
+	}
+
+	parsed, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return err
+	}
+
+	timestamp.Time = parsed
+	return nil
+}
+
+func (timestamp Timestamp) MarshalJSON() ([]byte, error) {
+	if timestamp.IsZero() {
+		return []byte("null"), nil
+	}
+	return json.Marshal(timestamp.Time.Format(time.RFC3339))
+}
+
+func (timestamp Timestamp) String() string {
+	if timestamp.IsZero() {
+		return ""
+	}
+	return timestamp.Local().Format("2006-01-02 15:04:05")
+}
+
+type TaskListResponse struct {
+	Embedded struct {
+		Tasks []TaskResponse `json:"tasks"`
+	} `json:"_embedded"`
+	Pagination
+}
+
+// TaskFilter narrows the tasks returned by ListTasks. Empty fields are
+// ignored.
+type TaskFilter struct {
+	Status string
+	Type   string
+	// MaxAge drops tasks created longer ago than the duration.
+	MaxAge time.Duration
+}
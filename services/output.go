@@ -0,0 +1,49 @@
+package services
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"gitlab.eng.vmware.com/vmware-navigator-practice/tooling/tanzu-apptx-cli/render"
+)
+
+// addFormatFlag registers the output format and table view flags of list
+// operations. Unknown formats are rejected while parsing.
+func addFormatFlag(flagSet *flag.FlagSet, format *render.Format) {
+	*format = render.Format{Name: render.TABLE}
+	flagSet.Var(format, "output-format", "Output format - ("+strings.Join(render.Formats, ",")+")")
+	flagSet.Var(format, "o", "Shorthand for -output-format")
+	flagSet.Func("columns", "Comma separated list of the columns to print, ex: name,ip,cluster (Default: all columns of the view)", func(value string) error {
+		format.Columns = strings.Split(value, ",")
+		return nil
+	})
+	flagSet.StringVar(&format.SortBy, "sort-by", "", "Column to sort the rows by, numeric columns are sorted by value, ex: memoryMB")
+	flagSet.BoolVar(&format.Reverse, "reverse", false, "Reverse the order of the rows")
+	flagSet.BoolVar(&format.NoHeaders, "no-headers", false, "Do not print the column headers")
+}
+
+// printList prints the list of resources in the chosen format. Tables with
+// headers are preceded by a status line and followed by the number of
+// resources shown out of the total reported by the appliance, which would
+// break the other formats.
+func printList(format render.Format, list render.List, shown int, pagination Pagination, resource string) {
+	if err := format.Validate(list.Table); err != nil {
+		fmt.Println(err)
+		os.Exit(EXIT_USAGE)
+	}
+
+	table := (format.Name == render.TABLE || format.Name == render.WIDE) && !format.NoHeaders
+
+	if table {
+		fmt.Println("Successfully fetched the list of", resource)
+		fmt.Println()
+	}
+
+	exitOnError("Failed to print the list of "+resource, format.Render(os.Stdout, list))
+
+	if table {
+		printTotals(shown, pagination, resource)
+	}
+}
@@ -0,0 +1,37 @@
+package services_test
+
+import (
+	"testing"
+
+	"gitlab.eng.vmware.com/vmware-navigator-practice/tooling/tanzu-apptx-cli/services"
+	"gitlab.eng.vmware.com/vmware-navigator-practice/tooling/tanzu-apptx-cli/simulator"
+)
+
+func TestOutputFormats(t *testing.T) {
+	sim, client := startSimulator(t, simulator.Options{VirtualMachines: 3})
+	registerVCenter(t, sim, client, "vc1")
+
+	tests := []struct {
+		format   string
+		expected string
+		exitCode int
+	}{
+		{"jsonpath={.items[*].name}", "vc1-vm-01 vc1-vm-02 vc1-vm-03", services.EXIT_SUCCESS},
+		{`jsonpath={.items[?(@.name!="vc1-vm-02")].name}`, "vc1-vm-01 vc1-vm-03", services.EXIT_SUCCESS},
+		{"go-template={{len .items}}", "3", services.EXIT_SUCCESS},
+		{"bogus", "", services.EXIT_USAGE},
+		{"jsonpath={.items[0", "", services.EXIT_USAGE},
+	}
+
+	for _, test := range tests {
+		t.Run(test.format, func(t *testing.T) {
+			output, code := runCLI(t, sim, services.VIRTUAL_MACHINES_CMD, services.LIST, "-output-format", test.format)
+			if code != test.exitCode {
+				t.Errorf("expected exit code %d, got %d", test.exitCode, code)
+			}
+			if output != test.expected && code == services.EXIT_SUCCESS {
+				t.Errorf("expected %q, got %q", test.expected, output)
+			}
+		})
+	}
+}
@@ -0,0 +1,162 @@
+package services
+
+import (
+	"flag"
+	"fmt"
+	neturl "net/url"
+	"strconv"
+)
+
+// ListOptions controls the pagination of list requests.
+type ListOptions struct {
+	// PageSize is the number of items requested per page. Zero uses the
+	// appliance default.
+	PageSize int
+	// Page fetches only the given page, counting from 1. Zero follows every
+	// page.
+	Page int
+	// Limit stops once this many items have been read. Zero reads them all.
+	Limit int
+}
+
+// Page is the HAL page metadata of a list response.
+type Page struct {
+	Size          int `json:"size"`
+	TotalElements int `json:"totalElements"`
+	TotalPages    int `json:"totalPages"`
+	Number        int `json:"number"`
+}
+
+// Pagination holds the HAL paging fields of a list response.
+type Pagination struct {
+	Links *struct {
+		Next *struct {
+			Href string `json:"href"`
+		} `json:"next,omitempty"`
+	} `json:"_links,omitempty"`
+	Page *Page `json:"page,omitempty"`
+}
+
+// Total returns the number of items reported by the appliance, or -1 when the
+// response was not paginated.
+func (pagination Pagination) Total() int {
+	if pagination.Page == nil {
+		return -1
+	}
+	return pagination.Page.TotalElements
+}
+
+// paginate requests url page by page. collect decodes each page, appends its
+// items to the caller's result and returns the page metadata and the number
+// of items read. The metadata of the first page is returned, with the links
+// dropped as they only describe that page.
+func (client *Client) paginate(url string, query neturl.Values, options ListOptions, collect func(body []byte) (Pagination, int, error)) (first Pagination, err error) {
+	return client.paginateUntil(url, query, options, collect, func(read int) bool {
+		return options.Limit > 0 && read >= options.Limit
+	})
+}
+
+// paginateUntil requests url page by page like paginate, until enough reports
+// that the items read so far are enough, ex: once the items kept by the caller
+// reach the limit.
+func (client *Client) paginateUntil(url string, query neturl.Values, options ListOptions, collect func(body []byte) (Pagination, int, error), enough func(read int) bool) (first Pagination, err error) {
+	if options.PageSize > 0 {
+		query.Set("size", strconv.Itoa(options.PageSize))
+	}
+
+	if options.Page > 0 {
+		query.Set("page", strconv.Itoa(options.Page-1))
+	}
+
+	next := url + "?" + query.Encode()
+	read := 0
+
+	for pages := 0; len(next) > 0; pages++ {
+		body, responseCode, err := client.processRequest("GET", next, nil)
+		if err != nil {
+			return first, err
+		}
+
+		if responseCode != 200 {
+			return first, &APIError{Method: "GET", URL: next, StatusCode: responseCode, Body: body}
+		}
+
+		pagination, count, err := collect(body)
+		if err != nil {
+			return first, fmt.Errorf("failed to parse the response body: %w", err)
+		}
+
+		if pages == 0 {
+			first = pagination
+			first.Links = nil
+		}
+
+		read += count
+
+		if options.Page > 0 || count == 0 || enough(read) {
+			break
+		}
+
+		current := next
+		next = ""
+
+		if pagination.Links != nil && pagination.Links.Next != nil {
+			next, err = resolveReference(current, pagination.Links.Next.Href)
+			if err != nil {
+				return first, err
+			}
+		} else if pagination.Page != nil && pagination.Page.Number+1 < pagination.Page.TotalPages {
+			query.Set("page", strconv.Itoa(pagination.Page.Number+1))
+			next = url + "?" + query.Encode()
+		}
+
+		if next == current {
+			break
+		}
+	}
+
+	return first, nil
+}
+
+// resolveReference resolves a link relative to the URL it was read from. Only
+// the path and query of the link are used, so that absolute links to another
+// host, ex: the internal address of an appliance behind a proxy, are still
+// requested from the configured appliance and the session token is not sent
+// elsewhere.
+func resolveReference(base string, reference string) (string, error) {
+	baseURL, err := neturl.Parse(base)
+	if err != nil {
+		return "", err
+	}
+
+	referenceURL, err := neturl.Parse(reference)
+	if err != nil {
+		return "", err
+	}
+
+	resolved := baseURL.ResolveReference(referenceURL)
+	resolved.Scheme, resolved.User, resolved.Host, resolved.Fragment = baseURL.Scheme, baseURL.User, baseURL.Host, ""
+	return resolved.String(), nil
+}
+
+// limit returns the number of items to keep out of count.
+func (options ListOptions) limit(count int) int {
+	if options.Limit > 0 && options.Limit < count {
+		return options.Limit
+	}
+	return count
+}
+
+// addListFlags registers the pagination flags on the flag set.
+func addListFlags(flagSet *flag.FlagSet, options *ListOptions) {
+	flagSet.IntVar(&options.PageSize, "page-size", 0, "Number of items requested per page (Default: appliance default)")
+	flagSet.IntVar(&options.Page, "page", 0, "Fetch only this page, counting from 1 (Default: all pages)")
+	flagSet.IntVar(&options.Limit, "limit", 0, "Maximum number of items to fetch (Default: no limit)")
+}
+
+// printTotals prints how many of the items known to the appliance are shown.
+func printTotals(shown int, pagination Pagination, resource string) {
+	if total := pagination.Total(); total >= 0 {
+		fmt.Printf("\nShowing %d of %d %s\n", shown, total, resource)
+	}
+}
@@ -0,0 +1,112 @@
+package services_test
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"gitlab.eng.vmware.com/vmware-navigator-practice/tooling/tanzu-apptx-cli/services"
+	"gitlab.eng.vmware.com/vmware-navigator-practice/tooling/tanzu-apptx-cli/simulator"
+)
+
+func TestPagination(t *testing.T) {
+	sim, client := startSimulator(t, simulator.Options{TaskDuration: 50 * time.Millisecond, PageSize: 2, VirtualMachines: 5})
+	registerVCenter(t, sim, client, "vc1")
+
+	all, err := client.ListVirtualMachines(services.VirtualMachineFilter{}, services.ListOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	virtualMachines := all.Embedded.VirtualMachinesResponse
+	if len(virtualMachines) != 5 {
+		t.Fatalf("expected the 5 virtual machines of the 3 pages, got %d", len(virtualMachines))
+	}
+
+	tests := []struct {
+		name    string
+		options services.ListOptions
+		first   int
+		count   int
+	}{
+		{"limit within a page", services.ListOptions{Limit: 1}, 0, 1},
+		{"limit across pages", services.ListOptions{Limit: 3}, 0, 3},
+		{"limit past the last page", services.ListOptions{Limit: 10}, 0, 5},
+		{"single page", services.ListOptions{Page: 2}, 2, 2},
+		{"last page", services.ListOptions{Page: 3}, 4, 1},
+		{"page size", services.ListOptions{PageSize: 4, Page: 2}, 4, 1},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			response, err := client.ListVirtualMachines(services.VirtualMachineFilter{}, test.options)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			listed := response.Embedded.VirtualMachinesResponse
+			if len(listed) != test.count {
+				t.Fatalf("expected %d virtual machines, got %d", test.count, len(listed))
+			}
+			for i, virtualMachine := range listed {
+				if expected := virtualMachines[test.first+i].ID; virtualMachine.ID != expected {
+					t.Errorf("expected %s at %d, got %s", expected, i, virtualMachine.ID)
+				}
+			}
+		})
+	}
+}
+
+func TestListTasksAcrossPages(t *testing.T) {
+	sim, client := startSimulator(t, simulator.Options{TaskDuration: 50 * time.Millisecond, PageSize: 2})
+	registerVCenter(t, sim, client, "vc1")
+
+	for i := 0; i < 3; i++ {
+		tasks, err := client.SyncVCenter("vc1", "")
+		if _, err := watch(t, client, tasks, err); err != nil {
+			t.Fatalf("failed to sync the vCenter: %v", err)
+		}
+	}
+
+	tasks, err := client.ListTasks(services.TaskFilter{Type: simulator.VCENTER_SYNC}, services.ListOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tasks) < 3 {
+		t.Fatalf("expected at least the 3 syncs, got %d tasks", len(tasks))
+	}
+
+	limited, err := client.ListTasks(services.TaskFilter{Type: simulator.VCENTER_SYNC}, services.ListOptions{Limit: 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(limited) != 3 {
+		t.Fatalf("expected 3 tasks, got %d", len(limited))
+	}
+	for i, task := range limited {
+		if task.ID != tasks[i].ID {
+			t.Errorf("expected the most recent tasks first, got %s at %d instead of %s", task.ID, i, tasks[i].ID)
+		}
+	}
+
+	output, code := runCLI(t, sim, services.TASKS_CMD, services.LIST, "-limit", "3", "-page-size", "2", "-output-format", "json")
+	if code != services.EXIT_SUCCESS {
+		t.Fatalf("expected the tasks to be listed, got exit code %d", code)
+	}
+	listed := []services.TaskResponse{}
+	if err := json.Unmarshal([]byte(output), &listed); err != nil || len(listed) != 3 {
+		t.Errorf("expected 3 tasks, got %v:\n%s", err, output)
+	}
+}
+
+func TestPaginationStaysOnTheAppliance(t *testing.T) {
+	sim, client := startSimulator(t, simulator.Options{TaskDuration: 50 * time.Millisecond, PageSize: 2, VirtualMachines: 5, LinkBase: "https://appliance.internal:8443"})
+	registerVCenter(t, sim, client, "vc1")
+
+	response, err := client.ListVirtualMachines(services.VirtualMachineFilter{}, services.ListOptions{})
+	if err != nil {
+		t.Fatalf("expected the next links to be followed on %s, got %v", sim.Address(), err)
+	}
+	if count := len(response.Embedded.VirtualMachinesResponse); count != 5 {
+		t.Errorf("expected the 5 virtual machines of the 3 pages, got %d", count)
+	}
+}
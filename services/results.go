@@ -0,0 +1,161 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Result is the outcome of a mutating operation, printed with -output json so
+// that scripts can branch on it.
+type Result struct {
+	Operation string `json:"operation"`
+	Target    string `json:"target"`
+	TaskID    string `json:"taskId,omitempty"`
+	Status    string `json:"status"`
+	Error     string `json:"error,omitempty"`
+}
+
+// outputMode holds the -output flag of the operation being executed.
+var outputMode = "text"
+
+// addOutputFlags registers the result output flag on the flag set.
+func addOutputFlags(flagSet *flag.FlagSet) {
+	flagSet.StringVar(&outputMode, "output", "text", "Result output format - (text,json)")
+}
+
+// operationName returns the command and operation being executed, ex:
+// 'vcenter register'.
+func operationName() string {
+	if len(os.Args) > 2 {
+		return strings.Join(os.Args[1:3], " ")
+	}
+	return strings.Join(os.Args[1:], " ")
+}
+
+// exitCode maps an error to the documented exit codes.
+func exitCode(err error) int {
+	var apiError *APIError
+	var authError *AuthError
+	var taskError *TaskError
+	var timeout *TaskTimeoutError
+
+	switch {
+	case err == nil, errors.Is(err, ErrDryRun):
+		return EXIT_SUCCESS
+	case errors.As(err, &authError):
+		return EXIT_AUTH
+	case IsNotFound(err):
+		return EXIT_NOT_FOUND
+	case IsAlreadyExists(err):
+		return EXIT_CONFLICT
+	case errors.As(err, &timeout):
+		return EXIT_TIMEOUT
+	case errors.As(err, &taskError):
+		if taskError.Status == "PARTIAL_SUCCESS" {
+			return EXIT_PARTIAL_SUCCESS
+		}
+		return EXIT_TASK_FAILED
+	case errors.As(err, &apiError):
+		switch apiError.StatusCode {
+		case 401, 403:
+			return EXIT_AUTH
+		case 404:
+			return EXIT_NOT_FOUND
+		case 409:
+			return EXIT_CONFLICT
+		}
+	}
+
+	return EXIT_ERROR
+}
+
+// resultStatus returns the status reported for an operation that ended with
+// err.
+func resultStatus(err error) string {
+	var taskError *TaskError
+	var timeout *TaskTimeoutError
+
+	switch {
+	case err == nil:
+		return "SUCCESS"
+	case errors.Is(err, ErrDryRun):
+		return "DRY_RUN"
+	case errors.As(err, &timeout):
+		return "TIMEOUT"
+	case errors.As(err, &taskError):
+		return taskError.Status
+	}
+
+	return "FAILED"
+}
+
+// printResult prints the result as JSON, or the message followed by the error
+// as text. A dry run is not reported as an error.
+func printResult(result Result, err error, message string) {
+	if errors.Is(err, ErrDryRun) {
+		err, message = nil, "Dry run, no changes were made"
+	}
+
+	if err != nil {
+		result.Error = err.Error()
+	}
+
+	if outputMode == "json" {
+		output, jsonErr := json.Marshal(result)
+		if jsonErr != nil {
+			fmt.Println("Failed to generate json", jsonErr)
+			os.Exit(EXIT_ERROR)
+		}
+		fmt.Println(string(output))
+	} else if err != nil {
+		fmt.Println(message+"\n[ERROR] -", err)
+	} else {
+		fmt.Println(message)
+	}
+}
+
+// report prints the outcome of a mutating operation and exits with the
+// matching code.
+func report(target string, err error, failure string, success string) {
+	message := success
+	if err != nil {
+		message = failure
+	}
+
+	printResult(Result{Operation: operationName(), Target: target, Status: resultStatus(err)}, err, message)
+	os.Exit(exitCode(err))
+}
+
+// finishTask follows the task submitted by a mutating operation, unless
+// -no-wait was given, then reports its outcome and exits. partial is printed
+// when the task partially succeeded.
+func finishTask(client *Client, target string, tasks Tasks, err error, failure string, partial string, success string) {
+	if err != nil {
+		report(target, err, failure, success)
+	}
+
+	result := Result{Operation: operationName(), Target: target, TaskID: tasks.TaskID}
+
+	if noWait {
+		result.Status = "SUBMITTED"
+		printResult(result, nil, tasks.TaskID)
+		os.Exit(EXIT_SUCCESS)
+	}
+
+	_, err = monitorTask(client, tasks)
+
+	message := success
+	if resultStatus(err) == "PARTIAL_SUCCESS" && len(partial) > 0 {
+		message = partial
+	} else if err != nil {
+		message = failure
+	}
+
+	result.Status = resultStatus(err)
+	printResult(result, err, message)
+	os.Exit(exitCode(err))
+}
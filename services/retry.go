@@ -0,0 +1,161 @@
+package services
+
+import (
+	"errors"
+	"flag"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// RetryOptions controls how failed requests are retried. Idempotent requests
+// are retried on network errors, 429 and 5xx responses; POST requests only on
+// 429 and 503, which guarantee the request was not processed. Opening a
+// session is retried like an idempotent request.
+type RetryOptions struct {
+	MaxRetries int
+	// BaseDelay is the backoff before the first retry. It doubles on every
+	// retry up to MaxDelay and is jittered. A Retry-After header takes
+	// precedence, but is also capped at MaxDelay.
+	BaseDelay time.Duration
+	MaxDelay  time.Duration
+}
+
+// DefaultRetryOptions returns the retry settings of a new client.
+func DefaultRetryOptions() RetryOptions {
+	return RetryOptions{MaxRetries: 3, BaseDelay: 500 * time.Millisecond, MaxDelay: 30 * time.Second}
+}
+
+// SetRetryOptions changes how failed requests are retried.
+func (client *Client) SetRetryOptions(options RetryOptions) {
+	client.retry = options
+}
+
+// SetRateLimit limits the client to requestsPerSecond requests, shared by
+// every goroutine using it. Zero removes the limit.
+func (client *Client) SetRateLimit(requestsPerSecond float64) {
+	client.limiter = newRateLimiter(requestsPerSecond)
+}
+
+// idempotentMethod reports whether requests with the method can be sent again
+// without changing the outcome.
+func idempotentMethod(method string) bool {
+	return method != "POST" && method != "PATCH"
+}
+
+// shouldRetry reports whether a request that failed with err or responded
+// with responseCode can be sent again.
+func (options RetryOptions) shouldRetry(idempotent bool, responseCode int, err error, attempt int) bool {
+	if attempt >= options.MaxRetries {
+		return false
+	}
+
+	if errors.Is(err, ErrNotRecorded) {
+		return false
+	}
+
+	if err != nil {
+		return idempotent
+	}
+
+	if responseCode == 429 || responseCode == 503 {
+		return true
+	}
+
+	return idempotent && responseCode >= 500
+}
+
+// delay returns how long to wait before the given retry, honouring the
+// Retry-After header of the failed response up to MaxDelay.
+func (options RetryOptions) delay(resp *http.Response, attempt int) time.Duration {
+	if wait, found := retryAfter(resp); found {
+		if wait < 0 {
+			return 0
+		}
+		if options.MaxDelay > 0 && wait > options.MaxDelay {
+			return options.MaxDelay
+		}
+		return wait
+	}
+
+	backoff := options.BaseDelay << uint(attempt)
+	if backoff <= 0 || backoff > options.MaxDelay {
+		backoff = options.MaxDelay
+	}
+
+	if backoff <= 0 {
+		return 0
+	}
+
+	return time.Duration(rand.Int63n(int64(backoff)))
+}
+
+// retryAfter returns the wait requested by the Retry-After header of resp,
+// given in seconds or as a date.
+func retryAfter(resp *http.Response) (time.Duration, bool) {
+	if resp == nil {
+		return 0, false
+	}
+
+	value := resp.Header.Get("Retry-After")
+	if seconds, err := strconv.Atoi(value); err == nil {
+		return time.Duration(seconds) * time.Second, true
+	}
+	if date, err := http.ParseTime(value); err == nil {
+		return time.Until(date), true
+	}
+	return 0, false
+}
+
+// rateLimiter spaces requests evenly to stay under a rate.
+type rateLimiter struct {
+	interval time.Duration
+	next     time.Time
+	mutex    sync.Mutex
+}
+
+func newRateLimiter(requestsPerSecond float64) *rateLimiter {
+	if requestsPerSecond <= 0 {
+		return nil
+	}
+	return &rateLimiter{interval: time.Duration(float64(time.Second) / requestsPerSecond)}
+}
+
+// wait blocks until the next request may be sent.
+func (limiter *rateLimiter) wait() {
+	if limiter == nil {
+		return
+	}
+
+	limiter.mutex.Lock()
+	now := time.Now()
+	if limiter.next.Before(now) {
+		limiter.next = now
+	}
+	sleep := limiter.next.Sub(now)
+	limiter.next = limiter.next.Add(limiter.interval)
+	limiter.mutex.Unlock()
+
+	time.Sleep(sleep)
+}
+
+// retryOptions and rateLimit hold the request flags of the operation being
+// executed.
+var retryOptions = DefaultRetryOptions()
+var rateLimit float64
+
+// addRequestFlags registers the timeout, retry, rate limiting, dry-run,
+// tracing and cassette flags on the flag set.
+func addRequestFlags(flagSet *flag.FlagSet) {
+	flagSet.DurationVar(&transportOptions.ConnectTimeout, "connect-timeout", transportOptions.ConnectTimeout, "Maximum time to establish a connection, TLS handshake included")
+	flagSet.DurationVar(&transportOptions.ReadTimeout, "read-timeout", transportOptions.ReadTimeout, "Maximum time to send a request and read the whole response")
+	flagSet.IntVar(&retryOptions.MaxRetries, "max-retries", retryOptions.MaxRetries, "Number of times a failed request is retried")
+	flagSet.Float64Var(&rateLimit, "rate-limit", 0, "Maximum number of requests per second sent to the appliance (Default: no limit)")
+	flagSet.BoolVar(&dryRun, "dry-run", false, "Print the requests that would change the appliance instead of sending them")
+	flagSet.Var(&traceLevel, "v", "Log the HTTP requests to stderr, -v=2 adds the headers and bodies with the secrets redacted")
+	flagSet.Var(debugFlag{&traceLevel}, "debug", "Log the HTTP requests with their headers and bodies to stderr, same as -v=2")
+	flagSet.StringVar(&recordDir, "record", "", "Save every request and response to this directory, with the secrets scrubbed, to replay them with -replay")
+	flagSet.StringVar(&replayDir, "replay", "", "Answer the requests from the responses saved by -record in this directory, without any network access")
+}
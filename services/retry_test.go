@@ -0,0 +1,51 @@
+package services_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"gitlab.eng.vmware.com/vmware-navigator-practice/tooling/tanzu-apptx-cli/services"
+)
+
+func TestRetryAfterIsCapped(t *testing.T) {
+	for _, retryAfter := range []string{"3600", time.Now().Add(time.Hour).UTC().Format(http.TimeFormat)} {
+		t.Run(retryAfter, func(t *testing.T) {
+			var requests int32
+			server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if atomic.AddInt32(&requests, 1) == 1 {
+					w.Header().Set("Retry-After", retryAfter)
+					w.WriteHeader(http.StatusServiceUnavailable)
+					return
+				}
+				w.Write([]byte("[]"))
+			}))
+			defer server.Close()
+
+			client, err := services.NewClient(services.Request{URL: strings.TrimPrefix(server.URL, "https://")})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := client.SetTLSOptions(services.TLSOptions{Insecure: true, KnownHostsFile: os.DevNull}); err != nil {
+				t.Fatal(err)
+			}
+			client.UseSession(services.Session{Username: "admin", Token: "token"})
+			client.SetRetryOptions(services.RetryOptions{MaxRetries: 2, BaseDelay: 10 * time.Millisecond, MaxDelay: 50 * time.Millisecond})
+
+			start := time.Now()
+			if _, err := client.ListVRNIs(); err != nil {
+				t.Fatal(err)
+			}
+			if elapsed := time.Since(start); elapsed > 5*time.Second {
+				t.Errorf("expected the retry to wait at most the maximum delay, waited %s", elapsed)
+			}
+			if requests != 2 {
+				t.Errorf("expected the request to be retried once, got %d requests", requests)
+			}
+		})
+	}
+}
@@ -0,0 +1,189 @@
+package services
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"os/signal"
+	"strings"
+
+	"golang.org/x/term"
+)
+
+// Credentials are the username and secret returned by a credential helper.
+type Credentials struct {
+	Username string `json:"username,omitempty"`
+	Secret   string `json:"secret"`
+}
+
+// CredentialHelper is an external command that looks up secrets, so that
+// they are kept out of the command line, the shell history and the
+// configuration file. It is run as '<command> get <key>' and prints the
+// credentials as JSON, ex: {"username": "admin", "secret": "..."}. Output that
+// is not JSON is taken as the secret. The keys are:
+//
+//	appliance/<fqdn>          Application Transformer admin credentials
+//	service-account/<alias>   password of a service account
+//	vrni/<fqdn>               API token of a SaaS vRNI instance
+type CredentialHelper string
+
+// Get runs the helper for key.
+func (helper CredentialHelper) Get(key string) (credentials Credentials, err error) {
+	fields := strings.Fields(string(helper))
+	if len(fields) == 0 {
+		return credentials, fmt.Errorf("no credential helper configured")
+	}
+
+	command := exec.Command(fields[0], append(fields[1:], "get", key)...)
+	command.Stderr = os.Stderr
+
+	output, err := command.Output()
+	if err != nil {
+		return credentials, fmt.Errorf("credential helper failed to get %s: %w", key, err)
+	}
+
+	if err := json.Unmarshal(output, &credentials); err != nil {
+		credentials = Credentials{Secret: strings.TrimRight(string(output), "\r\n")}
+	}
+
+	if len(credentials.Secret) == 0 {
+		return credentials, fmt.Errorf("credential helper returned no secret for %s", key)
+	}
+
+	return credentials, nil
+}
+
+// credentialHelper holds the credential helper resolved for the operation
+// being executed.
+var credentialHelper CredentialHelper
+
+// secretResolver supplies a secret that was not given on the command line,
+// from the credential helper when there is one and otherwise from a prompt on
+// the terminal.
+type secretResolver struct {
+	helper CredentialHelper
+}
+
+func (resolver secretResolver) resolve(key string, description string) (string, error) {
+	if len(resolver.helper) == 0 {
+		return promptSecret(description)
+	}
+
+	credentials, err := resolver.helper.Get(key)
+	return credentials.Secret, err
+}
+
+// secretFlags are the -<name>-stdin and -<name>-file flags that give a secret
+// without exposing it on the command line.
+type secretFlags struct {
+	name  string
+	stdin bool
+	file  string
+}
+
+// addSecretFlags registers the stdin and file flags of the secret flag name
+// on the flag set.
+func addSecretFlags(flagSet *flag.FlagSet, name string, description string) *secretFlags {
+	flags := &secretFlags{name: name}
+	flagSet.BoolVar(&flags.stdin, name+"-stdin", false, "Read the "+description+" from stdin")
+	flagSet.StringVar(&flags.file, name+"-file", "", "Read the "+description+" from a file")
+	return flags
+}
+
+// stdinRead is set once a secret was read from stdin, which can only hold
+// one.
+var stdinRead bool
+
+// read returns the secret given by the flags, or an empty string when none
+// of them was set.
+func (flags *secretFlags) read() (string, error) {
+	var data []byte
+	var err error
+
+	switch {
+	case flags.stdin && len(flags.file) > 0:
+		return "", fmt.Errorf("-%s-stdin and -%s-file cannot be combined", flags.name, flags.name)
+	case flags.stdin:
+		if stdinRead {
+			return "", fmt.Errorf("-%s-stdin cannot be combined with another secret read from stdin", flags.name)
+		}
+		stdinRead = true
+		data, err = ioutil.ReadAll(os.Stdin)
+	case len(flags.file) > 0:
+		data, err = ioutil.ReadFile(flags.file)
+	default:
+		return "", nil
+	}
+
+	if err != nil {
+		return "", fmt.Errorf("failed to read -%s: %w", flags.name, err)
+	}
+
+	return strings.TrimRight(string(data), "\r\n"), nil
+}
+
+// resolveSecret returns value when it is set, else the secret given by the
+// stdin and file flags, the credential helper or, on a terminal, a prompt.
+func resolveSecret(value string, flags *secretFlags, key string, description string) (string, error) {
+	if len(value) > 0 {
+		return value, nil
+	}
+
+	secret, err := flags.read()
+	if err != nil || len(secret) > 0 {
+		return secret, err
+	}
+
+	return secretResolver{credentialHelper}.resolve(key, description)
+}
+
+// isTerminal reports whether stdin is a terminal a secret can be prompted
+// from.
+func isTerminal() bool {
+	return !stdinRead && term.IsTerminal(int(os.Stdin.Fd()))
+}
+
+// promptSecret reads a line from the terminal with echo turned off. The
+// terminal is restored when the prompt is interrupted with Ctrl-C.
+func promptSecret(description string) (string, error) {
+	if !isTerminal() {
+		return "", fmt.Errorf("the %s is required but stdin is not a terminal, use a credential helper", description)
+	}
+
+	fd := int(os.Stdin.Fd())
+	state, err := term.GetState(fd)
+	if err != nil {
+		return "", err
+	}
+
+	interrupted := make(chan os.Signal, 1)
+	signal.Notify(interrupted, os.Interrupt)
+	done := make(chan struct{})
+	defer close(done)
+	defer signal.Stop(interrupted)
+
+	go func() {
+		select {
+		case <-interrupted:
+			term.Restore(fd, state)
+			fmt.Fprintln(os.Stderr)
+			os.Exit(EXIT_INTERRUPTED)
+		case <-done:
+		}
+	}()
+
+	fmt.Fprintf(os.Stderr, "Enter the %s: ", description)
+	secret, err := term.ReadPassword(fd)
+	fmt.Fprintln(os.Stderr)
+	if err == io.EOF {
+		return "", fmt.Errorf("the %s was not entered, use a credential helper", description)
+	} else if err != nil {
+		return "", err
+	}
+
+	return string(secret), nil
+}
@@ -2,8 +2,8 @@ package services
 
 import (
 	"encoding/json"
-	"flag"
 	"fmt"
+	neturl "net/url"
 	"os"
 	"strings"
 )
@@ -22,23 +22,24 @@ func (serviceAccounts ServiceAccounts) Execute() {
 	serviceAccounts = serviceAccounts.validate()
 
 	request := Request{serviceAccounts.url, serviceAccounts.username, serviceAccounts.password}
-	authResponse := Authenticate(request)
+	client := authenticate(request)
 
 	switch serviceAccounts.operation {
 	case REGISTER:
-		serviceAccounts.createServiceAccount(authResponse.Token, request)
+		_, err := client.CreateServiceAccount(serviceAccounts.saUsername, serviceAccounts.saPassword, serviceAccounts.saAlias)
+		report(serviceAccounts.saAlias, err, "Failed to create Service Account", "Service Account created")
 	case UNREGISTER:
-		serviceAccounts.deleteServiceAccount(authResponse.Token, request)
+		err := client.DeleteServiceAccount(serviceAccounts.saAlias)
+		report(serviceAccounts.saAlias, err, "Failed to delete Service Account", "Deleted Service Account")
 	default:
 		fmt.Println("Operation not supported")
 		serviceAccounts.printUsage()
-		os.Exit(1)
 	}
 }
 
 func (serviceAccounts ServiceAccounts) validate() ServiceAccounts {
-	registerCmd := flag.NewFlagSet(REGISTER, flag.ExitOnError)
-	unregisterCmd := flag.NewFlagSet(UNREGISTER, flag.ExitOnError)
+	registerCmd := NewFlagSet(REGISTER)
+	unregisterCmd := NewFlagSet(UNREGISTER)
 
 	if len(os.Args) < 3 {
 		serviceAccounts.printUsage()
@@ -54,38 +55,46 @@ func (serviceAccounts ServiceAccounts) validate() ServiceAccounts {
 	var saAlias string
 
 	if operation == REGISTER {
-		registerCmd.StringVar(&url, "fqdn", "", "Application Transformer FQDN / IP, ex: appliance.example.com")
-		registerCmd.StringVar(&username, "username", "", "Application Transformer admin username")
-		registerCmd.StringVar(&password, "password", "", "Application Transformer admin password")
+		connection := addConnectionFlags(registerCmd)
+		addOutputFlags(registerCmd)
 		registerCmd.StringVar(&saUsername, "service-username", "", "service account username")
-		registerCmd.StringVar(&saPassword, "service-password", "", "service account password")
+		registerCmd.StringVar(&saPassword, "service-password", "", "service account password, visible to other users (Default: -service-password-stdin, -service-password-file, the credential helper or a prompt)")
+		saPasswordFlags := addSecretFlags(registerCmd, "service-password", "service account password")
 		registerCmd.StringVar(&saAlias, "sa-alias", "", "service account alias")
 
 		registerCmd.Parse(os.Args[3:])
+		url, username, password = connection.resolve()
 
-		if (len(url) == 0 || len(username) == 0 || len(password) == 0) ||
+		if len(saAlias) > 0 && len(saUsername) > 0 {
+			var err error
+			saPassword, err = resolveSecret(saPassword, saPasswordFlags, SERVICE_ACCOUNT_CMD+"/"+saAlias,
+				fmt.Sprintf("password of service account %q (%s)", saAlias, saUsername))
+			exitOnError("Failed to read the service account password", err)
+		}
+
+		if !hasCredentials(url, username, password) ||
 			(len(saUsername) == 0 || len(saPassword) == 0 || len(saAlias) == 0) ||
 			(strings.Contains(url, "https://")) {
 			fmt.Printf("Usage: '%s %s %s [flags]' \n", CLI_NAME, SERVICE_ACCOUNT_CMD, REGISTER)
 			fmt.Println("Available Flags:")
 			registerCmd.PrintDefaults()
-			os.Exit(1)
+			os.Exit(EXIT_USAGE)
 		}
 	} else if operation == UNREGISTER {
-		unregisterCmd.StringVar(&url, "fqdn", "", "Application Transformer FQDN / IP, ex: appliance.example.com")
-		unregisterCmd.StringVar(&username, "username", "", "Application Transformer admin username")
-		unregisterCmd.StringVar(&password, "password", "", "Application Transformer admin password")
+		connection := addConnectionFlags(unregisterCmd)
+		addOutputFlags(unregisterCmd)
 		unregisterCmd.StringVar(&saAlias, "sa-alias", "", "service account alias")
 
 		unregisterCmd.Parse(os.Args[3:])
+		url, username, password = connection.resolve()
 
-		if (len(url) == 0 || len(username) == 0 || len(password) == 0) ||
+		if !hasCredentials(url, username, password) ||
 			(len(saAlias) == 0) ||
 			(strings.Contains(url, "https://")) {
 			fmt.Printf("Usage: '%s %s %s [flags]' \n", CLI_NAME, SERVICE_ACCOUNT_CMD, UNREGISTER)
 			fmt.Println("Available Flags:")
 			unregisterCmd.PrintDefaults()
-			os.Exit(1)
+			os.Exit(EXIT_USAGE)
 		}
 	} else {
 		serviceAccounts.printUsage()
@@ -96,69 +105,73 @@ func (serviceAccounts ServiceAccounts) validate() ServiceAccounts {
 }
 
 func (serviceAccounts ServiceAccounts) printUsage() {
-	fmt.Printf("Usage: '%s %s [command]' \n", CLI_NAME, SERVICE_ACCOUNT_CMD)
-	fmt.Println("Available Commands:")
-	fmt.Printf("  %s \t\t\t%s \n", REGISTER, "Register service account")
-	fmt.Printf("  %s \t\t\t%s \n", UNREGISTER, "Unregister service account")
-	os.Exit(1)
+	PrintCommandUsage(SERVICE_ACCOUNT_CMD, EXIT_USAGE)
 }
 
-func (serviceAccounts ServiceAccounts) createServiceAccount(token string, request Request) {
-	response := serviceAccounts.findServiceAccount(serviceAccounts.saAlias, token, request)
-
-	if len(response.Embedded.ServiceAccounts) > 0 {
-		fmt.Println("Service Account already exists")
-	} else {
-		url := PROTOCOL + "://" + request.URL + "/" + PREFIX + "/" + SERVICE_ACCOUNTS
-		request := serviceAccountRequest{serviceAccounts.saUsername, serviceAccounts.saPassword, serviceAccounts.saAlias}
-		body, _ := processRequest(token, url, "POST", request)
-
-		serviceAccount := serviceAccount{}
-		err := json.Unmarshal(body, &serviceAccount)
-		if err != nil {
-			fmt.Println("Failed to parse the response body.\n[ERROR] -", err)
-			os.Exit(1)
-		}
-
-		if len(serviceAccount.UUID) > 0 {
-			fmt.Println("Service Account created")
-		}
+// CreateServiceAccount registers a service account under alias.
+func (client *Client) CreateServiceAccount(username string, password string, alias string) (serviceAccount ServiceAccount, err error) {
+	_, err = client.FindServiceAccount(alias)
+	if err == nil {
+		return serviceAccount, &AlreadyExistsError{Resource: "Service Account", Name: alias}
+	} else if !IsNotFound(err) {
+		return serviceAccount, err
 	}
-}
 
-func (serviceAccounts ServiceAccounts) findServiceAccount(alias string, token string, request Request) (response response) {
-	url := PROTOCOL + "://" + request.URL + "/" + PREFIX + "/" + SERVICE_ACCOUNTS + "?size=10&sort=modified,DESC&alias=" + alias
-	body, _ := processRequest(token, url, "GET", nil)
+	url := client.discoveryURL(SERVICE_ACCOUNTS)
+	request := serviceAccountRequest{username, password, alias}
 
-	err := json.Unmarshal(body, &response)
+	err = client.expect("POST", url, request, &serviceAccount, 200, 201)
 	if err != nil {
-		fmt.Println("Failed to parse the response body.\n[ERROR] -", err)
-		os.Exit(1)
+		return serviceAccount, err
 	}
-	return response
-}
 
-func (serviceAccounts ServiceAccounts) deleteServiceAccount(token string, request Request) {
-	response := serviceAccounts.findServiceAccount(serviceAccounts.saAlias, token, request)
+	if len(serviceAccount.UUID) == 0 {
+		return serviceAccount, fmt.Errorf("Service Account %q was not created", alias)
+	}
 
-	if len(response.Embedded.ServiceAccounts) > 0 {
+	return serviceAccount, nil
+}
 
-		for _, serviceAccount := range response.Embedded.ServiceAccounts {
-			if serviceAccount.Alias == serviceAccounts.saAlias {
-				url := PROTOCOL + "://" + request.URL + "/" + PREFIX + "/" + SERVICE_ACCOUNTS + "/" + serviceAccount.UUID
-				_, responseCode := processRequest(token, url, "DELETE", nil)
+// ListServiceAccounts returns the service accounts whose alias matches alias.
+func (client *Client) ListServiceAccounts(alias string, options ListOptions) (response ServiceAccountListResponse, err error) {
+	query := neturl.Values{}
+	query.Set("sort", "modified,DESC")
+	query.Set("alias", alias)
+
+	response.Pagination, err = client.paginate(client.discoveryURL(SERVICE_ACCOUNTS), query, options, func(body []byte) (Pagination, int, error) {
+		page := ServiceAccountListResponse{}
+		err := json.Unmarshal(body, &page)
+		response.Embedded.ServiceAccounts = append(response.Embedded.ServiceAccounts, page.Embedded.ServiceAccounts...)
+		return page.Pagination, len(page.Embedded.ServiceAccounts), err
+	})
+
+	response.Embedded.ServiceAccounts = response.Embedded.ServiceAccounts[:options.limit(len(response.Embedded.ServiceAccounts))]
+	return response, err
+}
 
-				if responseCode == 200 {
-					fmt.Println("Deleted Service Account")
-				} else {
-					fmt.Println("Failed to delete Service Account. Response Code:", responseCode)
-				}
-			} else {
-				fmt.Println("Cannot delete Service Account as it does not exist")
-			}
+// FindServiceAccount returns the service account registered under alias.
+func (client *Client) FindServiceAccount(alias string) (serviceAccount ServiceAccount, err error) {
+	response, err := client.ListServiceAccounts(alias, ListOptions{})
+	if err != nil {
+		return serviceAccount, err
+	}
+
+	for _, serviceAccount := range response.Embedded.ServiceAccounts {
+		if serviceAccount.Alias == alias {
+			return serviceAccount, nil
 		}
+	}
 
-	} else {
-		fmt.Println("Cannot delete Service Account as it does not exist")
+	return serviceAccount, &NotFoundError{Resource: "Service Account", Name: alias}
+}
+
+// DeleteServiceAccount removes the service account registered under alias.
+func (client *Client) DeleteServiceAccount(alias string) error {
+	serviceAccount, err := client.FindServiceAccount(alias)
+	if err != nil {
+		return err
 	}
+
+	url := client.discoveryURL(SERVICE_ACCOUNTS, serviceAccount.UUID)
+	return client.expect("DELETE", url, nil, nil, 200)
 }
@@ -0,0 +1,238 @@
+package services
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Session holds the tokens of an authenticated session on an appliance.
+type Session struct {
+	Username     string `yaml:"username"`
+	Token        string `yaml:"token"`
+	RefreshToken string `yaml:"refresh-token,omitempty"`
+}
+
+// SessionCache holds the sessions opened by login, keyed by appliance FQDN.
+type SessionCache struct {
+	Sessions map[string]Session `yaml:"sessions"`
+}
+
+// SessionCachePath returns the location of the session cache, next to the
+// configuration file.
+func SessionCachePath() (string, error) {
+	path, err := ConfigPath()
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(filepath.Dir(path), SESSIONS_FILE), nil
+}
+
+// LoadSessions reads the session cache. A missing file yields an empty cache.
+func LoadSessions() (cache SessionCache, err error) {
+	cache.Sessions = map[string]Session{}
+
+	path, err := SessionCachePath()
+	if err != nil {
+		return cache, err
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return cache, nil
+	} else if err != nil {
+		return cache, err
+	}
+
+	if err := yaml.Unmarshal(data, &cache); err != nil {
+		return cache, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+
+	if cache.Sessions == nil {
+		cache.Sessions = map[string]Session{}
+	}
+
+	return cache, nil
+}
+
+// Save writes the session cache, readable only by the current user.
+func (cache SessionCache) Save() error {
+	path, err := SessionCachePath()
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+
+	data, err := yaml.Marshal(cache)
+	if err != nil {
+		return err
+	}
+
+	if err := ioutil.WriteFile(path, data, 0600); err != nil {
+		return err
+	}
+
+	return os.Chmod(path, 0600)
+}
+
+// Session returns the session cached for the appliance. When username is not
+// empty the session must belong to that user.
+func (cache SessionCache) Session(url string, username string) (session Session, found bool) {
+	session, found = cache.Sessions[url]
+	if found && len(username) > 0 && session.Username != username {
+		return Session{}, false
+	}
+	return session, found
+}
+
+// Set caches the session for the appliance.
+func (cache SessionCache) Set(url string, session Session) {
+	cache.Sessions[url] = session
+}
+
+// Delete removes the session cached for the appliance.
+func (cache SessionCache) Delete(url string) {
+	delete(cache.Sessions, url)
+}
+
+// tokenExpired reports whether the token is a JWT whose expiry is less than a
+// minute away. Opaque tokens are assumed to be valid.
+func tokenExpired(token string) bool {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return false
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(parts[1], "="))
+	if err != nil {
+		return false
+	}
+
+	claims := struct {
+		Expiry int64 `json:"exp"`
+	}{}
+	if err := json.Unmarshal(payload, &claims); err != nil || claims.Expiry == 0 {
+		return false
+	}
+
+	return time.Now().Add(time.Minute).After(time.Unix(claims.Expiry, 0))
+}
+
+// hasCredentials reports whether the appliance can be reached with the
+// given credentials or with a session cached by login.
+func hasCredentials(url string, username string, password string) bool {
+	if len(url) == 0 {
+		return false
+	}
+
+	if len(username) > 0 && len(password) > 0 || replaying() {
+		return true
+	}
+
+	// The credentials are looked up or prompted for when authenticating.
+	if len(credentialHelper) > 0 || (len(username) > 0 && isTerminal()) {
+		return true
+	}
+
+	sessions, err := LoadSessions()
+	if err != nil {
+		return false
+	}
+
+	_, cached := sessions.Session(url, username)
+	return cached
+}
+
+type Sessions struct {
+	url       string
+	username  string
+	password  string
+	operation string
+}
+
+func (sessions Sessions) Execute() {
+	sessions = sessions.validate()
+
+	cache, err := LoadSessions()
+	exitOnError("Failed to load the cached sessions", err)
+
+	request := Request{sessions.url, sessions.username, sessions.password}
+	client := newClient(request)
+
+	switch sessions.operation {
+	case LOGIN_CMD:
+		promptPassword(client)
+		exitOnError("Failed to authenticate with Application Transformer", client.Authenticate())
+
+		cache.Set(sessions.url, client.Session())
+		exitOnError("Failed to save the cached sessions", cache.Save())
+		fmt.Println("Logged in to", sessions.url)
+	case LOGOUT_CMD:
+		session, cached := cache.Session(sessions.url, "")
+		if !cached {
+			fmt.Println("There is no cached session for", sessions.url)
+			os.Exit(EXIT_ERROR)
+		}
+
+		client.UseSession(session)
+		err := client.Logout()
+
+		cache.Delete(sessions.url)
+		exitOnError("Failed to save the cached sessions", cache.Save())
+		exitOnError("Failed to invalidate the session on the appliance", err)
+		fmt.Println("Logged out of", sessions.url)
+	}
+}
+
+func (sessions Sessions) validate() Sessions {
+	loginCmd := NewFlagSet(LOGIN_CMD)
+	logoutCmd := NewFlagSet(LOGOUT_CMD)
+
+	operation := strings.ToLower(os.Args[1])
+
+	var url string
+	var username string
+	var password string
+
+	if operation == LOGIN_CMD {
+		connection := addConnectionFlags(loginCmd)
+
+		loginCmd.Parse(os.Args[2:])
+		url, username, password = connection.resolve()
+
+		if len(url) == 0 ||
+			(len(password) == 0 && len(credentialHelper) == 0 && (len(username) == 0 || !isTerminal())) ||
+			(strings.Contains(url, "https://")) {
+			fmt.Printf("Usage: '%s %s [flags]' \n", CLI_NAME, LOGIN_CMD)
+			fmt.Println("Available Flags:")
+			loginCmd.PrintDefaults()
+			os.Exit(EXIT_USAGE)
+		}
+	} else if operation == LOGOUT_CMD {
+		connection := addConnectionFlags(logoutCmd)
+
+		logoutCmd.Parse(os.Args[2:])
+		url, username, password = connection.resolve()
+
+		if len(url) == 0 || (strings.Contains(url, "https://")) {
+			fmt.Printf("Usage: '%s %s [flags]' \n", CLI_NAME, LOGOUT_CMD)
+			fmt.Println("Available Flags:")
+			logoutCmd.PrintDefaults()
+			os.Exit(EXIT_USAGE)
+		}
+	}
+
+	sessions = Sessions{url, username, password, operation}
+	return sessions
+}
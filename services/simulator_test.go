@@ -0,0 +1,142 @@
+package services_test
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"os/exec"
+	"strings"
+	"testing"
+	"time"
+
+	"gitlab.eng.vmware.com/vmware-navigator-practice/tooling/tanzu-apptx-cli/services"
+	"gitlab.eng.vmware.com/vmware-navigator-practice/tooling/tanzu-apptx-cli/simulator"
+)
+
+// cliEnv holds the arguments of the CLI when runCLI runs the test binary as
+// the CLI, one per line.
+const cliEnv = "APPTX_TEST_CLI"
+
+func TestMain(m *testing.M) {
+	if args, found := os.LookupEnv(cliEnv); found {
+		os.Args = append([]string{services.CLI_NAME}, strings.Split(args, "\n")...)
+		services.Run(services.Commands())
+		os.Exit(services.EXIT_SUCCESS)
+	}
+
+	os.Exit(m.Run())
+}
+
+// runCLI runs the CLI against the simulator, with a configuration directory
+// of its own, and returns what it printed on stdout and its exit code.
+func runCLI(t *testing.T, sim *simulator.Simulator, args ...string) (string, int) {
+	t.Helper()
+
+	return runCLIWith(t, sim, t.TempDir(), nil, args...)
+}
+
+// runCLIWith runs the CLI like runCLI, with home as its configuration
+// directory and env added to its environment.
+func runCLIWith(t *testing.T, sim *simulator.Simulator, home string, env []string, args ...string) (string, int) {
+	t.Helper()
+
+	args = append(args, "-insecure")
+
+	command := exec.Command(os.Args[0])
+	command.Env = append(os.Environ(),
+		cliEnv+"="+strings.Join(args, "\n"),
+		"HOME="+home,
+		"XDG_CONFIG_HOME="+home,
+		services.ENV_FQDN+"="+sim.Address(),
+		services.ENV_USERNAME+"=admin",
+		services.ENV_PASSWORD+"=admin")
+	command.Env = append(command.Env, env...)
+
+	var stdout, stderr bytes.Buffer
+	command.Stdout = &stdout
+	command.Stderr = &stderr
+
+	code := services.EXIT_SUCCESS
+	var exitError *exec.ExitError
+	if err := command.Run(); errors.As(err, &exitError) {
+		code = exitError.ExitCode()
+	} else if err != nil {
+		t.Fatalf("failed to run the CLI: %v", err)
+	}
+
+	if code != services.EXIT_SUCCESS {
+		t.Logf("%s exited with %d:\n%s%s", strings.Join(args, " "), code, stdout.String(), stderr.String())
+	}
+
+	return stdout.String(), code
+}
+
+// polling watches the tasks of the simulator without waiting seconds between
+// polls.
+var polling = services.MonitorOptions{Interval: 20 * time.Millisecond, MaxInterval: 100 * time.Millisecond, Retries: 2}
+
+// startSimulator starts a simulator for the test and returns it together with
+// a client authenticated against it.
+func startSimulator(t *testing.T, options simulator.Options) (*simulator.Simulator, *services.Client) {
+	t.Helper()
+
+	sim := simulator.New(options)
+	t.Cleanup(sim.Close)
+
+	client, err := sim.Client()
+	if err != nil {
+		t.Fatalf("failed to authenticate with the simulator: %v", err)
+	}
+
+	client.SetRetryOptions(services.RetryOptions{MaxRetries: 2, BaseDelay: 10 * time.Millisecond, MaxDelay: 50 * time.Millisecond})
+	return sim, client
+}
+
+// sessionClient returns a client without credentials holding the session of
+// client, so that it can only renew it with the refresh token.
+func sessionClient(t *testing.T, sim *simulator.Simulator, client *services.Client) *services.Client {
+	t.Helper()
+
+	renewing, err := services.NewClient(services.Request{URL: sim.Address()})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := renewing.SetTLSOptions(services.TLSOptions{Insecure: true, KnownHostsFile: os.DevNull}); err != nil {
+		t.Fatal(err)
+	}
+
+	renewing.UseSession(client.Session())
+	return renewing
+}
+
+// watch waits for the task submitted by an operation that returned err.
+func watch(t *testing.T, client *services.Client, tasks services.Tasks, err error) (string, error) {
+	t.Helper()
+
+	if err != nil {
+		t.Fatalf("failed to submit the task: %v", err)
+	}
+
+	return client.WatchTask(tasks.TaskID, polling)
+}
+
+// registerVCenter registers the simulator as the vCenter name, with a
+// service account of the same name, and scans its virtual machines.
+func registerVCenter(t *testing.T, sim *simulator.Simulator, client *services.Client, name string) {
+	t.Helper()
+
+	if _, err := client.CreateServiceAccount("administrator@vsphere.local", "secret", name); err != nil {
+		t.Fatalf("failed to create the service account: %v", err)
+	}
+
+	tasks, err := client.RegisterVCenter(sim.Address(), name, name)
+	if _, err := watch(t, client, tasks, err); err != nil {
+		t.Fatalf("failed to register the vCenter: %v", err)
+	}
+
+	tasks, err = client.ScanVirtualMachines(name, "")
+	if _, err := watch(t, client, tasks, err); err != nil {
+		t.Fatalf("failed to scan the virtual machines: %v", err)
+	}
+}
@@ -2,8 +2,18 @@ package services
 
 import (
 	"encoding/json"
+	"errors"
+	"flag"
 	"fmt"
+	"net"
+	neturl "net/url"
 	"os"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"gitlab.eng.vmware.com/vmware-navigator-practice/tooling/tanzu-apptx-cli/render"
 )
 
 type Tasks struct {
@@ -11,31 +21,587 @@ type Tasks struct {
 }
 
 type TaskResponse struct {
-	Status string `json:"status"`
+	ID              string    `json:"id"`
+	Type            string    `json:"type"`
+	Status          string    `json:"status"`
+	Message         string    `json:"message,omitempty"`
+	Created         Timestamp `json:"created"`
+	LastUpdated     Timestamp `json:"lastUpdated"`
+	PercentComplete float64   `json:"percentComplete,omitempty"`
+	SubTasks        []struct {
+		Status string `json:"status"`
+	} `json:"subTasks,omitempty"`
+}
+
+// MonitorOptions controls how WatchTask polls a task.
+type MonitorOptions struct {
+	// Interval is the delay before the second poll. It doubles after every
+	// poll up to MaxInterval.
+	Interval    time.Duration
+	MaxInterval time.Duration
+	// Timeout stops waiting once exceeded. Zero waits until the task finishes.
+	Timeout time.Duration
+	// Retries is the number of consecutive failed polls tolerated.
+	Retries int
+	// Progress, when set, is called after every successful poll.
+	Progress func(taskID string, task TaskResponse, elapsed time.Duration)
+}
+
+// DefaultMonitorOptions returns the polling settings used by MonitorTask.
+func DefaultMonitorOptions() MonitorOptions {
+	return MonitorOptions{Interval: 2 * time.Second, MaxInterval: 30 * time.Second, Retries: 5}
+}
+
+// GetTask returns the current state of the task.
+func (client *Client) GetTask(taskID string) (taskResponse TaskResponse, err error) {
+	url := client.discoveryURL(TASKS, taskID)
+	err = client.expect("GET", url, nil, &taskResponse, 200)
+	return taskResponse, err
+}
+
+// ListTasks returns the tasks matching filter, most recent first. The pages
+// are read until options.Limit tasks match, as the appliance filters neither
+// by age nor, on every version, by status and type.
+func (client *Client) ListTasks(filter TaskFilter, options ListOptions) (tasks []TaskResponse, err error) {
+	query := neturl.Values{}
+	query.Set("sort", "created,DESC")
+
+	if len(filter.Status) > 0 {
+		query.Set("status", filter.Status)
+	}
+
+	if len(filter.Type) > 0 {
+		query.Set("type", filter.Type)
+	}
+
+	_, err = client.paginateUntil(client.discoveryURL(TASKS), query, options, func(body []byte) (Pagination, int, error) {
+		page := TaskListResponse{}
+		err := json.Unmarshal(body, &page)
+
+		for _, task := range page.Embedded.Tasks {
+			if len(filter.Status) > 0 && !strings.EqualFold(task.Status, filter.Status) {
+				continue
+			}
+
+			if len(filter.Type) > 0 && !strings.EqualFold(task.Type, filter.Type) {
+				continue
+			}
+
+			if filter.MaxAge > 0 && !task.Created.IsZero() && time.Since(task.Created.Time) > filter.MaxAge {
+				continue
+			}
+
+			tasks = append(tasks, task)
+		}
+
+		return page.Pagination, len(page.Embedded.Tasks), err
+	}, func(read int) bool {
+		return options.Limit > 0 && len(tasks) >= options.Limit
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return tasks[:options.limit(len(tasks))], nil
+}
+
+// CancelTask asks the appliance to stop a running task. The task finishes
+// with the status CANCELLED.
+func (client *Client) CancelTask(taskID string) error {
+	url := client.discoveryURL(TASKS, taskID, CANCEL)
+	return client.expect("POST", url, nil, nil, 200, 202, 204)
 }
 
-func (task Tasks) MonitorTask(token string, taskID string, request Request) (status string) {
-	task_status := "NOT_STARTED"
-	exitLoop := false
+// MonitorTask waits for the task to finish and returns its final status. A
+// status other than SUCCESS is also reported as a *TaskError.
+func (client *Client) MonitorTask(taskID string) (status string, err error) {
+	return client.WatchTask(taskID, DefaultMonitorOptions())
+}
 
-	for !exitLoop {
-		url := PROTOCOL + "://" + request.URL + "/" + PREFIX + "/" + TASKS + "/" + taskID
-		body, _ := processRequest(token, url, "GET", nil)
+// WatchTask polls the task with exponential backoff until it finishes and
+// returns its final status. A status other than SUCCESS is reported as a
+// *TaskError, running out of time as a *TaskTimeoutError.
+func (client *Client) WatchTask(taskID string, options MonitorOptions) (status string, err error) {
+	start := time.Now()
+	interval := options.Interval
+	if interval <= 0 {
+		interval = time.Second
+	}
+	if options.MaxInterval < interval {
+		options.MaxInterval = interval
+	}
+	failures := 0
+	status = "NOT_STARTED"
 
-		taskResponse := TaskResponse{}
-		err := json.Unmarshal(body, &taskResponse)
+	for {
+		taskResponse, err := client.GetTask(taskID)
 		if err != nil {
-			fmt.Println("Failed to parse the response body.\n[ERROR] -", err)
-			os.Exit(1)
+			failures++
+			if !isTransient(err) || failures > options.Retries {
+				return status, err
+			}
+		} else {
+			failures = 0
+			status = taskResponse.Status
+
+			if options.Progress != nil {
+				options.Progress(taskID, taskResponse, time.Since(start))
+			}
+
+			if status != "IN_PROGRESS" && status != "NOT_STARTED" {
+				break
+			}
+		}
+
+		delay := interval
+		if options.Timeout > 0 {
+			remaining := options.Timeout - time.Since(start)
+			if remaining <= 0 {
+				return status, &TaskTimeoutError{TaskID: taskID, Status: status, Timeout: options.Timeout}
+			}
+			if delay > remaining {
+				delay = remaining
+			}
+		}
+
+		time.Sleep(delay)
+
+		interval *= 2
+		if interval > options.MaxInterval {
+			interval = options.MaxInterval
+		}
+	}
+
+	if status != "SUCCESS" {
+		return status, &TaskError{TaskID: taskID, Status: status}
+	}
+
+	return status, nil
+}
+
+// isTransient reports whether a failed request is worth retrying: network
+// errors, throttling and server errors.
+func isTransient(err error) bool {
+	var apiError *APIError
+	if errors.As(err, &apiError) {
+		return apiError.StatusCode == 429 || apiError.StatusCode >= 500
+	}
+
+	var netError net.Error
+	return errors.As(err, &netError)
+}
+
+// submitted decodes the task accepted by the appliance for an asynchronous
+// operation.
+func (client *Client) submitted(method string, url string, payload interface{}) (tasks Tasks, err error) {
+	err = client.expect(method, url, payload, &tasks, 202)
+	return tasks, err
+}
+
+// monitorOptions holds the polling flags of the operation being executed.
+var monitorOptions = DefaultMonitorOptions()
+
+// noWait holds the flag that makes an operation return as soon as its task is
+// submitted.
+var noWait bool
+
+// addMonitorFlags registers the flags of operations that submit a task.
+func addMonitorFlags(flagSet *flag.FlagSet) {
+	flagSet.BoolVar(&noWait, "no-wait", false, "Print the task ID and exit without waiting for the task to finish")
+	addOutputFlags(flagSet)
+	addPollFlags(flagSet)
+}
+
+// addPollFlags registers the task polling flags on the flag set.
+func addPollFlags(flagSet *flag.FlagSet) {
+	flagSet.DurationVar(&monitorOptions.Interval, "poll-interval", monitorOptions.Interval, "Initial delay between task status polls, doubled after every poll")
+	flagSet.DurationVar(&monitorOptions.MaxInterval, "poll-max-interval", monitorOptions.MaxInterval, "Maximum delay between task status polls")
+	flagSet.DurationVar(&monitorOptions.Timeout, "timeout", monitorOptions.Timeout, "Stop waiting for the task after this long, ex: 30m (Default: wait until the task finishes)")
+}
+
+// monitorTask prints the submitted task and waits for it to finish, showing
+// its progress. The task ID goes to stderr with -output json to keep stdout
+// parseable.
+func monitorTask(client *Client, tasks Tasks) (status string, err error) {
+	out := os.Stdout
+	if outputMode == "json" {
+		out = os.Stderr
+	}
+
+	fmt.Fprintln(out, "Submitted the request and the taskID is:", tasks.TaskID)
+	return watchTask(client, tasks.TaskID)
+}
+
+// waitForTasks waits for all the tasks at once and prints the final status of
+// each. It returns the first error of a task that did not succeed.
+func waitForTasks(client *Client, taskIDs []string) error {
+	statuses := make([]string, len(taskIDs))
+	failures := make([]error, len(taskIDs))
+
+	var mutex sync.Mutex
+	var waitGroup sync.WaitGroup
+
+	for i, taskID := range taskIDs {
+		waitGroup.Add(1)
+
+		go func(i int, taskID string) {
+			defer waitGroup.Done()
+
+			statuses[i], failures[i] = client.WatchTask(taskID, monitorOptions)
+
+			mutex.Lock()
+			fmt.Fprintf(os.Stderr, "Task %s finished with status %s\n", taskID, statuses[i])
+			mutex.Unlock()
+		}(i, taskID)
+	}
+
+	waitGroup.Wait()
+
+	var failure error
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 1, ' ', tabwriter.AlignRight|tabwriter.Debug)
+	fmt.Fprintln(w, "Task ID\tStatus\tError")
+	for i, taskID := range taskIDs {
+		message := ""
+		if _, failed := failures[i].(*TaskError); failures[i] != nil && !failed {
+			message = failures[i].Error()
+		}
+		if failures[i] != nil && failure == nil {
+			failure = failures[i]
+		}
+		fmt.Fprintln(w, taskID, "\t", statuses[i], "\t", message)
+	}
+	w.Flush()
+
+	return failure
+}
+
+// watchTask waits for the task to finish, showing its progress.
+func watchTask(client *Client, taskID string) (status string, err error) {
+	options := monitorOptions
+	progress := newProgressLine()
+	options.Progress = progress.update
+
+	status, err = client.WatchTask(taskID, options)
+	progress.done()
+
+	return status, err
+}
+
+// progressLine renders the state of a task on stderr. On a terminal the line
+// is redrawn in place, otherwise a line is printed whenever the state changes.
+type progressLine struct {
+	terminal bool
+	last     string
+}
+
+func newProgressLine() *progressLine {
+	info, err := os.Stderr.Stat()
+	return &progressLine{terminal: err == nil && info.Mode()&os.ModeCharDevice != 0}
+}
+
+func (progress *progressLine) update(taskID string, task TaskResponse, elapsed time.Duration) {
+	state := task.Status
+
+	if task.PercentComplete > 0 {
+		state += fmt.Sprintf(" %.0f%%", task.PercentComplete)
+	}
+
+	if len(task.SubTasks) > 0 {
+		completed := 0
+		for _, subTask := range task.SubTasks {
+			if subTask.Status != "IN_PROGRESS" && subTask.Status != "NOT_STARTED" {
+				completed++
+			}
+		}
+		state += fmt.Sprintf(" (%d/%d sub-tasks)", completed, len(task.SubTasks))
+	}
+
+	line := fmt.Sprintf("Task %s: %s, elapsed %s", taskID, state, elapsed.Round(time.Second))
+
+	if progress.terminal {
+		fmt.Fprint(os.Stderr, "\r\033[K"+line)
+		progress.last = line
+	} else if state != progress.last {
+		fmt.Fprintln(os.Stderr, line)
+		progress.last = state
+	}
+}
+
+func (progress *progressLine) done() {
+	if progress.terminal && len(progress.last) > 0 {
+		fmt.Fprintln(os.Stderr)
+	}
+	progress.last = ""
+}
+
+// progressBoard renders the state of several tasks running at once on
+// stderr. On a terminal it redraws a line per item in flight under a count of
+// the items done, otherwise a line is printed whenever an item changes state.
+type progressBoard struct {
+	terminal bool
+	verb     string
+	total    int
+	finished int
+	failed   int
+	states   map[string]string
+	order    []string
+	drawn    int
+	mutex    sync.Mutex
+}
+
+// newProgressBoard returns a board for total items, counted as '<verb> 3 of
+// 10'.
+func newProgressBoard(total int, verb string) *progressBoard {
+	return &progressBoard{terminal: newProgressLine().terminal, verb: verb, total: total, states: map[string]string{}}
+}
+
+// set shows the state of the item.
+func (board *progressBoard) set(item string, state string) {
+	board.mutex.Lock()
+	defer board.mutex.Unlock()
+
+	if _, found := board.states[item]; !found {
+		board.order = append(board.order, item)
+	}
+	if board.states[item] == state {
+		return
+	}
+	board.states[item] = state
+
+	if board.terminal {
+		board.draw()
+	} else {
+		fmt.Fprintf(os.Stderr, "%s: %s\n", item, state)
+	}
+}
+
+// tracker returns the MonitorOptions.Progress of the task of the item.
+func (board *progressBoard) tracker(item string) func(taskID string, task TaskResponse, elapsed time.Duration) {
+	return func(taskID string, task TaskResponse, elapsed time.Duration) {
+		state := "task " + taskID + " " + task.Status
+		if task.PercentComplete > 0 {
+			state += fmt.Sprintf(" %.0f%%", task.PercentComplete)
+		}
+		board.set(item, state)
+	}
+}
+
+// finish removes the item from the board and counts it as done.
+func (board *progressBoard) finish(item string, status string, err error) {
+	board.mutex.Lock()
+	defer board.mutex.Unlock()
+
+	board.finished++
+	if err != nil {
+		board.failed++
+	}
+
+	delete(board.states, item)
+	for i := range board.order {
+		if board.order[i] == item {
+			board.order = append(board.order[:i], board.order[i+1:]...)
+			break
+		}
+	}
+
+	if board.terminal {
+		board.draw()
+	} else if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %s, %v (%s %d of %d)\n", item, status, err, board.verb, board.finished, board.total)
+	} else {
+		fmt.Fprintf(os.Stderr, "%s: %s (%s %d of %d)\n", item, status, board.verb, board.finished, board.total)
+	}
+}
+
+// draw replaces the lines drawn before with the current state.
+func (board *progressBoard) draw() {
+	var buffer strings.Builder
+	if board.drawn > 0 {
+		fmt.Fprintf(&buffer, "\033[%dA", board.drawn)
+	}
+
+	fmt.Fprintf(&buffer, "\r\033[K%s %d of %d", board.verb, board.finished, board.total)
+	if board.failed > 0 {
+		fmt.Fprintf(&buffer, ", %d failed", board.failed)
+	}
+	buffer.WriteString("\n")
+
+	for _, item := range board.order {
+		fmt.Fprintf(&buffer, "\r\033[K  %s: %s\n", item, board.states[item])
+	}
+	buffer.WriteString("\033[J")
+
+	board.drawn = 1 + len(board.order)
+	fmt.Fprint(os.Stderr, buffer.String())
+}
+
+type TasksCommand struct {
+	url          string
+	username     string
+	password     string
+	taskID       string
+	taskIDs      []string
+	filter       TaskFilter
+	listOptions  ListOptions
+	listFormat   render.Format
+	outputFormat string
+	operation    string
+}
+
+func (tasksCommand TasksCommand) Execute() {
+	tasksCommand = tasksCommand.validate()
+
+	request := Request{tasksCommand.url, tasksCommand.username, tasksCommand.password}
+	client := authenticate(request)
+
+	switch tasksCommand.operation {
+	case LIST:
+		tasks, err := client.ListTasks(tasksCommand.filter, tasksCommand.listOptions)
+		exitOnError("Failed to fetch the list of tasks", err)
+
+		table := render.Table{Columns: []render.Column{
+			{Header: "Task ID", Key: "id"},
+			{Header: "Type", Key: "type"},
+			{Header: "Status", Key: "status"},
+			{Header: "Created", Key: "created"},
+			{Header: "Last Updated", Key: "lastUpdated"},
+		}}
+		for _, task := range tasks {
+			table.Rows = append(table.Rows, []string{task.ID, task.Type, task.Status, task.Created.String(), task.LastUpdated.String()})
+		}
+
+		printList(tasksCommand.listFormat, render.List{Document: tasks, Items: tasks, Table: table}, len(tasks), Pagination{}, "tasks")
+	case GET:
+		task, err := client.GetTask(tasksCommand.taskID)
+		exitOnError("Failed to fetch the task", err)
+
+		if len(task.ID) == 0 {
+			task.ID = tasksCommand.taskID
+		}
+
+		if tasksCommand.outputFormat == "json" {
+			prettyJSON, err := json.MarshalIndent(task, "", "    ")
+			exitOnError("Failed to generate json", err)
+			fmt.Printf("%s\n", string(prettyJSON))
+		} else {
+			w := tabwriter.NewWriter(os.Stdout, 0, 0, 1, ' ', 0)
+			fmt.Fprintln(w, "Task ID:\t", task.ID)
+			fmt.Fprintln(w, "Type:\t", task.Type)
+			fmt.Fprintln(w, "Status:\t", task.Status)
+			fmt.Fprintln(w, "Message:\t", task.Message)
+			fmt.Fprintln(w, "Created:\t", task.Created)
+			fmt.Fprintln(w, "Last Updated:\t", task.LastUpdated)
+			if task.PercentComplete > 0 {
+				fmt.Fprintf(w, "Progress:\t %.0f%%\n", task.PercentComplete)
+			}
+			for i, subTask := range task.SubTasks {
+				fmt.Fprintf(w, "Sub-task %d:\t %s\n", i+1, subTask.Status)
+			}
+			w.Flush()
 		}
+	case WATCH:
+		status, err := watchTask(client, tasksCommand.taskID)
+		exitOnError("Task "+tasksCommand.taskID+" did not finish successfully", err)
+		fmt.Println("Task", tasksCommand.taskID, "finished with status", status)
+	case WAIT:
+		err := waitForTasks(client, tasksCommand.taskIDs)
+		os.Exit(exitCode(err))
+	case CANCEL:
+		err := client.CancelTask(tasksCommand.taskID)
+		report(tasksCommand.taskID, err, "Failed to cancel the task", "Requested cancellation of task "+tasksCommand.taskID)
+	default:
+		fmt.Println("Operation not supported")
+		tasksCommand.printUsage()
+	}
+}
+
+func (tasksCommand TasksCommand) validate() TasksCommand {
+	listCmd := NewFlagSet(LIST)
+	getCmd := NewFlagSet(GET)
+	watchCmd := NewFlagSet(WATCH)
+	cancelCmd := NewFlagSet(CANCEL)
+	waitCmd := NewFlagSet(WAIT)
+
+	if len(os.Args) < 3 {
+		tasksCommand.printUsage()
+	}
+
+	operation := os.Args[2]
+
+	var url string
+	var username string
+	var password string
+	var taskID string
+	var taskIDs []string
+	var filter TaskFilter
+	var listOptions ListOptions
+	var listFormat render.Format
+	var format string
 
-		task_status = taskResponse.Status
+	if operation == LIST {
+		connection := addConnectionFlags(listCmd)
+		listCmd.StringVar(&filter.Status, "status", "", "Task status, ex: IN_PROGRESS, SUCCESS, FAILED")
+		listCmd.StringVar(&filter.Type, "type", "", "Task type")
+		listCmd.DurationVar(&filter.MaxAge, "max-age", 0, "Only tasks created within this duration, ex: 24h")
+		addFormatFlag(listCmd, &listFormat)
+		addListFlags(listCmd, &listOptions)
 
-		if task_status != "IN_PROGRESS" && task_status != "NOT_STARTED" {
-			exitLoop = true
+		listCmd.Parse(os.Args[3:])
+		url, username, password = connection.resolve()
+
+		if !hasCredentials(url, username, password) ||
+			(strings.Contains(url, "https://")) {
+			fmt.Printf("Usage: '%s %s %s [flags]' \n", CLI_NAME, TASKS_CMD, LIST)
+			fmt.Println("Available Flags:")
+			listCmd.PrintDefaults()
+			os.Exit(EXIT_USAGE)
 		}
+	} else if operation == GET || operation == WATCH || operation == CANCEL {
+		cmd := map[string]*flag.FlagSet{GET: getCmd, WATCH: watchCmd, CANCEL: cancelCmd}[operation]
 
+		connection := addConnectionFlags(cmd)
+		if operation == GET {
+			cmd.StringVar(&format, "output-format", "table", "Output format - (json,table) (Default: table)")
+		} else if operation == WATCH {
+			addPollFlags(cmd)
+		} else {
+			addOutputFlags(cmd)
+		}
+
+		args := parseArgs(cmd, os.Args[3:])
+		url, username, password = connection.resolve()
+
+		if !hasCredentials(url, username, password) || len(args) != 1 ||
+			(strings.Contains(url, "https://")) {
+			fmt.Printf("Usage: '%s %s %s [task-id] [flags]' \n", CLI_NAME, TASKS_CMD, operation)
+			fmt.Println("Available Flags:")
+			cmd.PrintDefaults()
+			os.Exit(EXIT_USAGE)
+		}
+
+		taskID = args[0]
+	} else if operation == WAIT {
+		connection := addConnectionFlags(waitCmd)
+		addPollFlags(waitCmd)
+
+		taskIDs = parseArgs(waitCmd, os.Args[3:])
+		url, username, password = connection.resolve()
+
+		if !hasCredentials(url, username, password) || len(taskIDs) == 0 ||
+			(strings.Contains(url, "https://")) {
+			fmt.Printf("Usage: '%s %s %s [task-id...] [flags]' \n", CLI_NAME, TASKS_CMD, WAIT)
+			fmt.Println("Available Flags:")
+			waitCmd.PrintDefaults()
+			os.Exit(EXIT_USAGE)
+		}
+	} else {
+		tasksCommand.printUsage()
 	}
 
-	return task_status
+	tasksCommand = TasksCommand{url, username, password, taskID, taskIDs, filter, listOptions, listFormat, format, operation}
+	return tasksCommand
+}
+
+func (tasksCommand TasksCommand) printUsage() {
+	PrintCommandUsage(TASKS_CMD, EXIT_USAGE)
 }
@@ -0,0 +1,50 @@
+package services_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"gitlab.eng.vmware.com/vmware-navigator-practice/tooling/tanzu-apptx-cli/services"
+	"gitlab.eng.vmware.com/vmware-navigator-practice/tooling/tanzu-apptx-cli/simulator"
+)
+
+func TestCancelTask(t *testing.T) {
+	sim, client := startSimulator(t, simulator.Options{TaskDuration: 300 * time.Millisecond})
+	registerVCenter(t, sim, client, "vc1")
+
+	tasks, err := client.SyncVCenter("vc1", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := client.CancelTask(tasks.TaskID); err != nil {
+		t.Fatalf("failed to cancel the task: %v", err)
+	}
+
+	var taskError *services.TaskError
+	if status, err := client.WatchTask(tasks.TaskID, polling); status != "CANCELLED" || !errors.As(err, &taskError) {
+		t.Errorf("expected the task to be cancelled, got %s: %v", status, err)
+	}
+
+	var apiError *services.APIError
+	if err := client.CancelTask(tasks.TaskID); !errors.As(err, &apiError) || apiError.StatusCode != 409 {
+		t.Errorf("expected a finished task to be reported as a conflict, got %v", err)
+	}
+	if err := client.CancelTask("task-unknown"); !errors.As(err, &apiError) || apiError.StatusCode != 404 {
+		t.Errorf("expected an unknown task to be reported as not found, got %v", err)
+	}
+
+	tasks, err = client.ScanComponents("vc1", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, code := runCLI(t, sim, services.TASKS_CMD, services.CANCEL, tasks.TaskID); code != services.EXIT_SUCCESS {
+		t.Errorf("expected the task to be cancelled, got exit code %d", code)
+	}
+	if _, code := runCLI(t, sim, services.TASKS_CMD, services.CANCEL, tasks.TaskID); code != services.EXIT_CONFLICT {
+		t.Errorf("expected exit code %d for a finished task, got %d", services.EXIT_CONFLICT, code)
+	}
+	if _, code := runCLI(t, sim, services.TASKS_CMD, services.CANCEL); code != services.EXIT_USAGE {
+		t.Errorf("expected exit code %d without a task, got %d", services.EXIT_USAGE, code)
+	}
+}
@@ -0,0 +1,194 @@
+package services
+
+import (
+	"bufio"
+	"crypto/tls"
+	"encoding/base64"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// TransportOptions controls how the client connects to the appliance, the
+// vCenters and the vRNI instances.
+type TransportOptions struct {
+	// Proxy is the URL of the proxy every request goes through, ex:
+	// http://proxy.example.com:3128. When empty, the HTTPS_PROXY and NO_PROXY
+	// environment variables are honoured.
+	Proxy string
+	// ConnectTimeout bounds establishing a connection, TLS handshake included.
+	ConnectTimeout time.Duration
+	// ReadTimeout bounds a request to the appliance, from sending it to
+	// reading the whole response body.
+	ReadTimeout time.Duration
+}
+
+// DefaultTransportOptions returns the transport settings of a new client.
+func DefaultTransportOptions() TransportOptions {
+	return TransportOptions{ConnectTimeout: 30 * time.Second, ReadTimeout: 5 * time.Minute}
+}
+
+// transportOptions holds the transport settings resolved for the operation
+// being executed.
+var transportOptions = DefaultTransportOptions()
+
+// SetTransportOptions changes the proxy and the timeouts of the client.
+func (client *Client) SetTransportOptions(options TransportOptions) error {
+	transport, err := newTransport(client.trust, client.URL, options)
+	if err != nil {
+		return err
+	}
+
+	client.transportOptions = options
+	client.setTransport(transport)
+	return nil
+}
+
+// setTransport replaces the transport shared by the requests of the client,
+// closing the idle connections of the previous one.
+func (client *Client) setTransport(transport *http.Transport) {
+	if client.transport != nil {
+		client.transport.CloseIdleConnections()
+	}
+
+	client.transport = transport
+	client.httpClient = client.getHTTPSClient()
+}
+
+// newTransport returns the transport of a client. It keeps the connections
+// alive for the following requests, negotiates HTTP/2 and asks for gzip
+// compressed responses.
+func newTransport(trust *trustStore, address string, options TransportOptions) (*http.Transport, error) {
+	proxy, err := proxyFunc(options.Proxy)
+	if err != nil {
+		return nil, err
+	}
+
+	dialer := &net.Dialer{Timeout: options.ConnectTimeout, KeepAlive: 30 * time.Second}
+
+	return &http.Transport{
+		Proxy:                 proxy,
+		DialContext:           dialer.DialContext,
+		TLSClientConfig:       trust.config(address),
+		TLSHandshakeTimeout:   options.ConnectTimeout,
+		ResponseHeaderTimeout: options.ReadTimeout,
+		ForceAttemptHTTP2:     true,
+		MaxIdleConns:          100,
+		MaxIdleConnsPerHost:   16,
+		IdleConnTimeout:       90 * time.Second,
+		ExpectContinueTimeout: time.Second,
+	}, nil
+}
+
+// proxyFunc returns the proxy of the requests, the proxy URL when one is
+// given and otherwise the proxy of the environment.
+func proxyFunc(proxy string) (func(*http.Request) (*url.URL, error), error) {
+	if len(proxy) == 0 {
+		return http.ProxyFromEnvironment, nil
+	}
+
+	if !strings.Contains(proxy, "://") {
+		proxy = "http://" + proxy
+	}
+
+	proxyURL, err := url.Parse(proxy)
+	if err != nil || len(proxyURL.Host) == 0 {
+		return nil, fmt.Errorf("invalid proxy %q, expected a URL such as http://proxy.example.com:3128", proxy)
+	}
+
+	return http.ProxyURL(proxyURL), nil
+}
+
+// dialTLS opens a TLS connection to address, through the proxy of the
+// client when there is one, to read the certificate of a vCenter or a vRNI
+// instance.
+func (client *Client) dialTLS(address string) (*tls.Conn, error) {
+	dialer := &net.Dialer{Timeout: client.transportOptions.ConnectTimeout}
+
+	var proxyURL *url.URL
+	if client.transport != nil && client.transport.Proxy != nil {
+		request, err := http.NewRequest("CONNECT", "https://"+address, nil)
+		if err != nil {
+			return nil, err
+		}
+		if proxyURL, err = client.transport.Proxy(request); err != nil {
+			return nil, err
+		}
+	}
+
+	if proxyURL == nil {
+		return tls.DialWithDialer(dialer, "tcp", address, client.trust.config(address))
+	}
+
+	conn, err := dialer.Dial("tcp", canonicalProxyAddress(proxyURL))
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to the proxy %s: %w", proxyURL.Host, err)
+	}
+
+	if proxyURL.Scheme == "https" {
+		conn = tls.Client(conn, &tls.Config{ServerName: proxyURL.Hostname()})
+	}
+
+	if err := connectThroughProxy(conn, proxyURL, address, client.transportOptions.ConnectTimeout); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	tlsConn := tls.Client(conn, client.trust.config(address))
+	if client.transportOptions.ConnectTimeout > 0 {
+		tlsConn.SetDeadline(time.Now().Add(client.transportOptions.ConnectTimeout))
+		defer tlsConn.SetDeadline(time.Time{})
+	}
+	if err := tlsConn.Handshake(); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	return tlsConn, nil
+}
+
+// connectThroughProxy asks the proxy on conn to open a tunnel to address.
+func connectThroughProxy(conn net.Conn, proxyURL *url.URL, address string, timeout time.Duration) error {
+	if timeout > 0 {
+		conn.SetDeadline(time.Now().Add(timeout))
+		defer conn.SetDeadline(time.Time{})
+	}
+
+	request := "CONNECT " + address + " HTTP/1.1\r\nHost: " + address + "\r\n"
+	if proxyURL.User != nil {
+		password, _ := proxyURL.User.Password()
+		credentials := base64.StdEncoding.EncodeToString([]byte(proxyURL.User.Username() + ":" + password))
+		request += "Proxy-Authorization: Basic " + credentials + "\r\n"
+	}
+
+	if _, err := conn.Write([]byte(request + "\r\n")); err != nil {
+		return fmt.Errorf("failed to connect to %s through the proxy %s: %w", address, proxyURL.Host, err)
+	}
+
+	resp, err := http.ReadResponse(bufio.NewReader(conn), nil)
+	if err != nil {
+		return fmt.Errorf("failed to connect to %s through the proxy %s: %w", address, proxyURL.Host, err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("the proxy %s refused to connect to %s: %s", proxyURL.Host, address, resp.Status)
+	}
+
+	return nil
+}
+
+// canonicalProxyAddress returns the host and port of the proxy, with the
+// default port of its scheme when it has none.
+func canonicalProxyAddress(proxyURL *url.URL) string {
+	if len(proxyURL.Port()) > 0 {
+		return proxyURL.Host
+	}
+	if proxyURL.Scheme == "https" {
+		return net.JoinHostPort(proxyURL.Hostname(), "443")
+	}
+	return net.JoinHostPort(proxyURL.Hostname(), "80")
+}
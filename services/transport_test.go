@@ -0,0 +1,48 @@
+package services_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"gitlab.eng.vmware.com/vmware-navigator-practice/tooling/tanzu-apptx-cli/services"
+)
+
+func TestReadTimeoutBoundsTheBody(t *testing.T) {
+	stalled := make(chan struct{})
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte("["))
+		w.(http.Flusher).Flush()
+		select {
+		case <-stalled:
+		case <-r.Context().Done():
+		}
+	}))
+	defer server.Close()
+	defer close(stalled)
+
+	client, err := services.NewClient(services.Request{URL: strings.TrimPrefix(server.URL, "https://")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := client.SetTLSOptions(services.TLSOptions{Insecure: true, KnownHostsFile: os.DevNull}); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.SetTransportOptions(services.TransportOptions{ConnectTimeout: time.Second, ReadTimeout: 200 * time.Millisecond}); err != nil {
+		t.Fatal(err)
+	}
+	client.UseSession(services.Session{Username: "admin", Token: "token"})
+	client.SetRetryOptions(services.RetryOptions{})
+
+	start := time.Now()
+	if _, err := client.ListVRNIs(); err == nil {
+		t.Error("expected the stalled response body to time out")
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("expected the request to give up after the read timeout, waited %s", elapsed)
+	}
+}
@@ -0,0 +1,176 @@
+package services
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// TLSOptions controls how certificates presented by the appliance, vCenters
+// and vRNI instances are verified.
+type TLSOptions struct {
+	// CACertFile is a PEM bundle trusted in addition to the system trust store.
+	CACertFile string
+	// Insecure skips certificate chain verification. Fingerprints are still
+	// pinned in KnownHostsFile.
+	Insecure bool
+	// KnownHostsFile records the certificate fingerprint of every host on first
+	// use and refuses a different certificate later. Empty disables pinning.
+	KnownHostsFile string
+}
+
+// KnownHostsPath returns the default trust file, next to the configuration
+// file.
+func KnownHostsPath() (string, error) {
+	path, err := ConfigPath()
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(filepath.Dir(path), KNOWN_HOSTS_FILE), nil
+}
+
+type trustStore struct {
+	options TLSOptions
+	roots   *x509.CertPool
+	mutex   sync.Mutex
+}
+
+func newTrustStore(options TLSOptions) (*trustStore, error) {
+	roots, err := x509.SystemCertPool()
+	if err != nil {
+		roots = x509.NewCertPool()
+	}
+
+	if len(options.CACertFile) > 0 {
+		pem, err := ioutil.ReadFile(options.CACertFile)
+		if err != nil {
+			return nil, err
+		}
+
+		if !roots.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in %s", options.CACertFile)
+		}
+	}
+
+	return &trustStore{options: options, roots: roots}, nil
+}
+
+// config returns the TLS configuration for connections to address. Chain
+// verification is done by verify so that pinned certificates are accepted
+// even when they are not signed by a trusted CA.
+func (trust *trustStore) config(address string) *tls.Config {
+	return &tls.Config{
+		InsecureSkipVerify: true,
+		VerifyConnection: func(state tls.ConnectionState) error {
+			return trust.verify(address, state.PeerCertificates)
+		},
+	}
+}
+
+func (trust *trustStore) verify(address string, certificates []*x509.Certificate) error {
+	if len(certificates) == 0 {
+		return fmt.Errorf("%s did not present a certificate", address)
+	}
+
+	address = hostPort(address)
+	fingerprint := insertNth(strings.ToUpper(fmt.Sprintf("%x", sha256.Sum256(certificates[0].Raw))), 2)
+
+	trust.mutex.Lock()
+	defer trust.mutex.Unlock()
+
+	knownHosts, err := loadKnownHosts(trust.options.KnownHostsFile)
+	if err != nil {
+		return err
+	}
+
+	if known, found := knownHosts[address]; found {
+		if known != fingerprint {
+			return &CertificateMismatchError{Host: address, Expected: known, Actual: fingerprint, KnownHostsFile: trust.options.KnownHostsFile}
+		}
+		return nil
+	}
+
+	if !trust.options.Insecure {
+		host, _, _ := net.SplitHostPort(address)
+
+		intermediates := x509.NewCertPool()
+		for _, certificate := range certificates[1:] {
+			intermediates.AddCert(certificate)
+		}
+
+		_, err := certificates[0].Verify(x509.VerifyOptions{DNSName: host, Roots: trust.roots, Intermediates: intermediates})
+		if err != nil {
+			return fmt.Errorf("the certificate presented by %s is not trusted, pass -ca-cert with the issuing CA or -insecure to trust it on first use: %w", address, err)
+		}
+	}
+
+	return appendKnownHost(trust.options.KnownHostsFile, address, fingerprint)
+}
+
+// hostPort adds the HTTPS port to address when it has none.
+func hostPort(address string) string {
+	if _, _, err := net.SplitHostPort(address); err != nil {
+		return net.JoinHostPort(address, strconv.Itoa(HTTPS_PORT))
+	}
+	return address
+}
+
+// loadKnownHosts reads the trust file, one "host:port SHA256 fingerprint"
+// entry per line.
+func loadKnownHosts(path string) (knownHosts map[string]string, err error) {
+	knownHosts = map[string]string{}
+
+	if len(path) == 0 {
+		return knownHosts, nil
+	}
+
+	file, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return knownHosts, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) != 3 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		knownHosts[fields[0]] = fields[2]
+	}
+
+	return knownHosts, scanner.Err()
+}
+
+func appendKnownHost(path string, address string, fingerprint string) error {
+	if len(path) == 0 {
+		return nil
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+
+	defer file.Close()
+
+	_, err = fmt.Fprintf(file, "%s SHA256 %s\n", address, fingerprint)
+	return err
+}
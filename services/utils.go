@@ -2,89 +2,215 @@ package services
 
 import (
 	"bytes"
+	"context"
 	"crypto/md5"
 	"crypto/sha1"
 	"crypto/sha256"
 	"crypto/sha512"
-	"crypto/tls"
 	"encoding/json"
+	"flag"
 	"fmt"
 	"io/ioutil"
+	"net"
 	"net/http"
 	"os"
 	"strings"
+	"time"
 )
 
-func getHTTPSClient() *http.Client {
-	tr := &http.Transport{
-		TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+func (client *Client) getHTTPSClient() *http.Client {
+	var tr http.RoundTripper = client.transport
+
+	if client.cassette != nil {
+		tr = &cassetteTransport{next: tr, cassette: client.cassette}
+	}
+
+	if client.tracer != nil {
+		tr = &tracingTransport{next: tr, tracer: client.tracer}
 	}
 
-	client := &http.Client{Transport: tr}
+	return &http.Client{Transport: tr}
+}
+
+// Kinds of requests sent by send. API_REQUEST carries the session token and
+// is re-authenticated on 401. OPEN_SESSION opens a session: it is sent in
+// dry-run mode too, carries no token, is not re-authenticated on 401 and is
+// retried like an idempotent request as it changes nothing on the appliance.
+// CLOSE_SESSION carries the token it closes and is not re-authenticated
+// either, as a 401 means the session is already gone.
+const (
+	API_REQUEST = iota
+	OPEN_SESSION
+	CLOSE_SESSION
+)
 
-	return client
+func (client *Client) processRequest(method string, url string, payload interface{}) (body []byte, responseCode int, err error) {
+	body, resp, err := client.send(method, url, payload, API_REQUEST)
+	if resp != nil {
+		responseCode = resp.StatusCode
+	}
+	return body, responseCode, err
 }
 
-func processRequest(token string, url string, method string, payload interface{}) (body []byte, responseCode int) {
+// send issues the request, retrying it as the retry options allow, and returns
+// the response with its body read. kind is one of API_REQUEST, OPEN_SESSION
+// and CLOSE_SESSION.
+func (client *Client) send(method string, url string, payload interface{}, kind int) (body []byte, resp *http.Response, err error) {
+	session := kind == OPEN_SESSION
 
-	var req *http.Request
+	var reqBody []byte
 
 	if payload != nil {
-		reqBody, err := json.Marshal(payload)
-
+		reqBody, err = json.Marshal(payload)
 		if err != nil {
-			fmt.Println("Failed to parse the request payload.\n[ERROR] -", err)
-			os.Exit(1)
+			return nil, nil, fmt.Errorf("failed to parse the request payload: %w", err)
 		}
-		req, _ = http.NewRequest(method, url, bytes.NewBuffer(reqBody))
-	} else {
-		req, _ = http.NewRequest(method, url, nil)
 	}
 
-	req.Header.Add("Authorization", "Bearer "+token)
-	req.Header.Add("Content-Type", "application/json")
+	if client.dryRun != nil && method != "GET" && !session {
+		if err := client.printRequest(method, url, payload); err != nil {
+			return nil, nil, err
+		}
+		return nil, nil, ErrDryRun
+	}
+
+	idempotent := session || idempotentMethod(method)
+	reauthenticated := false
+
+	for attempt := 0; ; attempt++ {
+		client.limiter.wait()
+
+		// The deadline bounds reading the body too, which the response
+		// header timeout of the transport does not.
+		ctx, cancel := context.Background(), context.CancelFunc(func() {})
+		if client.transportOptions.ReadTimeout > 0 {
+			ctx, cancel = context.WithTimeout(ctx, client.transportOptions.ReadTimeout)
+		}
+
+		var req *http.Request
+		if payload != nil {
+			req, err = http.NewRequestWithContext(ctx, method, url, bytes.NewBuffer(reqBody))
+		} else {
+			req, err = http.NewRequestWithContext(ctx, method, url, nil)
+		}
+		if err != nil {
+			cancel()
+			return nil, nil, err
+		}
+
+		token := ""
+		if !session {
+			token = client.Token()
+			req.Header.Add("Authorization", "Bearer "+token)
+		}
+		req.Header.Add("Content-Type", "application/json")
+
+		resp, err = client.httpClient.Do(req)
+		if err == nil {
+			body, err = ioutil.ReadAll(resp.Body)
+			resp.Body.Close()
+			if err != nil {
+				cancel()
+				return nil, resp, fmt.Errorf("unable to parse HTTP response: %w", err)
+			}
+		}
+		cancel()
+
+		responseCode := 0
 
-	resp, err := getHTTPSClient().Do(req)
+		if err == nil {
+			responseCode = resp.StatusCode
+
+			if responseCode == 401 && kind == API_REQUEST && !reauthenticated && client.reauthenticate(token) == nil {
+				reauthenticated = true
+				attempt--
+				continue
+			}
+		}
+
+		if !client.retry.shouldRetry(idempotent, responseCode, err, attempt) {
+			if err != nil {
+				return nil, nil, fmt.Errorf("HTTP request failed: %w", err)
+			}
+			return body, resp, nil
+		}
+
+		time.Sleep(client.retry.delay(resp, attempt))
+	}
+}
+
+// expect issues the request and decodes the response into result when the
+// response code is one of the expected codes. Any other code is returned as
+// an *APIError.
+func (client *Client) expect(method string, url string, payload interface{}, result interface{}, codes ...int) error {
+	body, responseCode, err := client.processRequest(method, url, payload)
 	if err != nil {
-		fmt.Println("HTTP request failed.\n[ERROR] -", err)
-		os.Exit(1)
+		return err
 	}
 
-	defer resp.Body.Close()
+	expected := false
+	for _, code := range codes {
+		if responseCode == code {
+			expected = true
+		}
+	}
 
-	body, err = ioutil.ReadAll(resp.Body)
-	if err != nil {
-		fmt.Println("Unable to parse HTTP response.\n[ERROR] -", err)
-		os.Exit(1)
+	if !expected {
+		return &APIError{Method: method, URL: url, StatusCode: responseCode, Body: body}
 	}
 
-	return body, resp.StatusCode
+	if result != nil && len(body) > 0 {
+		if err := json.Unmarshal(body, result); err != nil {
+			return fmt.Errorf("failed to parse the response body: %w", err)
+		}
+	}
+
+	return nil
 }
 
-func getCertificateThumbprint(endpoint string, port int, checksum string) (thumprint string) {
+// getCertificateThumbprint returns the fingerprint of the certificate served
+// at endpoint. The port is only added when endpoint does not carry one.
+func (client *Client) getCertificateThumbprint(endpoint string, port int, checksum string) (thumprint string, err error) {
+
+	address := endpoint
+	if _, _, err := net.SplitHostPort(endpoint); err != nil {
+		address = fmt.Sprintf("%s:%d", endpoint, port)
+	}
+
+	fetch := func() ([]byte, error) {
+		conn, err := client.dialTLS(address)
+		if err != nil {
+			return nil, err
+		}
+
+		defer conn.Close()
+
+		return conn.ConnectionState().PeerCertificates[0].Raw, nil
+	}
 
-	conn, err := tls.Dial("tcp", fmt.Sprintf("%s:%d", endpoint, port), &tls.Config{InsecureSkipVerify: true})
+	var raw []byte
+	if client.cassette != nil {
+		raw, err = client.cassette.certificate(address, fetch)
+	} else {
+		raw, err = fetch()
+	}
 	if err != nil {
-		panic("failed to connect: " + err.Error())
+		return "", fmt.Errorf("failed to connect to %s: %w", endpoint, err)
 	}
 
 	var fingerprint string
 
-	cert := conn.ConnectionState().PeerCertificates[0]
-
 	if checksum == "md5" {
-		fingerprint = insertNth(strings.ToUpper(fmt.Sprintf("%x", md5.Sum(cert.Raw))), 2)
+		fingerprint = insertNth(strings.ToUpper(fmt.Sprintf("%x", md5.Sum(raw))), 2)
 	} else if checksum == "sha1" {
-		fingerprint = insertNth(strings.ToUpper(fmt.Sprintf("%x", sha1.Sum(cert.Raw))), 2)
+		fingerprint = insertNth(strings.ToUpper(fmt.Sprintf("%x", sha1.Sum(raw))), 2)
 	} else if checksum == "sha256" {
-		fingerprint = insertNth(strings.ToUpper(fmt.Sprintf("%x", sha256.Sum256(cert.Raw))), 2)
+		fingerprint = insertNth(strings.ToUpper(fmt.Sprintf("%x", sha256.Sum256(raw))), 2)
 	} else if checksum == "sha512" {
-		fingerprint = insertNth(strings.ToUpper(fmt.Sprintf("%x", sha512.Sum512(cert.Raw))), 2)
+		fingerprint = insertNth(strings.ToUpper(fmt.Sprintf("%x", sha512.Sum512(raw))), 2)
 	}
 
-	conn.Close()
-
-	return fingerprint
+	return fingerprint, nil
 }
 
 func insertNth(s string, n int) string {
@@ -99,3 +225,29 @@ func insertNth(s string, n int) string {
 	}
 	return buffer.String()
 }
+
+// parseArgs parses flags interleaved with positional arguments, ex:
+// 'get <id> -fqdn appliance.example.com', and returns the positional
+// arguments.
+func parseArgs(flagSet *flag.FlagSet, args []string) (positional []string) {
+	for {
+		flagSet.Parse(args)
+		args = flagSet.Args()
+
+		if len(args) == 0 {
+			return positional
+		}
+
+		positional = append(positional, args[0])
+		args = args[1:]
+	}
+}
+
+// exitOnError prints the message together with the error and exits when err
+// is not nil.
+func exitOnError(message string, err error) {
+	if err != nil {
+		printResult(Result{Operation: operationName(), Status: resultStatus(err)}, err, message)
+		os.Exit(exitCode(err))
+	}
+}
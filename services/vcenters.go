@@ -2,67 +2,91 @@ package services
 
 import (
 	"encoding/json"
-	"flag"
 	"fmt"
+	neturl "net/url"
 	"os"
 	"strings"
 )
 
 type VCenters struct {
-	url       string
-	username  string
-	password  string
-	saAlias   string
-	vcFqdn    string
-	vcName    string
-	operation string
+	url         string
+	username    string
+	password    string
+	saAlias     string
+	vcFqdn      string
+	vcName      string
+	fromFile    string
+	parallelism int
+	operation   string
 }
 
 func (vCenters VCenters) Execute() {
 	vCenters = vCenters.validate()
 
 	request := Request{vCenters.url, vCenters.username, vCenters.password}
-	authResponse := Authenticate(request)
+	client := authenticate(request)
+
+	target := firstNonEmpty(vCenters.vcName, vCenters.vcFqdn)
 
 	switch vCenters.operation {
 	case REGISTER:
-		vCenters.register(authResponse.Token, request)
+		if len(vCenters.fromFile) > 0 {
+			registrations, err := LoadVCenterRegistrations(vCenters.fromFile)
+			exitOnError("Failed to load the vCenters to register", err)
+
+			registerVCenters(client, registrations, vCenters.parallelism)
+			return
+		}
+
+		tasks, err := client.RegisterVCenter(vCenters.vcFqdn, vCenters.vcName, vCenters.saAlias)
+		finishTask(client, target, tasks, err,
+			"Failed to register vCenter with the provided information",
+			"",
+			"Successfully registered vCenter with the provided information")
 	case UNREGISTER:
-		vCenters.unregister(authResponse.Token, request)
+		err := client.UnregisterVCenter(vCenters.vcName, vCenters.vcFqdn)
+		report(target, err, "Failed to delete vCenter", "Successfully deleted vCenter")
 	case SYNC_VCENTERS:
-		vCenters.syncVcenters(authResponse.Token, request)
+		tasks, err := client.SyncVCenter(vCenters.vcName, vCenters.vcFqdn)
+		finishTask(client, target, tasks, err,
+			"Failed to execute sync on the vCenter provided",
+			"",
+			"Successfully executed sync on the vCenter provided")
 	case SCAN_VIRTUAL_MACHINES:
-		vCenters.scanVirtualMachines(authResponse.Token, request)
+		tasks, err := client.ScanVirtualMachines(vCenters.vcName, vCenters.vcFqdn)
+		finishTask(client, target, tasks, err,
+			"Failed to scan virtual machines managed by the provided vCenter",
+			"",
+			"Successfully scanned virtual machines managed by the provided vCenter")
 	case SCAN_COMPONENTS:
-		vCenters.scanComponents(authResponse.Token, request)
+		tasks, err := client.ScanComponents(vCenters.vcName, vCenters.vcFqdn)
+		finishTask(client, target, tasks, err,
+			"Failed to scan components running on the virtual machines managed by the provided vCenter",
+			"Partial Success in scanning components running on the virtual machines managed by the provided vCenter",
+			"Successfully scanned components running on the virtual machines managed by the provided vCenter")
 	case DISCOVER_TOPOLOGY:
-		vCenters.discoverTopology(authResponse.Token, request)
+		tasks, err := client.DiscoverTopology(vCenters.vcName, vCenters.vcFqdn)
+		finishTask(client, target, tasks, err,
+			"Failed to discover topology for the provided vCenter",
+			"",
+			"Successfully discovered topology for the provided vCenter")
 	default:
-		fmt.Println("Operation not supported \n")
+		fmt.Println("Operation not supported")
 		vCenters.printUsage()
-		os.Exit(1)
 	}
 }
 
 func (vCenters VCenters) printUsage() {
-	fmt.Printf("Usage: '%s %s [command]' \n", CLI_NAME, VCENTER_CMD)
-	fmt.Println("Available Commands:")
-	fmt.Printf("  %s \t\t\t%s \n", REGISTER, "Register vCenter instance")
-	fmt.Printf("  %s \t\t\t%s \n", UNREGISTER, "Remove vCenter instance")
-	fmt.Printf("  %s \t\t\t\t%s \n", SYNC_VCENTERS, "Sync vCenter inventory")
-	fmt.Printf("  %s \t%s \n", SCAN_VIRTUAL_MACHINES, "Scan for virtual machines managed by a vCenter")
-	fmt.Printf("  %s \t\t%s \n", SCAN_COMPONENTS, "Scan for components running on the virtual machines managed by a vCenter")
-	fmt.Printf("  %s \t\t%s \n", DISCOVER_TOPOLOGY, "Discover topology for the components running on the virtual machines managed by a vCenter")
-	os.Exit(1)
+	PrintCommandUsage(VCENTER_CMD, EXIT_USAGE)
 }
 
 func (vCenters VCenters) validate() VCenters {
-	registerCmd := flag.NewFlagSet(REGISTER, flag.ExitOnError)
-	unregisterCmd := flag.NewFlagSet(UNREGISTER, flag.ExitOnError)
-	syncVCenterCmd := flag.NewFlagSet(SYNC_VCENTERS, flag.ExitOnError)
-	scanVirtualMachinesCmd := flag.NewFlagSet(SCAN_VIRTUAL_MACHINES, flag.ExitOnError)
-	scanComponentsCmd := flag.NewFlagSet(SCAN_COMPONENTS, flag.ExitOnError)
-	discoverTopologyCmd := flag.NewFlagSet(DISCOVER_TOPOLOGY, flag.ExitOnError)
+	registerCmd := NewFlagSet(REGISTER)
+	unregisterCmd := NewFlagSet(UNREGISTER)
+	syncVCenterCmd := NewFlagSet(SYNC_VCENTERS)
+	scanVirtualMachinesCmd := NewFlagSet(SCAN_VIRTUAL_MACHINES)
+	scanComponentsCmd := NewFlagSet(SCAN_COMPONENTS)
+	discoverTopologyCmd := NewFlagSet(DISCOVER_TOPOLOGY)
 
 	if len(os.Args) < 3 {
 		vCenters.printUsage()
@@ -76,347 +100,288 @@ func (vCenters VCenters) validate() VCenters {
 	var vcFqdn string
 	var vcName string
 	var saAlias string
+	var fromFile string
+	var parallelism int
 
 	if operation == REGISTER {
-		registerCmd.StringVar(&url, "fqdn", "", "Application Transformer FQDN / IP, ex: appliance.example.com")
-		registerCmd.StringVar(&username, "username", "", "Application Transformer admin username")
-		registerCmd.StringVar(&password, "password", "", "Application Transformer admin password")
+		connection := addConnectionFlags(registerCmd)
+		addMonitorFlags(registerCmd)
 		registerCmd.StringVar(&vcFqdn, "vc-fqdn", "", "vCenter FQDN")
 		registerCmd.StringVar(&vcName, "vc-name", "", "vCenter Name")
 		registerCmd.StringVar(&saAlias, "sa-alias", "", "service account alias")
+		registerCmd.StringVar(&fromFile, "from-file", "", "CSV file with the columns fqdn, name, sa-alias and an optional thumbprint, or YAML list, of vCenters to register and sync")
+		registerCmd.IntVar(&parallelism, "parallelism", 4, "Number of vCenters of -from-file registered at once")
+		addJournalFlags(registerCmd)
 
 		registerCmd.Parse(os.Args[3:])
+		url, username, password = connection.resolve()
+
+		single := len(vcFqdn) > 0 && len(vcName) > 0 && len(saAlias) > 0 && len(journalPath+resumePath) == 0
+		bulk := len(fromFile) > 0 && len(vcFqdn) == 0 && len(vcName) == 0 && len(saAlias) == 0
 
-		if (len(url) == 0 || len(username) == 0 || len(password) == 0) ||
-			(len(vcFqdn) == 0 || len(vcName) == 0 || len(saAlias) == 0) ||
+		if bulk && noWait {
+			fmt.Println("-no-wait cannot be combined with -from-file, every vCenter is synced once its registration finishes")
+			bulk = false
+		}
+
+		if !hasCredentials(url, username, password) ||
+			!(single || bulk) || parallelism < 1 ||
 			(strings.Contains(url, "https://")) {
 			fmt.Printf("Usage: '%s %s %s [flags]' \n", CLI_NAME, VCENTER_CMD, REGISTER)
 			fmt.Println("Available Flags:")
 			registerCmd.PrintDefaults()
-			os.Exit(1)
+			os.Exit(EXIT_USAGE)
 		}
 	} else if operation == UNREGISTER {
-		unregisterCmd.StringVar(&url, "fqdn", "", "Application Transformer FQDN / IP, ex: appliance.example.com")
-		unregisterCmd.StringVar(&username, "username", "", "Application Transformer admin username")
-		unregisterCmd.StringVar(&password, "password", "", "Application Transformer admin password")
+		connection := addConnectionFlags(unregisterCmd)
 		unregisterCmd.StringVar(&vcFqdn, "vc-fqdn", "", "vCenter FQDN")
 		unregisterCmd.StringVar(&vcName, "vc-name", "", "vCenter Name")
+		addOutputFlags(unregisterCmd)
 		// saAlias = new(string)
 
 		unregisterCmd.Parse(os.Args[3:])
+		url, username, password = connection.resolve()
 
-		if (len(url) == 0 || len(username) == 0 || len(password) == 0) ||
+		if !hasCredentials(url, username, password) ||
 			(len(vcFqdn) == 0 && len(vcName) == 0) ||
 			(strings.Contains(url, "https://")) {
 			fmt.Printf("Usage: '%s %s %s [flags]' \n", CLI_NAME, VCENTER_CMD, UNREGISTER)
 			fmt.Println("Available Flags:")
 			unregisterCmd.PrintDefaults()
-			os.Exit(1)
+			os.Exit(EXIT_USAGE)
 		}
 	} else if operation == SYNC_VCENTERS {
-		syncVCenterCmd.StringVar(&url, "fqdn", "", "Application Transformer FQDN / IP, ex: appliance.example.com")
-		syncVCenterCmd.StringVar(&username, "username", "", "Application Transformer admin username")
-		syncVCenterCmd.StringVar(&password, "password", "", "Application Transformer admin password")
+		connection := addConnectionFlags(syncVCenterCmd)
+		addMonitorFlags(syncVCenterCmd)
 		syncVCenterCmd.StringVar(&vcFqdn, "vc-fqdn", "", "vCenter FQDN")
 		syncVCenterCmd.StringVar(&vcName, "vc-name", "", "vCenter Name")
 
 		syncVCenterCmd.Parse(os.Args[3:])
+		url, username, password = connection.resolve()
 
-		if (len(url) == 0 || len(username) == 0 || len(password) == 0) ||
+		if !hasCredentials(url, username, password) ||
 			(len(vcFqdn) == 0 && len(vcName) == 0) ||
 			(strings.Contains(url, "https://")) {
 			fmt.Printf("Usage: '%s %s %s [flags]' \n", CLI_NAME, VCENTER_CMD, SYNC_VCENTERS)
 			fmt.Println("Available Flags:")
 			syncVCenterCmd.PrintDefaults()
-			os.Exit(1)
+			os.Exit(EXIT_USAGE)
 		}
 	} else if operation == SCAN_VIRTUAL_MACHINES {
-		scanVirtualMachinesCmd.StringVar(&url, "fqdn", "", "Application Transformer FQDN / IP, ex: appliance.example.com")
-		scanVirtualMachinesCmd.StringVar(&username, "username", "", "Application Transformer admin username")
-		scanVirtualMachinesCmd.StringVar(&password, "password", "", "Application Transformer admin password")
+		connection := addConnectionFlags(scanVirtualMachinesCmd)
+		addMonitorFlags(scanVirtualMachinesCmd)
 		scanVirtualMachinesCmd.StringVar(&vcFqdn, "vc-fqdn", "", "vCenter FQDN")
 		scanVirtualMachinesCmd.StringVar(&vcName, "vc-name", "", "vCenter Name")
 
 		scanVirtualMachinesCmd.Parse(os.Args[3:])
+		url, username, password = connection.resolve()
 
-		if (len(url) == 0 || len(username) == 0 || len(password) == 0) ||
+		if !hasCredentials(url, username, password) ||
 			(len(vcFqdn) == 0 && len(vcName) == 0) ||
 			(strings.Contains(url, "https://")) {
 			fmt.Printf("Usage: '%s %s %s [flags]' \n", CLI_NAME, VCENTER_CMD, SCAN_VIRTUAL_MACHINES)
 			fmt.Println("Available Flags:")
 			scanVirtualMachinesCmd.PrintDefaults()
-			os.Exit(1)
+			os.Exit(EXIT_USAGE)
 		}
 	} else if operation == SCAN_COMPONENTS {
-		scanComponentsCmd.StringVar(&url, "fqdn", "", "Application Transformer FQDN / IP, ex: appliance.example.com")
-		scanComponentsCmd.StringVar(&username, "username", "", "Application Transformer admin username")
-		scanComponentsCmd.StringVar(&password, "password", "", "Application Transformer admin password")
+		connection := addConnectionFlags(scanComponentsCmd)
+		addMonitorFlags(scanComponentsCmd)
 		scanComponentsCmd.StringVar(&vcFqdn, "vc-fqdn", "", "vCenter FQDN")
 		scanComponentsCmd.StringVar(&vcName, "vc-name", "", "vCenter Name")
 
 		scanComponentsCmd.Parse(os.Args[3:])
+		url, username, password = connection.resolve()
 
-		if (len(url) == 0 || len(username) == 0 || len(password) == 0) ||
+		if !hasCredentials(url, username, password) ||
 			(len(vcFqdn) == 0 && len(vcName) == 0) ||
 			(strings.Contains(url, "https://")) {
 			fmt.Printf("Usage: '%s %s %s [flags]' \n", CLI_NAME, VCENTER_CMD, SCAN_COMPONENTS)
 			fmt.Println("Available Flags:")
 			scanComponentsCmd.PrintDefaults()
-			os.Exit(1)
+			os.Exit(EXIT_USAGE)
 		}
 	} else if operation == DISCOVER_TOPOLOGY {
-		discoverTopologyCmd.StringVar(&url, "fqdn", "", "Application Transformer FQDN / IP, ex: appliance.example.com")
-		discoverTopologyCmd.StringVar(&username, "username", "", "Application Transformer admin username")
-		discoverTopologyCmd.StringVar(&password, "password", "", "Application Transformer admin password")
+		connection := addConnectionFlags(discoverTopologyCmd)
+		addMonitorFlags(discoverTopologyCmd)
 		discoverTopologyCmd.StringVar(&vcFqdn, "vc-fqdn", "", "vCenter FQDN")
 		discoverTopologyCmd.StringVar(&vcName, "vc-name", "", "vCenter Name")
 
 		discoverTopologyCmd.Parse(os.Args[3:])
+		url, username, password = connection.resolve()
 
-		if (len(url) == 0 || len(username) == 0 || len(password) == 0) ||
+		if !hasCredentials(url, username, password) ||
 			(len(vcFqdn) == 0 && len(vcName) == 0) ||
 			(strings.Contains(url, "https://")) {
 			fmt.Printf("Usage: '%s %s %s [flags]' \n", CLI_NAME, VCENTER_CMD, DISCOVER_TOPOLOGY)
 			fmt.Println("Available Flags:")
 			discoverTopologyCmd.PrintDefaults()
-			os.Exit(1)
+			os.Exit(EXIT_USAGE)
 		}
 	} else {
 		vCenters.printUsage()
 	}
 
-	vCenters = VCenters{url, username, password, saAlias, vcFqdn, vcName, operation}
+	vCenters = VCenters{url, username, password, saAlias, vcFqdn, vcName, fromFile, parallelism, operation}
 	return vCenters
 }
 
-func (vCenters VCenters) register(token string, request Request) {
-	serviceAccounts := ServiceAccounts{}
-	response := serviceAccounts.findServiceAccount(vCenters.saAlias, token, request)
-
-	if len(response.Embedded.ServiceAccounts) > 0 {
-
-		for _, serviceAccount := range response.Embedded.ServiceAccounts {
-			if serviceAccount.Alias == vCenters.saAlias {
-				url := PROTOCOL + "://" + request.URL + "/" + PREFIX + "/" + VCENTERS
-
-				certificateThumbprint := getCertificateThumbprint(vCenters.vcFqdn, HTTPS_PORT, "sha1")
-
-				vcRequest := VCenterRequest{vCenters.vcFqdn, vCenters.vcName, serviceAccount.UUID, certificateThumbprint}
-
-				body, responseCode := processRequest(token, url, "POST", vcRequest)
-
-				if responseCode == 202 {
-					tasks := Tasks{}
-					err := json.Unmarshal(body, &tasks)
-					if err != nil {
-						fmt.Println("Failed to parse the response body.\n[ERROR] -", err)
-						os.Exit(1)
-					}
+// RegisterVCenter registers the vCenter at fqdn under name, using the service
+// account registered under saAlias to connect to it.
+func (client *Client) RegisterVCenter(fqdn string, name string, saAlias string) (tasks Tasks, err error) {
+	return client.RegisterVCenterWithThumbprint(fqdn, name, saAlias, "")
+}
 
-					fmt.Println("Submitted the request and the taskID is:", tasks.TaskID)
+// RegisterVCenterWithThumbprint registers the vCenter like RegisterVCenter,
+// trusting the given SHA-1 certificate thumbprint instead of fetching it from
+// the vCenter when it is not empty.
+func (client *Client) RegisterVCenterWithThumbprint(fqdn string, name string, saAlias string, certificateThumbprint string) (tasks Tasks, err error) {
+	serviceAccount, err := client.FindServiceAccount(saAlias)
+	if err != nil {
+		return tasks, err
+	}
 
-					status := tasks.MonitorTask(token, tasks.TaskID, request)
-					if status != "SUCCESS" {
-						fmt.Println("Failed to register vCenter with the provided information")
-					} else {
-						fmt.Println("Successfully registered vCenter with the provided information")
-					}
-				} else {
-					fmt.Println("Failed to register vCenter with the provided information. Response Code:", responseCode)
-				}
-			} else {
-				fmt.Println("Cannot complete the operation as the Service Account does not exist")
-			}
+	if len(certificateThumbprint) == 0 {
+		certificateThumbprint, err = client.getCertificateThumbprint(fqdn, HTTPS_PORT, "sha1")
+		if err != nil {
+			return tasks, err
 		}
-
-	} else {
-		fmt.Println("Cannot complete the operation as the Service Account does not exist")
 	}
-}
 
-func (vCenters VCenters) unregister(token string, request Request) {
-	vCenterUUID := vCenters.findVCenter(token, request).VCenterUUID
+	url := client.discoveryURL(VCENTERS)
+	vcRequest := VCenterRequest{fqdn, name, serviceAccount.UUID, certificateThumbprint}
 
-	url := PROTOCOL + "://" + request.URL + "/" + PREFIX + "/" + VCENTERS + "/" + vCenterUUID
-	_, responseCode := processRequest(token, url, "DELETE", nil)
+	return client.submitted("POST", url, vcRequest)
+}
 
-	if responseCode == 200 {
-		fmt.Println("Successfully deleted vCenter")
-	} else {
-		fmt.Println("Failed to delete vCenter. Response Code: ", responseCode)
+// UnregisterVCenter removes the vCenter identified by name or fqdn.
+func (client *Client) UnregisterVCenter(name string, fqdn string) error {
+	vCenter, err := client.FindVCenter(name, fqdn)
+	if err != nil {
+		return err
 	}
-}
 
-func (vCenters VCenters) findVCenter(token string, request Request) (response VCenter) {
+	url := client.discoveryURL(VCENTERS, vCenter.VCenterUUID)
+	return client.expect("DELETE", url, nil, nil, 200)
+}
 
-	url := PROTOCOL + "://" + request.URL + "/" + PREFIX + "/" + VCENTERS + "?"
+// ListVCenters returns the registered vCenters, narrowed by name and fqdn when
+// they are not empty.
+func (client *Client) ListVCenters(name string, fqdn string) (response VCenterListResponse, err error) {
+	query := neturl.Values{}
 
-	if len(vCenters.vcName) > 0 {
-		url = url + "&vcName=" + vCenters.vcName
+	if len(name) > 0 {
+		query.Set("vcName", name)
 	}
 
-	if len(vCenters.vcFqdn) > 0 {
-		url = url + "&fqdn=" + vCenters.vcFqdn
+	if len(fqdn) > 0 {
+		query.Set("fqdn", fqdn)
 	}
 
-	body, _ := processRequest(token, url, "GET", nil)
+	response.Pagination, err = client.paginate(client.discoveryURL(VCENTERS), query, ListOptions{}, func(body []byte) (Pagination, int, error) {
+		page := VCenterListResponse{}
+		err := json.Unmarshal(body, &page)
+		response.Embedded.VCenters = append(response.Embedded.VCenters, page.Embedded.VCenters...)
+		return page.Pagination, len(page.Embedded.VCenters), err
+	})
+
+	return response, err
+}
 
-	vCenterResponse := VCenterListResponse{}
-	err := json.Unmarshal(body, &vCenterResponse)
+// FindVCenter returns the vCenter registered under name or at fqdn.
+func (client *Client) FindVCenter(name string, fqdn string) (vCenter VCenter, err error) {
+	response, err := client.ListVCenters(name, fqdn)
 	if err != nil {
-		fmt.Println("Failed to parse the response body.\n[ERROR] -", err)
-		os.Exit(1)
+		return vCenter, err
 	}
 
-	if len(vCenterResponse.Embedded.VCenters) > 0 {
-		for _, vCenter := range vCenterResponse.Embedded.VCenters {
-			if (vCenter.VCName == vCenters.vcName) || (vCenter.Fqdn == vCenters.vcFqdn) {
-				response = vCenter
-			} else {
-				fmt.Println("Cannot find the vCenter as it does not exist")
-			}
+	for _, vCenter := range response.Embedded.VCenters {
+		if (len(name) > 0 && vCenter.VCName == name) || (len(fqdn) > 0 && vCenter.Fqdn == fqdn) {
+			return vCenter, nil
 		}
-	} else {
-		fmt.Println("Could not find the vCenter")
 	}
 
-	return response
-}
-
-func (vCenters VCenters) findAll(token string, request Request, vCentersCSV string) (vCenterUUIDs []string) {
-
-	vCentersArray := strings.Split(vCentersCSV, ",")
-
-	vCentersUUIDsArray := []string{}
-
-	for _, vcenter := range vCentersArray {
-		vCenter := VCenters{vcName: vcenter}
-		vCenterResponse := vCenter.findVCenter(token, request)
-		vCentersUUIDsArray = append(vCentersUUIDsArray, vCenterResponse.VCenterUUID)
+	if len(name) == 0 {
+		name = fqdn
 	}
 
-	return vCentersUUIDsArray
+	return vCenter, &NotFoundError{Resource: "vCenter", Name: name}
 }
 
-func (vCenters VCenters) syncVcenters(token string, request Request) {
-	vCenter := vCenters.findVCenter(token, request)
-
-	url := PROTOCOL + "://" + request.URL + "/" + PREFIX + "/" + VCENTERS + "/" + vCenter.VCenterUUID + "/sync"
-
-	body, responseCode := processRequest(token, url, "POST", nil)
-
-	if responseCode == 202 {
-		tasks := Tasks{}
-		err := json.Unmarshal(body, &tasks)
+// FindVCenterUUIDs resolves vCenter names to their UUIDs.
+func (client *Client) FindVCenterUUIDs(names []string) (vCenterUUIDs []string, err error) {
+	for _, name := range names {
+		vCenter, err := client.FindVCenter(name, "")
 		if err != nil {
-			fmt.Println("Failed to parse the response body.\n[ERROR] -", err)
-			os.Exit(1)
-		}
-
-		fmt.Println("Submitted the request and the taskID is:", tasks.TaskID)
-
-		status := tasks.MonitorTask(token, tasks.TaskID, request)
-		if status != "SUCCESS" {
-			fmt.Println("Failed to execute sync on the vCenter provided")
-		} else {
-			fmt.Println("Successfully executed sync on the vCenter provided")
+			return nil, err
 		}
-	} else {
-		fmt.Println("Failed to execute sync on the vCenter provided. Response Code:", responseCode)
+		vCenterUUIDs = append(vCenterUUIDs, vCenter.VCenterUUID)
 	}
-}
 
-func (vCenters VCenters) scanVirtualMachines(token string, request Request) {
-	vCenter := vCenters.findVCenter(token, request)
+	return vCenterUUIDs, nil
+}
 
-	url := PROTOCOL + "://" + request.URL + "/" + PREFIX + "/" + VCENTERS + "/" + vCenter.VCenterUUID + "/virtualmachines"
+// SyncVCenter submits an inventory sync of the vCenter identified by name or
+// fqdn.
+func (client *Client) SyncVCenter(name string, fqdn string) (tasks Tasks, err error) {
+	vCenter, err := client.FindVCenter(name, fqdn)
+	if err != nil {
+		return tasks, err
+	}
 
-	dataCenter := new(Datacenter)
-	vcRequest := VCenterScanVMRequest{false, false, false, *dataCenter}
+	url := client.discoveryURL(VCENTERS, vCenter.VCenterUUID, "sync")
+	return client.submitted("POST", url, nil)
+}
 
-	body, responseCode := processRequest(token, url, "POST", vcRequest)
+// ScanVirtualMachines submits a scan for the virtual machines managed by the
+// vCenter identified by name or fqdn.
+func (client *Client) ScanVirtualMachines(name string, fqdn string) (tasks Tasks, err error) {
+	return client.ScanVirtualMachinesIn(name, fqdn, Datacenter{})
+}
 
-	if responseCode == 202 {
-		tasks := Tasks{}
-		err := json.Unmarshal(body, &tasks)
-		if err != nil {
-			fmt.Println("Failed to parse the response body.\n[ERROR] -", err)
-			os.Exit(1)
-		}
+// ScanVirtualMachinesIn submits a scan for the virtual machines managed by the
+// vCenter identified by name or fqdn, limited to the datacenter, clusters and
+// folders named in scope. An empty scope scans the whole vCenter.
+func (client *Client) ScanVirtualMachinesIn(name string, fqdn string, scope Datacenter) (tasks Tasks, err error) {
+	vCenter, err := client.FindVCenter(name, fqdn)
+	if err != nil {
+		return tasks, err
+	}
 
-		fmt.Println("Submitted the request and the taskID is:", tasks.TaskID)
+	url := client.discoveryURL(VCENTERS, vCenter.VCenterUUID, VIRTUAL_MACHINES)
+	vcRequest := VCenterScanVMRequest{false, false, false, scope}
 
-		status := tasks.MonitorTask(token, tasks.TaskID, request)
-		if status != "SUCCESS" {
-			fmt.Println("Failed to scan virtual machines managed by the provided vCenter")
-		} else {
-			fmt.Println("Successfully scanned virtual machines managed by the provided vCenter")
-		}
-	} else {
-		fmt.Println("Failed to scan virtual machines managed by the provided vCenter. Response Code:", responseCode)
-	}
+	return client.submitted("POST", url, vcRequest)
 }
 
-func (vCenters VCenters) scanComponents(token string, request Request) {
-	vCenter := vCenters.findVCenter(token, request)
+// ScanComponents submits a scan for the components running on the virtual
+// machines managed by the vCenter identified by name or fqdn.
+func (client *Client) ScanComponents(name string, fqdn string) (tasks Tasks, err error) {
+	vCenter, err := client.FindVCenter(name, fqdn)
+	if err != nil {
+		return tasks, err
+	}
 
-	url := PROTOCOL + "://" + request.URL + "/" + PREFIX + "/" + VCENTERS + "/" + vCenter.VCenterUUID + "/components"
+	url := client.discoveryURL(VCENTERS, vCenter.VCenterUUID, COMPONENTS)
 
 	dataCenter := new(Datacenter)
 	vcRequest := VCenterScanVMRequest{true, false, false, *dataCenter}
 
-	body, responseCode := processRequest(token, url, "POST", vcRequest)
-
-	if responseCode == 202 {
-		tasks := Tasks{}
-		err := json.Unmarshal(body, &tasks)
-		if err != nil {
-			fmt.Println("Failed to parse the response body.\n[ERROR] -", err)
-			os.Exit(1)
-		}
-
-		fmt.Println("Submitted the request and the taskID is:", tasks.TaskID)
-
-		status := tasks.MonitorTask(token, tasks.TaskID, request)
-		if status == "PARTIAL_SUCCESS" {
-			fmt.Println("Partial Success in scanning components running on the virtual machines managed by the provided vCenter")
-		} else if status == "SUCCESS" {
-			fmt.Println("Successfully scanned components running on the virtual machines managed by the provided vCenter")
-		} else {
-			fmt.Println("Failed to scan components running on the virtual machines managed by the provided vCenter")
-		}
-	} else {
-		fmt.Println("Failed to scan components running on the virtual machines managed by the provided vCenter. Response Code:", responseCode)
-	}
+	return client.submitted("POST", url, vcRequest)
 }
 
-func (vCenters VCenters) discoverTopology(token string, request Request) {
-	vCenter := vCenters.findVCenter(token, request)
+// DiscoverTopology submits a topology discovery for the components running on
+// the virtual machines managed by the vCenter identified by name or fqdn.
+func (client *Client) DiscoverTopology(name string, fqdn string) (tasks Tasks, err error) {
+	vCenter, err := client.FindVCenter(name, fqdn)
+	if err != nil {
+		return tasks, err
+	}
 
-	url := PROTOCOL + "://" + request.URL + "/" + PREFIX + "/" + VCENTERS + "/" + vCenter.VCenterUUID + "/correlation"
+	url := client.discoveryURL(VCENTERS, vCenter.VCenterUUID, "correlation")
 
 	dataCenter := new(Datacenter)
 	discoverTopologyRequest := DiscoverTopologyRequest{*dataCenter}
 
-	body, responseCode := processRequest(token, url, "POST", discoverTopologyRequest)
-
-	if responseCode == 202 {
-		tasks := Tasks{}
-		err := json.Unmarshal(body, &tasks)
-		if err != nil {
-			fmt.Println("Failed to parse the response body.\n[ERROR] -", err)
-			os.Exit(1)
-		}
-
-		fmt.Println("Submitted the request and the taskID is:", tasks.TaskID)
-
-		status := tasks.MonitorTask(token, tasks.TaskID, request)
-		if status != "SUCCESS" {
-			fmt.Println("Failed to discover topology for the provided vCenter")
-		} else {
-			fmt.Println("Successfully discovered topology for the provided vCenter")
-		}
-	} else {
-		fmt.Println("Failed to discover topology for the provided vCenter. Response Code:", responseCode)
-	}
+	return client.submitted("POST", url, discoverTopologyRequest)
 }
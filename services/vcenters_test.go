@@ -0,0 +1,107 @@
+package services_test
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"gitlab.eng.vmware.com/vmware-navigator-practice/tooling/tanzu-apptx-cli/services"
+	"gitlab.eng.vmware.com/vmware-navigator-practice/tooling/tanzu-apptx-cli/simulator"
+)
+
+func TestRegisterSyncAndScan(t *testing.T) {
+	sim, client := startSimulator(t, simulator.Options{TaskDuration: 100 * time.Millisecond, VirtualMachines: 2})
+	registerVCenter(t, sim, client, "vc1")
+
+	vCenter, err := client.FindVCenter("vc1", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if vCenter.Fqdn != sim.Address() {
+		t.Errorf("expected the vCenter at %s, got %s", sim.Address(), vCenter.Fqdn)
+	}
+
+	tasks, err := client.SyncVCenter("vc1", "")
+	if status, err := watch(t, client, tasks, err); err != nil || status != "SUCCESS" {
+		t.Errorf("expected the sync to succeed, got %s: %v", status, err)
+	}
+
+	response, err := client.ListVirtualMachines(services.VirtualMachineFilter{VCenterFqdn: sim.Address()}, services.ListOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count := len(response.Embedded.VirtualMachinesResponse); count != 2 {
+		t.Errorf("expected the scan to find 2 virtual machines, got %d", count)
+	}
+
+	tasks, err = client.ScanComponents("vc1", "")
+	if _, err := watch(t, client, tasks, err); err != nil {
+		t.Fatalf("failed to scan the components: %v", err)
+	}
+
+	components, err := client.ListComponents(services.ListOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(components.Embedded.Components) == 0 {
+		t.Error("expected the scan to find components")
+	}
+
+	if _, err := client.RegisterVCenter(sim.Address(), "vc2", "missing"); !services.IsNotFound(err) {
+		t.Errorf("expected a missing service account to be reported as not found, got %v", err)
+	}
+}
+
+func TestTaskOutcomes(t *testing.T) {
+	sim, client := startSimulator(t, simulator.Options{TaskDuration: 100 * time.Millisecond})
+	registerVCenter(t, sim, client, "vc1")
+
+	tests := []struct {
+		taskType  string
+		status    string
+		operation string
+		exitCode  int
+	}{
+		{simulator.VCENTER_SYNC, "FAILED", services.SYNC_VCENTERS, services.EXIT_TASK_FAILED},
+		{simulator.COMPONENT_SCAN, "PARTIAL_SUCCESS", services.SCAN_COMPONENTS, services.EXIT_PARTIAL_SUCCESS},
+		{simulator.TOPOLOGY_DISCOVERY, "SUCCESS", services.DISCOVER_TOPOLOGY, services.EXIT_SUCCESS},
+	}
+
+	for _, test := range tests {
+		t.Run(test.status, func(t *testing.T) {
+			sim.SetOutcome(test.taskType, test.status)
+
+			var submit func(name string, fqdn string) (services.Tasks, error)
+			switch test.taskType {
+			case simulator.VCENTER_SYNC:
+				submit = client.SyncVCenter
+			case simulator.COMPONENT_SCAN:
+				submit = client.ScanComponents
+			default:
+				submit = client.DiscoverTopology
+			}
+
+			tasks, err := submit("vc1", "")
+			status, err := watch(t, client, tasks, err)
+			if status != test.status {
+				t.Errorf("expected the task to finish with %s, got %s", test.status, status)
+			}
+
+			var taskError *services.TaskError
+			if test.status == "SUCCESS" && err != nil {
+				t.Errorf("expected no error, got %v", err)
+			} else if test.status != "SUCCESS" && (!errors.As(err, &taskError) || taskError.Status != test.status) {
+				t.Errorf("expected a *TaskError with status %s, got %v", test.status, err)
+			}
+
+			output, code := runCLI(t, sim, services.VCENTER_CMD, test.operation, "-vc-name", "vc1", "-poll-interval", "20ms")
+			if code != test.exitCode {
+				t.Errorf("expected exit code %d, got %d", test.exitCode, code)
+			}
+			if !strings.Contains(output, "Submitted the request") {
+				t.Errorf("expected the task to be reported, got %q", output)
+			}
+		})
+	}
+}
@@ -2,78 +2,93 @@ package services
 
 import (
 	"encoding/json"
-	"flag"
+	"errors"
 	"fmt"
+	neturl "net/url"
 	"os"
+	"strconv"
 	"strings"
+	"sync"
 	"text/tabwriter"
+
+	"gitlab.eng.vmware.com/vmware-navigator-practice/tooling/tanzu-apptx-cli/filter"
+	"gitlab.eng.vmware.com/vmware-navigator-practice/tooling/tanzu-apptx-cli/render"
 )
 
 type VirtualMachines struct {
-	url            string
-	username       string
-	password       string
-	vcFqdn         string
-	vcDatacenter   string
-	vcCluster      string
-	vcResourcePool string
-	vcFolder       string
-	vmName         string
-	vmIP           string
-	outputFormat   string
-	operation      string
+	url              string
+	username         string
+	password         string
+	vcFqdn           string
+	vcDatacenter     string
+	vcCluster        string
+	vcResourcePool   string
+	vcFolder         string
+	vmName           string
+	vmIP             string
+	outputFormat     render.Format
+	filterExpression *filter.Expression
+	listOptions      ListOptions
+	parallelism      int
+	operation        string
 }
 
 func (virtualMachines VirtualMachines) Execute() {
 	virtualMachines = virtualMachines.validate()
 
 	request := Request{virtualMachines.url, virtualMachines.username, virtualMachines.password}
-	authResponse := Authenticate(request)
+	client := authenticate(request)
 
 	switch virtualMachines.operation {
 	case LIST:
-		virtualMachinesList := virtualMachines.list(authResponse.Token)
-
-		if virtualMachines.outputFormat == "table" {
-			w := tabwriter.NewWriter(os.Stdout, 0, 0, 1, ' ', tabwriter.AlignRight|tabwriter.Debug)
-			fmt.Fprintln(w, "VM ID\tNAME\tvCenter\tDataCenter\tCluster\tResource Pool\tFolder\tNetwork\tDatastore\tIP\tCPU\tMemory (in MB)\tDisk Size\tServices")
-			for _, virtualMachine := range virtualMachinesList.Embedded.VirtualMachinesResponse {
-				fmt.Fprintln(w, virtualMachine.ID, "\t", virtualMachine.Name, "\t", virtualMachine.VcenterFqdn,
-					"\t", virtualMachine.DataCenter, "\t", virtualMachine.Cluster, "\t", virtualMachine.ResourcePool,
-					"\t", virtualMachine.Folder, "\t", virtualMachine.Network, "\t", virtualMachine.Datastore,
-					"\t", virtualMachine.IP, "\t", virtualMachine.NumCPU, "\t", virtualMachine.MemoryMB,
-					"\t", virtualMachine.SizeOfDisks, "\t", strings.Join(virtualMachine.Services, ","))
-			}
-			w.Flush()
-		} else if virtualMachines.outputFormat == "json" {
-			prettyJSON, err := json.MarshalIndent(virtualMachinesList, "", "    ")
-			if err != nil {
-				fmt.Println("Failed to generate json", err)
-			}
-			fmt.Printf("%s\n", string(prettyJSON))
-		} else if virtualMachines.outputFormat == "csv" {
-			fmt.Println("VM ID,NAME,vCenter,DataCenter,Cluster,Resource Pool,Folder,Network,Datastore,IP,CPU,Memory (in MB),Disk Size,Services")
-			for _, virtualMachine := range virtualMachinesList.Embedded.VirtualMachinesResponse {
-				fmt.Println(virtualMachine.ID, ",", virtualMachine.Name, ",", virtualMachine.VcenterFqdn,
-					",", virtualMachine.DataCenter, ",", virtualMachine.Cluster, ",", virtualMachine.ResourcePool,
-					",", virtualMachine.Folder, ",", virtualMachine.Network, ",", virtualMachine.Datastore,
-					",", virtualMachine.IP, ",", virtualMachine.NumCPU, ",", virtualMachine.MemoryMB,
-					",", virtualMachine.SizeOfDisks, ",", virtualMachine.Services)
+		virtualMachinesList, err := client.ListVirtualMachines(virtualMachines.filter(), fetchOptions(virtualMachines.filterExpression, virtualMachines.listOptions))
+		exitOnError("Failed to fetch the list of virtual machines", err)
+
+		filtered := virtualMachinesList.Embedded.VirtualMachinesResponse[:0]
+		for _, virtualMachine := range virtualMachinesList.Embedded.VirtualMachinesResponse {
+			if matches(virtualMachines.filterExpression, virtualMachine) {
+				filtered = append(filtered, virtualMachine)
 			}
 		}
+		virtualMachinesList.Embedded.VirtualMachinesResponse = filtered[:virtualMachines.listOptions.limit(len(filtered))]
+
+		table := render.Table{Columns: []render.Column{
+			{Header: "VM ID", Key: "id", Wide: true},
+			{Header: "NAME", Key: "name"},
+			{Header: "vCenter", Key: "vcenterFqdn"},
+			{Header: "DataCenter", Key: "dataCenter", Wide: true},
+			{Header: "Cluster", Key: "cluster"},
+			{Header: "Resource Pool", Key: "resourcePool", Wide: true},
+			{Header: "Folder", Key: "folder", Wide: true},
+			{Header: "Network", Key: "network", Wide: true},
+			{Header: "Datastore", Key: "datastore", Wide: true},
+			{Header: "IP", Key: "ip"},
+			{Header: "CPU", Key: "numCPU", Numeric: true},
+			{Header: "Memory (in MB)", Key: "memoryMB", Numeric: true},
+			{Header: "Disk Size", Key: "sizeOfDisks", Numeric: true},
+			{Header: "Services", Key: "services", Wide: true},
+		}}
+		for _, virtualMachine := range virtualMachinesList.Embedded.VirtualMachinesResponse {
+			table.Rows = append(table.Rows, []string{virtualMachine.ID, virtualMachine.Name, virtualMachine.VcenterFqdn,
+				virtualMachine.DataCenter, virtualMachine.Cluster, virtualMachine.ResourcePool,
+				virtualMachine.Folder, virtualMachine.Network, virtualMachine.Datastore,
+				virtualMachine.IP, strconv.Itoa(virtualMachine.NumCPU), virtualMachine.MemoryMB,
+				virtualMachine.SizeOfDisks, strings.Join(virtualMachine.Services, ",")})
+		}
 
+		printList(virtualMachines.outputFormat, render.List{Document: virtualMachinesList, Items: virtualMachinesList.Embedded.VirtualMachinesResponse, Table: table},
+			len(virtualMachinesList.Embedded.VirtualMachinesResponse), virtualMachinesList.Pagination, "virtual machines")
 	case INTROSPECT:
-		virtualMachines.introspect(authResponse.Token, request)
+		virtualMachines.introspect(client)
 	default:
 		fmt.Println("Operation not supported")
 		virtualMachines.printUsage()
-		os.Exit(1)
 	}
 }
 
 func (virtualMachines VirtualMachines) validate() VirtualMachines {
-	listCmd := flag.NewFlagSet(LIST, flag.ExitOnError)
-	introspectCmd := flag.NewFlagSet(INTROSPECT, flag.ExitOnError)
+	listCmd := NewFlagSet(LIST)
+	introspectCmd := NewFlagSet(INTROSPECT)
 
 	if len(os.Args) < 3 {
 		virtualMachines.printUsage()
@@ -91,12 +106,13 @@ func (virtualMachines VirtualMachines) validate() VirtualMachines {
 	var vcFolder string
 	var vmName string
 	var vmIP string
-	var format string
+	var format render.Format
+	var expression *filter.Expression
+	var listOptions ListOptions
+	var parallelism int
 
 	if operation == LIST {
-		listCmd.StringVar(&url, "fqdn", "", "Application Transformer FQDN / IP, ex: appliance.example.com")
-		listCmd.StringVar(&username, "username", "", "Application Transformer admin username")
-		listCmd.StringVar(&password, "password", "", "Application Transformer admin password")
+		connection := addConnectionFlags(listCmd)
 		listCmd.StringVar(&vcFqdn, "vc-fqdn", "", "vCenter FQDN")
 		listCmd.StringVar(&vcDatacenter, "vc-datacenter", "", "vCenter Datacenter")
 		listCmd.StringVar(&vcCluster, "vc-cluster", "", "vCenter Cluster Name")
@@ -104,122 +120,327 @@ func (virtualMachines VirtualMachines) validate() VirtualMachines {
 		listCmd.StringVar(&vcFolder, "vc-folder", "", "vCenter Folder Name")
 		listCmd.StringVar(&vmName, "vm-name", "", "Virtual Machine Name")
 		listCmd.StringVar(&vmIP, "vm-ip", "", "Virtual Machine IP")
-		listCmd.StringVar(&format, "output-format", "table", "Output format - (json,csv,table) (Default: table)")
+		addFormatFlag(listCmd, &format)
+		addFilterFlag(listCmd, &expression, `cluster == "prod" && memoryMB >= 8192 && services == "tomcat"`)
+		addListFlags(listCmd, &listOptions)
 
 		listCmd.Parse(os.Args[3:])
+		url, username, password = connection.resolve()
 
-		if (len(url) == 0 || len(username) == 0 || len(password) == 0) ||
+		if !hasCredentials(url, username, password) ||
 			(strings.Contains(url, "https://")) {
 			fmt.Printf("Usage: '%s %s %s [flags]' \n", CLI_NAME, VIRTUAL_MACHINES_CMD, LIST)
 			fmt.Println("Available Flags:")
 			listCmd.PrintDefaults()
-			os.Exit(1)
+			os.Exit(EXIT_USAGE)
 		}
 	} else if operation == INTROSPECT {
-		introspectCmd.StringVar(&url, "fqdn", "", "Application Transformer FQDN / IP, ex: appliance.example.com")
-		introspectCmd.StringVar(&username, "username", "", "Application Transformer admin username")
-		introspectCmd.StringVar(&password, "password", "", "Application Transformer admin password")
+		connection := addConnectionFlags(introspectCmd)
+		addMonitorFlags(introspectCmd)
+		introspectCmd.StringVar(&vcFqdn, "vc-fqdn", "", "vCenter FQDN")
+		introspectCmd.StringVar(&vcDatacenter, "vc-datacenter", "", "vCenter Datacenter")
+		introspectCmd.StringVar(&vcCluster, "vc-cluster", "", "vCenter Cluster Name")
+		introspectCmd.StringVar(&vcResourcePool, "vc-resource-pool", "", "vCenter Resource Pool Name")
+		introspectCmd.StringVar(&vcFolder, "vc-folder", "", "vCenter Folder Name")
 		introspectCmd.StringVar(&vmName, "vm-name", "", "Virtual Machine Name")
+		introspectCmd.StringVar(&vmIP, "vm-ip", "", "Virtual Machine IP")
+		introspectCmd.IntVar(&parallelism, "parallelism", 4, "Number of virtual machines introspected at once")
+		addJournalFlags(introspectCmd)
 
 		introspectCmd.Parse(os.Args[3:])
+		url, username, password = connection.resolve()
 
-		if (len(url) == 0 || len(username) == 0 || len(password) == 0) ||
-			len(vmName) == 0 ||
+		if !hasCredentials(url, username, password) ||
+			len(vcFqdn+vcDatacenter+vcCluster+vcResourcePool+vcFolder+vmName+vmIP) == 0 ||
+			parallelism < 1 ||
 			(strings.Contains(url, "https://")) {
 			fmt.Printf("Usage: '%s %s %s [flags]' \n", CLI_NAME, VIRTUAL_MACHINES_CMD, INTROSPECT)
 			fmt.Println("Available Flags:")
 			introspectCmd.PrintDefaults()
-			os.Exit(1)
+			os.Exit(EXIT_USAGE)
 		}
 	} else {
 		virtualMachines.printUsage()
 	}
 
-	virtualMachines = VirtualMachines{url, username, password, vcFqdn, vcDatacenter, vcCluster, vcResourcePool, vcFolder, vmName, vmIP, format, operation}
+	virtualMachines = VirtualMachines{url, username, password, vcFqdn, vcDatacenter, vcCluster, vcResourcePool, vcFolder, vmName, vmIP, format, expression, listOptions, parallelism, operation}
 	return virtualMachines
 }
 
 func (virtualMachines VirtualMachines) printUsage() {
-	fmt.Printf("Usage: '%s %s [command]' \n", CLI_NAME, VIRTUAL_MACHINES_CMD)
-	fmt.Println("Available Commands:")
-	fmt.Printf("  %s \t\t\t%s \n", LIST, "List all virtual machines")
-	fmt.Printf("  %s \t\t%s \n", INTROSPECT, "Introspect a virtual machine")
-	os.Exit(1)
+	PrintCommandUsage(VIRTUAL_MACHINES_CMD, EXIT_USAGE)
 }
 
-func (virtualMachines VirtualMachines) list(token string) (response VirtualMachinesListResponse) {
-	url := PROTOCOL + "://" + virtualMachines.url + "/" + PREFIX + "/" + VIRTUAL_MACHINES + "?"
-
-	if len(virtualMachines.vcFqdn) > 0 {
-		url = url + "&vcenterFqdn=" + virtualMachines.vcFqdn
+// filter returns the query parameters of the flags, together with the
+// equalities of the filter expression on the fields the appliance filters by.
+func (virtualMachines VirtualMachines) filter() VirtualMachineFilter {
+	vmFilter := VirtualMachineFilter{
+		VCenterFqdn:  virtualMachines.vcFqdn,
+		Datacenter:   virtualMachines.vcDatacenter,
+		Cluster:      virtualMachines.vcCluster,
+		ResourcePool: virtualMachines.vcResourcePool,
+		Folder:       virtualMachines.vcFolder,
+		Name:         virtualMachines.vmName,
+		IP:           virtualMachines.vmIP,
 	}
 
-	if len(virtualMachines.vcDatacenter) > 0 {
-		url = url + "&dataCenter=" + virtualMachines.vcDatacenter
-	}
+	pushDown(virtualMachines.filterExpression, map[string]*string{
+		"vcenterFqdn":  &vmFilter.VCenterFqdn,
+		"dataCenter":   &vmFilter.Datacenter,
+		"cluster":      &vmFilter.Cluster,
+		"resourcePool": &vmFilter.ResourcePool,
+		"folder":       &vmFilter.Folder,
+		"name":         &vmFilter.Name,
+		"ip":           &vmFilter.IP,
+	})
+
+	return vmFilter
+}
 
-	if len(virtualMachines.vcFolder) > 0 {
-		url = url + "&folder=" + virtualMachines.vcFolder
+// selection describes the flags selecting the virtual machines, ex:
+// -vc-fqdn vc.example.com -vc-folder Finance.
+func (virtualMachines VirtualMachines) selection() string {
+	var flags []string
+	for _, flag := range []struct{ name, value string }{
+		{"vc-fqdn", virtualMachines.vcFqdn},
+		{"vc-datacenter", virtualMachines.vcDatacenter},
+		{"vc-cluster", virtualMachines.vcCluster},
+		{"vc-resource-pool", virtualMachines.vcResourcePool},
+		{"vc-folder", virtualMachines.vcFolder},
+		{"vm-name", virtualMachines.vmName},
+		{"vm-ip", virtualMachines.vmIP},
+	} {
+		if len(flag.value) > 0 {
+			flags = append(flags, fmt.Sprintf("-%s %q", flag.name, flag.value))
+		}
 	}
+	return strings.Join(flags, " ")
+}
+
+// introspection is the outcome of introspecting a virtual machine.
+type introspection struct {
+	taskID string
+	status string
+	err    error
+}
 
-	if len(virtualMachines.vcCluster) > 0 {
-		url = url + "&cluster=" + virtualMachines.vcCluster
+// introspect introspects every virtual machine matching the filter, with at
+// most parallelism introspections in flight, showing their progress on stderr
+// and a summary once all of them are done. It exits with the code of the
+// failure when all of them failed and with EXIT_PARTIAL_SUCCESS when only
+// some did.
+func (virtualMachines VirtualMachines) introspect(client *Client) {
+	virtualMachinesListResponse, err := client.ListVirtualMachines(virtualMachines.filter(), ListOptions{})
+	exitOnError("Failed to fetch the list of virtual machines", err)
+
+	found := virtualMachinesListResponse.Embedded.VirtualMachinesResponse
+	if len(found) == 0 {
+		exitOnError("Failed to introspect the virtual machine",
+			&NotFoundError{Resource: "Virtual machine", Filter: virtualMachines.selection()})
 	}
 
-	if len(virtualMachines.vcResourcePool) > 0 {
-		url = url + "&resourcePool=" + virtualMachines.vcResourcePool
+	// The virtual machines are shown by name, and by ID too when several of
+	// them share a name.
+	names := map[string]int{}
+	for _, virtualMachine := range found {
+		names[virtualMachine.Name]++
+	}
+	labels := make([]string, len(found))
+	for i, virtualMachine := range found {
+		labels[i] = virtualMachine.Name
+		if names[virtualMachine.Name] > 1 {
+			labels[i] += " (" + virtualMachine.ID + ")"
+		}
 	}
 
-	if len(virtualMachines.vmName) > 0 {
-		url = url + "&name=" + virtualMachines.vmName
+	parallelism := virtualMachines.parallelism
+	if parallelism < 1 {
+		parallelism = 1
 	}
 
-	if len(virtualMachines.vmIP) > 0 {
-		url = url + "&ip=" + virtualMachines.vmIP
+	targets := make([]string, len(found))
+	for i, virtualMachine := range found {
+		targets[i] = virtualMachine.ID
 	}
 
-	body, responseCode := processRequest(token, url, "GET", nil)
+	journal := openJournal(targets)
+	outcomes := make([]introspection, len(found))
+	board := newProgressBoard(len(found), "Introspected")
 
-	if responseCode == 200 {
-		fmt.Println("Successfully fetched the list of virtual machines \n")
-	} else {
-		fmt.Println("Failed to fetch the list of virtual machines. Response code:", responseCode)
-	}
+	rows := make(chan int)
+	var waitGroup sync.WaitGroup
 
-	err := json.Unmarshal(body, &response)
-	if err != nil {
-		fmt.Println("Failed to parse the response body.\n[ERROR] -", err)
-		os.Exit(1)
+	for worker := 0; worker < parallelism && worker < len(found); worker++ {
+		waitGroup.Add(1)
+		go func() {
+			defer waitGroup.Done()
+			for i := range rows {
+				outcomes[i] = introspectVirtualMachine(client, found[i], labels[i], board, journal)
+			}
+		}()
 	}
 
-	return response
-}
+	for i := range found {
+		rows <- i
+	}
+	close(rows)
+	waitGroup.Wait()
 
-func (virtualMachines VirtualMachines) introspect(token string, request Request) {
-	virtualMachinesListResponse := virtualMachines.list(token)
+	var failure error
+	failed, skipped := 0, 0
 
-	for _, virtualMachine := range virtualMachinesListResponse.Embedded.VirtualMachinesResponse {
-		url := PROTOCOL + "://" + virtualMachines.url + "/" + PREFIX + "/" + VIRTUAL_MACHINES + "/" + virtualMachine.ID + "/components"
-		body, responseCode := processRequest(token, url, "POST", nil)
+	for i := range found {
+		if outcomes[i].status == "SKIPPED" {
+			skipped++
+		}
 
-		if responseCode == 202 {
-			tasks := Tasks{}
-			err := json.Unmarshal(body, &tasks)
-			if err != nil {
-				fmt.Println("Failed to parse the response body.\n[ERROR] -", err)
-				os.Exit(1)
+		if outcomes[i].err != nil && !errors.Is(outcomes[i].err, ErrDryRun) {
+			failed++
+			if failure == nil {
+				failure = outcomes[i].err
 			}
+		}
 
-			fmt.Println("Submitted the request and the taskID is:", tasks.TaskID)
+		if outputMode == "json" {
+			result := Result{Operation: operationName(), Target: found[i].Name, TaskID: outcomes[i].taskID, Status: outcomes[i].status}
+			if outcomes[i].err != nil && !errors.Is(outcomes[i].err, ErrDryRun) {
+				result.Error = outcomes[i].err.Error()
+			}
+			printResult(result, nil, "")
+		}
+	}
 
-			status := tasks.MonitorTask(token, tasks.TaskID, request)
-			if status != "SUCCESS" {
-				fmt.Println("Failed to execute sync on the vCenter provided")
-			} else {
-				fmt.Println("Successfully executed sync on the vCenter provided")
+	if outputMode != "json" {
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 1, ' ', tabwriter.AlignRight|tabwriter.Debug)
+		fmt.Fprintln(w, "Virtual Machine\tVM ID\tvCenter\tTask\tStatus\tError")
+		for i, virtualMachine := range found {
+			message := ""
+			if outcomes[i].err != nil && !errors.Is(outcomes[i].err, ErrDryRun) {
+				message = outcomes[i].err.Error()
 			}
+			fmt.Fprintln(w, virtualMachine.Name, "\t", virtualMachine.ID, "\t", virtualMachine.VcenterFqdn, "\t",
+				outcomes[i].taskID, "\t", outcomes[i].status, "\t", message)
+		}
+		w.Flush()
+
+		if dryRun {
+			fmt.Println("Dry run, no changes were made")
+		} else if noWait {
+			fmt.Printf("Submitted the introspection of %d of %d virtual machines\n", len(found)-failed, len(found))
+		} else if skipped > 0 {
+			fmt.Printf("Introspected %d of %d virtual machines, %d of them in a previous run\n", len(found)-failed, len(found), skipped)
 		} else {
-			fmt.Println("Failed to execute sync on the vCenter provided. Response Code:", responseCode)
+			fmt.Printf("Introspected %d of %d virtual machines\n", len(found)-failed, len(found))
+		}
+	}
+
+	// With -no-wait the journal holds the tasks to wait for with -resume.
+	journal.finish(failed == 0 && !noWait)
+
+	if failed == len(found) {
+		os.Exit(exitCode(failure))
+	} else if failed > 0 {
+		os.Exit(EXIT_PARTIAL_SUCCESS)
+	}
+}
+
+// introspectVirtualMachine submits the introspection of a virtual machine
+// and, unless -no-wait was given, waits for it to finish. With -resume, a
+// virtual machine introspected by the interrupted run is skipped and a task
+// it submitted is waited for instead of submitting another one.
+func introspectVirtualMachine(client *Client, virtualMachine VirtualMachinesResponse, label string, board *progressBoard, journal *Journal) (outcome introspection) {
+	var tasks Tasks
+	var err error
+
+	entry, resumed := journal.resumable(virtualMachine.ID)
+	switch {
+	case resumed && entry.Status == "SUCCESS":
+		board.finish(label, "introspected in a previous run, skipped", nil)
+		return introspection{taskID: entry.TaskID, status: "SKIPPED"}
+	case resumed && entry.running():
+		tasks.TaskID = entry.TaskID
+		board.set(label, "resuming task "+tasks.TaskID)
+	default:
+		board.set(label, "submitting")
+		tasks, err = client.IntrospectVirtualMachine(virtualMachine.ID)
+		if err == nil {
+			journal.record(virtualMachine.ID, INTROSPECT, tasks.TaskID, "SUBMITTED", nil)
+		}
+	}
+
+	if err == nil {
+		outcome.taskID = tasks.TaskID
+
+		if noWait {
+			outcome.status = "SUBMITTED"
+			board.finish(label, "submitted, task "+tasks.TaskID, nil)
+			return outcome
 		}
+
+		options := monitorOptions
+		options.Progress = board.tracker(label)
+		_, err = client.WatchTask(tasks.TaskID, options)
+	}
+
+	outcome.err = err
+	outcome.status = resultStatus(err)
+	if errors.Is(err, ErrDryRun) {
+		board.finish(label, outcome.status, nil)
+	} else {
+		journal.record(virtualMachine.ID, INTROSPECT, outcome.taskID, outcome.status, err)
+		board.finish(label, outcome.status, err)
+	}
+
+	return outcome
+}
+
+// ListVirtualMachines returns the virtual machines matching filter.
+func (client *Client) ListVirtualMachines(filter VirtualMachineFilter, options ListOptions) (response VirtualMachinesListResponse, err error) {
+	query := neturl.Values{}
+
+	if len(filter.VCenterFqdn) > 0 {
+		query.Set("vcenterFqdn", filter.VCenterFqdn)
 	}
+
+	if len(filter.Datacenter) > 0 {
+		query.Set("dataCenter", filter.Datacenter)
+	}
+
+	if len(filter.Folder) > 0 {
+		query.Set("folder", filter.Folder)
+	}
+
+	if len(filter.Cluster) > 0 {
+		query.Set("cluster", filter.Cluster)
+	}
+
+	if len(filter.ResourcePool) > 0 {
+		query.Set("resourcePool", filter.ResourcePool)
+	}
+
+	if len(filter.Name) > 0 {
+		query.Set("name", filter.Name)
+	}
+
+	if len(filter.IP) > 0 {
+		query.Set("ip", filter.IP)
+	}
+
+	virtualMachines := []VirtualMachinesResponse{}
+	response.Pagination, err = client.paginate(client.discoveryURL(VIRTUAL_MACHINES), query, options, func(body []byte) (Pagination, int, error) {
+		page := VirtualMachinesListResponse{}
+		err := json.Unmarshal(body, &page)
+		virtualMachines = append(virtualMachines, page.Embedded.VirtualMachinesResponse...)
+		return page.Pagination, len(page.Embedded.VirtualMachinesResponse), err
+	})
+
+	response.Embedded.VirtualMachinesResponse = virtualMachines[:options.limit(len(virtualMachines))]
+	return response, err
+}
+
+// IntrospectVirtualMachine submits a component introspection of the virtual
+// machine with the given ID.
+func (client *Client) IntrospectVirtualMachine(id string) (tasks Tasks, err error) {
+	url := client.discoveryURL(VIRTUAL_MACHINES, id, COMPONENTS)
+	return client.submitted("POST", url, nil)
 }
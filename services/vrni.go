@@ -1,8 +1,6 @@
 package services
 
 import (
-	"encoding/json"
-	"flag"
 	"fmt"
 	"os"
 	"strings"
@@ -26,32 +24,37 @@ func (vRNI VRNI) Execute() {
 	vRNI = vRNI.validate()
 
 	request := Request{vRNI.url, vRNI.username, vRNI.password}
-	authResponse := Authenticate(request)
+	client := authenticate(request)
 
 	switch vRNI.operation {
 	case REGISTER:
-		vRNI.register(authResponse.Token, request)
+		registration := VRNIRegistration{vRNI.alias, vRNI.vrniFqdn, strings.Split(vRNI.vcNames, ","), vRNI.saAlias, vRNI.serviceAccountType, vRNI.isSaaS, vRNI.vrniApiToken}
+		err := client.RegisterVRNI(registration)
+		report(vRNI.vrniFqdn, err, "Failed to register vRNI with the provided information", "Successfully registered vRNI with the provided information")
 	case UNREGISTER:
-		vRNI.unregister(authResponse.Token, request)
+		err := client.UnregisterVRNI(vRNI.vrniFqdn)
+		report(vRNI.vrniFqdn, err, "Failed to delete vRNI with the provided information", "Successfully deleted vRNI with the provided information")
 	case UPDATE_CREDENTIALS:
-		vRNI.update(authResponse.Token, request)
+		err := client.UpdateVRNICredentials(vRNI.vrniFqdn, vRNI.alias, vRNI.saAlias, vRNI.serviceAccountType, vRNI.vrniApiToken)
+		report(vRNI.vrniFqdn, err, "Failed to update vRNI with the provided information", "Successfully updated vRNI credentials with the provided information")
 	case ADD_VCENTERS:
-		vRNI.addVcenters(authResponse.Token, request)
+		err := client.AddVRNIVCenters(vRNI.vrniFqdn, strings.Split(vRNI.vcNames, ","))
+		report(vRNI.vrniFqdn, err, "Failed to add vCenters to vRNI with the provided information", "Successfully added the vCenters to vRNI with the provided information")
 	case REMOVE_VCENTERS:
-		vRNI.deleteVcenters(authResponse.Token, request)
+		err := client.RemoveVRNIVCenters(vRNI.vrniFqdn, strings.Split(vRNI.vcNames, ","))
+		report(vRNI.vrniFqdn, err, "Failed to remove vCenters from vRNI with the provided information", "Successfully removed the vCenters from vRNI with the provided information")
 	default:
-		fmt.Println("Operation not supported \n")
+		fmt.Println("Operation not supported")
 		vRNI.printUsage()
-		os.Exit(1)
 	}
 }
 
 func (vRNI VRNI) validate() VRNI {
-	registerCmd := flag.NewFlagSet(REGISTER, flag.ExitOnError)
-	unregisterCmd := flag.NewFlagSet(UNREGISTER, flag.ExitOnError)
-	updateCredentialsCmd := flag.NewFlagSet(UPDATE_CREDENTIALS, flag.ExitOnError)
-	addVcentersCmd := flag.NewFlagSet(ADD_VCENTERS, flag.ExitOnError)
-	removeVcentersCmd := flag.NewFlagSet(REMOVE_VCENTERS, flag.ExitOnError)
+	registerCmd := NewFlagSet(REGISTER)
+	unregisterCmd := NewFlagSet(UNREGISTER)
+	updateCredentialsCmd := NewFlagSet(UPDATE_CREDENTIALS)
+	addVcentersCmd := NewFlagSet(ADD_VCENTERS)
+	removeVcentersCmd := NewFlagSet(REMOVE_VCENTERS)
 
 	if len(os.Args) < 3 {
 		vRNI.printUsage()
@@ -72,19 +75,26 @@ func (vRNI VRNI) validate() VRNI {
 
 	if operation == REGISTER {
 		registerCmd.StringVar(&alias, "vrni-name", "", "vRNI Name")
-		registerCmd.StringVar(&url, "fqdn", "", "Application Transformer FQDN / IP, ex: appliance.example.com")
-		registerCmd.StringVar(&username, "username", "", "Application Transformer admin username")
-		registerCmd.StringVar(&password, "password", "", "Application Transformer admin password")
+		connection := addConnectionFlags(registerCmd)
+		addOutputFlags(registerCmd)
 		registerCmd.StringVar(&vrniFqdn, "vrni-fqdn", "", "vCenter FQDN")
 		registerCmd.StringVar(&vcNames, "vc-names", "", "comma separated list of vCenter Name(s)")
 		registerCmd.StringVar(&saAlias, "sa-alias", "", "vRNI service account alias")
 		registerCmd.StringVar(&serviceAccountType, "sa-account-type", "", "vRNI service account type, ex: LOCAL or LDAP")
 		registerCmd.BoolVar(&isSaaS, "isSaaS", false, "using a SaaS vRNI instance, default is false")
-		registerCmd.StringVar(&vrniAPIToken, "vrni-api-token", "", "SaaS vRNI api token")
+		registerCmd.StringVar(&vrniAPIToken, "vrni-api-token", "", "SaaS vRNI api token, visible to other users (Default: -vrni-api-token-stdin, -vrni-api-token-file, the credential helper or a prompt)")
+		apiTokenFlags := addSecretFlags(registerCmd, "vrni-api-token", "SaaS vRNI api token")
 
 		registerCmd.Parse(os.Args[3:])
+		url, username, password = connection.resolve()
 
-		if (len(url) == 0 || len(username) == 0 || len(password) == 0) ||
+		if isSaaS && len(vrniFqdn) > 0 {
+			var err error
+			vrniAPIToken, err = resolveSecret(vrniAPIToken, apiTokenFlags, VRNI_CMD+"/"+vrniFqdn, fmt.Sprintf("API token of SaaS vRNI %q", vrniFqdn))
+			exitOnError("Failed to read the vRNI api token", err)
+		}
+
+		if !hasCredentials(url, username, password) ||
 			(len(vrniFqdn) == 0 || len(vcNames) == 0) ||
 			(strings.Contains(url, "https://")) ||
 			(isSaaS && len(vrniAPIToken) == 0 && len(saAlias) != 0) ||
@@ -92,78 +102,85 @@ func (vRNI VRNI) validate() VRNI {
 			fmt.Printf("Usage: '%s %s %s [flags]' \n", CLI_NAME, VRNI_CMD, REGISTER)
 			fmt.Println("Available Flags:")
 			registerCmd.PrintDefaults()
-			os.Exit(1)
+			os.Exit(EXIT_USAGE)
 		}
 	} else if operation == UNREGISTER {
-		unregisterCmd.StringVar(&url, "fqdn", "", "Application Transformer FQDN / IP, ex: appliance.example.com")
-		unregisterCmd.StringVar(&username, "username", "", "Application Transformer admin username")
-		unregisterCmd.StringVar(&password, "password", "", "Application Transformer admin password")
+		connection := addConnectionFlags(unregisterCmd)
+		addOutputFlags(unregisterCmd)
 		unregisterCmd.StringVar(&vrniFqdn, "vrni-fqdn", "", "vCenter FQDN")
 
 		unregisterCmd.Parse(os.Args[3:])
+		url, username, password = connection.resolve()
 
-		if (len(url) == 0 || len(username) == 0 || len(password) == 0) ||
+		if !hasCredentials(url, username, password) ||
 			(len(vrniFqdn) == 0) ||
 			(strings.Contains(url, "https://")) {
 			fmt.Printf("Usage: '%s %s %s [flags]' \n", CLI_NAME, VRNI_CMD, UNREGISTER)
 			fmt.Println("Available Flags:")
 			unregisterCmd.PrintDefaults()
-			os.Exit(1)
+			os.Exit(EXIT_USAGE)
 		}
 	} else if operation == UPDATE_CREDENTIALS {
 		updateCredentialsCmd.StringVar(&alias, "vrni-name", "", "vRNI Name")
-		updateCredentialsCmd.StringVar(&url, "fqdn", "", "Application Transformer FQDN / IP, ex: appliance.example.com")
-		updateCredentialsCmd.StringVar(&username, "username", "", "Application Transformer admin username")
-		updateCredentialsCmd.StringVar(&password, "password", "", "Application Transformer admin password")
+		connection := addConnectionFlags(updateCredentialsCmd)
+		addOutputFlags(updateCredentialsCmd)
 		updateCredentialsCmd.StringVar(&vrniFqdn, "vrni-fqdn", "", "vCenter FQDN")
 		updateCredentialsCmd.StringVar(&saAlias, "sa-alias", "", "vRNI service account alias")
 		updateCredentialsCmd.StringVar(&serviceAccountType, "sa-account-type", "", "vRNI service account type, ex: LOCAL or LDAP")
-		updateCredentialsCmd.StringVar(&vrniAPIToken, "vrni-api-token", "", "SaaS vRNI api token")
+		updateCredentialsCmd.StringVar(&vrniAPIToken, "vrni-api-token", "", "SaaS vRNI api token, visible to other users (Default: -vrni-api-token-stdin, -vrni-api-token-file, the credential helper or a prompt)")
+		apiTokenFlags := addSecretFlags(updateCredentialsCmd, "vrni-api-token", "SaaS vRNI api token")
 
 		updateCredentialsCmd.Parse(os.Args[3:])
+		url, username, password = connection.resolve()
+
+		if len(saAlias) == 0 && len(vrniFqdn) > 0 {
+			var err error
+			vrniAPIToken, err = resolveSecret(vrniAPIToken, apiTokenFlags, VRNI_CMD+"/"+vrniFqdn, fmt.Sprintf("API token of SaaS vRNI %q", vrniFqdn))
+			exitOnError("Failed to read the vRNI api token", err)
+		}
 
-		if (len(url) == 0 || len(username) == 0 || len(password) == 0) ||
+		if !hasCredentials(url, username, password) ||
 			(len(vrniFqdn) == 0) ||
 			(strings.Contains(url, "https://")) ||
 			(len(vrniAPIToken) == 0 || len(saAlias) != 0) {
 			fmt.Printf("Usage: '%s %s %s [flags]' \n", CLI_NAME, VRNI_CMD, UPDATE_CREDENTIALS)
 			fmt.Println("Available Flags:")
 			updateCredentialsCmd.PrintDefaults()
-			os.Exit(1)
+			os.Exit(EXIT_USAGE)
 		}
 	} else if operation == ADD_VCENTERS {
-		addVcentersCmd.StringVar(&url, "fqdn", "", "Application Transformer FQDN / IP, ex: appliance.example.com")
-		addVcentersCmd.StringVar(&username, "username", "", "Application Transformer admin username")
-		addVcentersCmd.StringVar(&password, "password", "", "Application Transformer admin password")
+		connection := addConnectionFlags(addVcentersCmd)
+		addOutputFlags(addVcentersCmd)
 		addVcentersCmd.StringVar(&vrniFqdn, "vrni-fqdn", "", "vCenter FQDN")
 		addVcentersCmd.StringVar(&vcNames, "vc-names", "", "comma separated list of vCenter Name(s)")
 
 		addVcentersCmd.Parse(os.Args[3:])
+		url, username, password = connection.resolve()
 
-		if (len(url) == 0 || len(username) == 0 || len(password) == 0) ||
+		if !hasCredentials(url, username, password) ||
 			(len(vrniFqdn) == 0 || len(vcNames) == 0) ||
 			(strings.Contains(url, "https://")) {
 			fmt.Printf("Usage: '%s %s %s [flags]' \n", CLI_NAME, VRNI_CMD, ADD_VCENTERS)
 			fmt.Println("Available Flags:")
 			addVcentersCmd.PrintDefaults()
-			os.Exit(1)
+			os.Exit(EXIT_USAGE)
 		}
 	} else if operation == REMOVE_VCENTERS {
-		removeVcentersCmd.StringVar(&url, "fqdn", "", "Application Transformer FQDN / IP, ex: appliance.example.com")
-		removeVcentersCmd.StringVar(&username, "username", "", "Application Transformer admin username")
-		removeVcentersCmd.StringVar(&password, "password", "", "Application Transformer admin password")
+		connection := addConnectionFlags(removeVcentersCmd)
+		addOutputFlags(removeVcentersCmd)
 		removeVcentersCmd.StringVar(&vrniFqdn, "vrni-fqdn", "", "vCenter FQDN")
 		removeVcentersCmd.StringVar(&vcNames, "vc-names", "", "comma separated list of vCenter Name(s)")
 
 		removeVcentersCmd.Parse(os.Args[3:])
+		url, username, password = connection.resolve()
 
-		if (len(url) == 0 || len(username) == 0 || len(password) == 0) ||
+		if !hasCredentials(url, username, password) ||
 			(len(vrniFqdn) == 0 || len(vcNames) == 0) ||
 			(strings.Contains(url, "https://")) {
 			fmt.Printf("Usage: '%s %s %s [flags]' \n", CLI_NAME, VRNI_CMD, REMOVE_VCENTERS)
 			fmt.Println("Available Flags:")
 			removeVcentersCmd.PrintDefaults()
-			os.Exit(1)
+			os.Exit(EXIT_USAGE)
 		}
 	} else {
 		vRNI.printUsage()
@@ -174,219 +191,195 @@ func (vRNI VRNI) validate() VRNI {
 }
 
 func (vRNI VRNI) printUsage() {
-	fmt.Printf("Usage: '%s %s [Command]' \n", CLI_NAME, VRNI_CMD)
-	fmt.Println("Available Commands:")
-	fmt.Printf("  %s \t\t\t%s \n", REGISTER, "Register vRNI instance")
-	fmt.Printf("  %s \t\t\t%s \n", UNREGISTER, "Remove vRNI instance")
-	fmt.Printf("  %s \t\t%s \n", UPDATE_CREDENTIALS, "Update credentials for the vRNI instance")
-	fmt.Printf("  %s \t\t\t%s \n", ADD_VCENTERS, "Add vCenters to the vRNI instance")
-	fmt.Printf("  %s \t\t%s \n", REMOVE_VCENTERS, "Remove vCenters from the vRNI instance")
-	os.Exit(1)
+	PrintCommandUsage(VRNI_CMD, EXIT_USAGE)
 }
 
-func (vRNI VRNI) register(token string, request Request) {
-	vCenters := VCenters{}
-	vCenterUUIDs := vCenters.findAll(token, request, vRNI.vcNames)
+// RegisterVRNI registers a vRNI instance and the vCenters it monitors.
+func (client *Client) RegisterVRNI(registration VRNIRegistration) error {
+	vCenterUUIDs, err := client.FindVCenterUUIDs(registration.VCNames)
+	if err != nil {
+		return err
+	}
 
-	vrniResponses := vRNI.findAll(token, request)
-	for _, vrniResponse := range vrniResponses {
-		if vrniResponse.IP == vRNI.vrniFqdn {
-			fmt.Println("vRNI is already registered")
-			os.Exit(1)
-		}
+	_, err = client.FindVRNI(registration.Fqdn)
+	if err == nil {
+		return &AlreadyExistsError{Resource: "vRNI", Name: registration.Fqdn}
+	} else if !IsNotFound(err) {
+		return err
 	}
 
-	url := PROTOCOL + "://" + request.URL + "/" + PREFIX + "/" + VRNIS
-	certificateThumbprint := getCertificateThumbprint(vRNI.vrniFqdn, HTTPS_PORT, "sha1")
+	certificateThumbprint, err := client.getCertificateThumbprint(registration.Fqdn, HTTPS_PORT, "sha1")
+	if err != nil {
+		return err
+	}
 
 	var vrniRequest VRNIRequest
 
-	if vRNI.isSaaS {
-		vrniRequest = VRNIRequest{vRNI.alias, vRNI.vrniFqdn, vRNI.vrniApiToken, vRNI.isSaaS, vCenterUUIDs, "", certificateThumbprint, ""}
+	if registration.IsSaaS {
+		vrniRequest = VRNIRequest{registration.Alias, registration.Fqdn, registration.APIToken, true, vCenterUUIDs, "", certificateThumbprint, ""}
 	} else {
-		serviceAccounts := ServiceAccounts{}
-		response := serviceAccounts.findServiceAccount(vRNI.saAlias, token, request)
-
-		if len(response.Embedded.ServiceAccounts) > 0 {
-			for _, serviceAccount := range response.Embedded.ServiceAccounts {
-				if serviceAccount.Alias == vRNI.saAlias {
-					vrniRequest = VRNIRequest{vRNI.alias, vRNI.vrniFqdn, vRNI.vrniApiToken, vRNI.isSaaS, vCenterUUIDs, serviceAccount.UUID, certificateThumbprint, vRNI.serviceAccountType}
-				} else {
-					fmt.Println("Cannot complete the operation as the Service Account does not exist")
-				}
-			}
-		} else {
-			fmt.Println("Cannot complete the operation as the Service Account does not exist")
+		serviceAccount, err := client.FindServiceAccount(registration.SAAlias)
+		if err != nil {
+			return err
 		}
+		vrniRequest = VRNIRequest{registration.Alias, registration.Fqdn, registration.APIToken, false, vCenterUUIDs, serviceAccount.UUID, certificateThumbprint, registration.SAType}
 	}
 
-	_, responseCode := processRequest(token, url, "POST", vrniRequest)
-
-	if responseCode == 200 {
-		fmt.Println("Successfully registered vRNI with the provided information")
-	} else {
-		fmt.Println("Failed to register vRNI with the provided information. Response Code:", responseCode)
-	}
+	url := client.discoveryURL(VRNIS)
+	return client.expect("POST", url, vrniRequest, nil, 200)
 }
 
-func (vRNI VRNI) unregister(token string, request Request) {
-	vrniResponses := vRNI.findAll(token, request)
-	for _, vrniResponse := range vrniResponses {
-		if vrniResponse.IP == vRNI.vrniFqdn {
-			url := PROTOCOL + "://" + request.URL + "/" + PREFIX + "/" + VRNIS + "/" + vrniResponse.Id
-			_, responseCode := processRequest(token, url, "DELETE", nil)
-
-			if responseCode == 204 {
-				fmt.Println("Successfully deleted vRNI with the provided information")
-			} else {
-				fmt.Println("Failed to delete vRNI with the provided information. Response Code:", responseCode)
-			}
-		} else {
-			fmt.Println("Could not find the vRNI instance provided")
-		}
+// UnregisterVRNI removes the vRNI instance at fqdn.
+func (client *Client) UnregisterVRNI(fqdn string) error {
+	vrniResponse, err := client.FindVRNI(fqdn)
+	if err != nil {
+		return err
 	}
+
+	url := client.discoveryURL(VRNIS, vrniResponse.Id)
+	return client.expect("DELETE", url, nil, nil, 204)
 }
 
-func (vRNI VRNI) findAll(token string, request Request) (response []VRNIResponse) {
-	url := PROTOCOL + "://" + request.URL + "/" + PREFIX + "/" + VRNIS
+// ListVRNIs returns the registered vRNI instances.
+func (client *Client) ListVRNIs() (response []VRNIResponse, err error) {
+	url := client.discoveryURL(VRNIS)
+	err = client.expect("GET", url, nil, &response, 200)
+	return response, err
+}
 
-	body, responseCode := processRequest(token, url, "GET", nil)
+// FindVRNI returns the vRNI instance registered at fqdn.
+func (client *Client) FindVRNI(fqdn string) (vrniResponse VRNIResponse, err error) {
+	vrniResponses, err := client.ListVRNIs()
+	if err != nil {
+		return vrniResponse, err
+	}
 
-	if responseCode == 200 {
-		err := json.Unmarshal(body, &response)
-		if err != nil {
-			fmt.Println("Failed to parse the response body.\n[ERROR] -", err)
-			os.Exit(1)
+	for _, vrniResponse := range vrniResponses {
+		if vrniResponse.IP == fqdn {
+			return vrniResponse, nil
 		}
-	} else {
-		fmt.Println("Failed to register vRNI with the provided information")
 	}
 
-	return response
+	return vrniResponse, &NotFoundError{Resource: "vRNI", Name: fqdn}
 }
-func (vRNI VRNI) update(token string, request Request) {
-	vrniResponses := vRNI.findAll(token, request)
-	for _, vrniResponse := range vrniResponses {
-		if vrniResponse.IP == vRNI.vrniFqdn {
-			url := PROTOCOL + "://" + request.URL + "/" + PREFIX + "/" + VRNIS + "/" + vrniResponse.Id
-			certificateThumbprint := getCertificateThumbprint(vRNI.vrniFqdn, HTTPS_PORT, "sha1")
 
-			var vCenterUUIDs []string
-			for _, vCenter := range vrniResponse.VCenters {
-				vCenterUUIDs = append(vCenterUUIDs, vCenter.VCenterUUID)
-			}
+// UpdateVRNICredentials replaces the credentials of the vRNI instance at fqdn.
+// SaaS instances take apiToken, on-premises instances the service account
+// registered under saAlias.
+func (client *Client) UpdateVRNICredentials(fqdn string, alias string, saAlias string, saType string, apiToken string) error {
+	vrniResponse, err := client.FindVRNI(fqdn)
+	if err != nil {
+		return err
+	}
 
-			var vrniRequest VRNIRequest
-
-			if vrniResponse.IsSaaS {
-				vrniRequest = VRNIRequest{vrniResponse.Alias, vrniResponse.IP, vRNI.vrniApiToken, true, vCenterUUIDs, "", certificateThumbprint, ""}
-			} else {
-				serviceAccounts := ServiceAccounts{}
-				response := serviceAccounts.findServiceAccount(vRNI.saAlias, token, request)
-
-				if len(response.Embedded.ServiceAccounts) > 0 {
-					for _, serviceAccount := range response.Embedded.ServiceAccounts {
-						if serviceAccount.Alias == vRNI.saAlias {
-							vrniRequest = VRNIRequest{vRNI.alias, vrniResponse.IP, "", false, vCenterUUIDs, serviceAccount.UUID, certificateThumbprint, vRNI.serviceAccountType}
-						} else {
-							fmt.Println("Cannot complete the operation as the Service Account does not exist")
-						}
-					}
-				} else {
-					fmt.Println("Cannot complete the operation as the Service Account does not exist")
-				}
-			}
+	certificateThumbprint, err := client.getCertificateThumbprint(fqdn, HTTPS_PORT, "sha1")
+	if err != nil {
+		return err
+	}
 
-			_, responseCode := processRequest(token, url, "PUT", vrniRequest)
+	var vrniRequest VRNIRequest
 
-			if responseCode == 200 {
-				fmt.Println("Successfully updated vRNI credentials with the provided information")
-			} else {
-				fmt.Println("Failed to update vRNI with the provided information. Response Code:", responseCode)
-			}
-		} else {
-			fmt.Println("Could not find the vRNI instance provided")
+	if vrniResponse.IsSaaS {
+		vrniRequest = VRNIRequest{vrniResponse.Alias, vrniResponse.IP, apiToken, true, vrniResponse.vCenterUUIDs(), "", certificateThumbprint, ""}
+	} else {
+		serviceAccount, err := client.FindServiceAccount(saAlias)
+		if err != nil {
+			return err
 		}
+		vrniRequest = VRNIRequest{alias, vrniResponse.IP, "", false, vrniResponse.vCenterUUIDs(), serviceAccount.UUID, certificateThumbprint, saType}
 	}
+
+	url := client.discoveryURL(VRNIS, vrniResponse.Id)
+	return client.expect("PUT", url, vrniRequest, nil, 200)
 }
-func (vRNI VRNI) addVcenters(token string, request Request) {
-	vrniResponses := vRNI.findAll(token, request)
-	for _, vrniResponse := range vrniResponses {
-		if vrniResponse.IP == vRNI.vrniFqdn {
-			url := PROTOCOL + "://" + request.URL + "/" + PREFIX + "/" + VRNIS + "/" + vrniResponse.Id
-			certificateThumbprint := getCertificateThumbprint(vRNI.vrniFqdn, HTTPS_PORT, "md5")
 
-			var vCenterUUIDs []string
-			for _, vCenter := range vrniResponse.VCenters {
-				vCenterUUIDs = append(vCenterUUIDs, vCenter.VCenterUUID)
-			}
+// AddVRNIVCenters adds the named vCenters to the vRNI instance at fqdn.
+func (client *Client) AddVRNIVCenters(fqdn string, vcNames []string) error {
+	vrniResponse, err := client.FindVRNI(fqdn)
+	if err != nil {
+		return err
+	}
 
-			vCenters := VCenters{}
-			newVCenterUUIDs := vCenters.findAll(token, request, vRNI.vcNames)
+	newVCenterUUIDs, err := client.FindVCenterUUIDs(vcNames)
+	if err != nil {
+		return err
+	}
 
-			vCenterUUIDs = append(vCenterUUIDs, newVCenterUUIDs...)
+	vCenterUUIDs := append(vrniResponse.vCenterUUIDs(), newVCenterUUIDs...)
 
-			var vrniRequest VRNIRequest
-			if vrniResponse.IsSaaS {
-				vrniRequest = VRNIRequest{vrniResponse.Alias, vrniResponse.IP, vrniResponse.ApiToken, vrniResponse.IsSaaS, vCenterUUIDs, "", certificateThumbprint, ""}
-			} else {
-				vrniRequest = VRNIRequest{vrniResponse.Alias, vrniResponse.IP, "", vrniResponse.IsSaaS, vCenterUUIDs, vrniResponse.ServiceAccount.UUID, certificateThumbprint, vrniResponse.ServiceAccountType}
-			}
+	return client.updateVRNIVCenters(vrniResponse, vCenterUUIDs, "md5")
+}
 
-			_, responseCode := processRequest(token, url, "PUT", vrniRequest)
+// RemoveVRNIVCenters removes the named vCenters from the vRNI instance at fqdn.
+func (client *Client) RemoveVRNIVCenters(fqdn string, vcNames []string) error {
+	vrniResponse, err := client.FindVRNI(fqdn)
+	if err != nil {
+		return err
+	}
+
+	toDeleteVCenterUUIDs, err := client.FindVCenterUUIDs(vcNames)
+	if err != nil {
+		return err
+	}
 
-			if responseCode == 200 {
-				fmt.Println("Successfully added the vCenters to vRNI with the provided information")
-			} else {
-				fmt.Println("Failed to add vCenters to vRNI with the provided information. Response Code:", responseCode)
+	var vCenterUUIDs []string
+	for _, vCenterUUID := range vrniResponse.vCenterUUIDs() {
+		keep := true
+		for _, toDeleteVCenterUUID := range toDeleteVCenterUUIDs {
+			if vCenterUUID == toDeleteVCenterUUID {
+				keep = false
 			}
-		} else {
-			fmt.Println("Could not find the vRNI instance provided")
 		}
-
+		if keep {
+			vCenterUUIDs = append(vCenterUUIDs, vCenterUUID)
+		}
 	}
-}
 
-func (vRNI VRNI) deleteVcenters(token string, request Request) {
-	vrniResponses := vRNI.findAll(token, request)
-	for _, vrniResponse := range vrniResponses {
-		if vrniResponse.IP == vRNI.vrniFqdn {
-			url := PROTOCOL + "://" + request.URL + "/" + PREFIX + "/" + VRNIS + "/" + vrniResponse.Id
-			certificateThumbprint := getCertificateThumbprint(vRNI.vrniFqdn, HTTPS_PORT, "sha1")
+	return client.updateVRNIVCenters(vrniResponse, vCenterUUIDs, "sha1")
+}
 
-			var vCenterUUIDs []string
-			for _, vCenter := range vrniResponse.VCenters {
-				vCenterUUIDs = append(vCenterUUIDs, vCenter.VCenterUUID)
-			}
+// SetVRNIVCenters replaces the vCenters of the vRNI instance at fqdn with the
+// named ones.
+func (client *Client) SetVRNIVCenters(fqdn string, vcNames []string) error {
+	vrniResponse, err := client.FindVRNI(fqdn)
+	if err != nil {
+		return err
+	}
 
-			vCenters := VCenters{}
-			toDeleteVCenterUUIDs := vCenters.findAll(token, request, vRNI.vcNames)
+	vCenterUUIDs, err := client.FindVCenterUUIDs(vcNames)
+	if err != nil {
+		return err
+	}
 
-			for i, vCenterUUID := range vCenterUUIDs {
-				for _, toDeleteVCenterUUID := range toDeleteVCenterUUIDs {
-					if vCenterUUID == toDeleteVCenterUUID {
-						vCenterUUIDs = append(vCenterUUIDs[:i], vCenterUUIDs[i+1:]...)
-					}
-				}
-			}
+	return client.updateVRNIVCenters(vrniResponse, vCenterUUIDs, "sha1")
+}
 
-			var vrniRequest VRNIRequest
-			if vrniResponse.IsSaaS {
-				vrniRequest = VRNIRequest{vrniResponse.Alias, vrniResponse.IP, vrniResponse.ApiToken, vrniResponse.IsSaaS, vCenterUUIDs, "", certificateThumbprint, ""}
-			} else {
-				vrniRequest = VRNIRequest{vrniResponse.Alias, vrniResponse.IP, "", vrniResponse.IsSaaS, vCenterUUIDs, vrniResponse.ServiceAccount.UUID, certificateThumbprint, vrniResponse.ServiceAccountType}
-			}
+func (client *Client) updateVRNIVCenters(vrniResponse VRNIResponse, vCenterUUIDs []string, checksum string) error {
+	certificateThumbprint, err := client.getCertificateThumbprint(vrniResponse.IP, HTTPS_PORT, checksum)
+	if err != nil {
+		return err
+	}
 
-			_, responseCode := processRequest(token, url, "PUT", vrniRequest)
+	var vrniRequest VRNIRequest
+	if vrniResponse.IsSaaS {
+		vrniRequest = VRNIRequest{vrniResponse.Alias, vrniResponse.IP, vrniResponse.ApiToken, vrniResponse.IsSaaS, vCenterUUIDs, "", certificateThumbprint, ""}
+	} else {
+		vrniRequest = VRNIRequest{vrniResponse.Alias, vrniResponse.IP, "", vrniResponse.IsSaaS, vCenterUUIDs, vrniResponse.ServiceAccount.UUID, certificateThumbprint, vrniResponse.ServiceAccountType}
+	}
 
-			if responseCode == 200 {
-				fmt.Println("Successfully removed the vCenters from vRNI with the provided information")
-			} else {
-				fmt.Println("Failed to remove vCenters from vRNI with the provided information. Response Code:", responseCode)
-			}
-		} else {
-			fmt.Println("Could not find the vRNI instance provided")
+	if client.dryRun != nil {
+		if err := client.printMembershipDiff(vrniResponse, vCenterUUIDs); err != nil {
+			return err
 		}
+	}
+
+	url := client.discoveryURL(VRNIS, vrniResponse.Id)
+	return client.expect("PUT", url, vrniRequest, nil, 200)
+}
 
+func (vrniResponse VRNIResponse) vCenterUUIDs() (vCenterUUIDs []string) {
+	for _, vCenter := range vrniResponse.VCenters {
+		vCenterUUIDs = append(vCenterUUIDs, vCenter.VCenterUUID)
 	}
+	return vCenterUUIDs
 }
@@ -0,0 +1,96 @@
+package simulator
+
+import (
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+
+	"gitlab.eng.vmware.com/vmware-navigator-practice/tooling/tanzu-apptx-cli/services"
+)
+
+type Command struct {
+	address   string
+	options   Options
+	operation string
+}
+
+func (command Command) Execute() {
+	command = command.validate()
+
+	switch command.operation {
+	case services.SERVE:
+		simulator, err := Listen(command.address, command.options)
+		if err != nil {
+			fmt.Println("Failed to start the simulator\n[ERROR] -", err)
+			os.Exit(services.EXIT_ERROR)
+		}
+
+		fmt.Println("Simulator listening on", simulator.Address())
+		fmt.Printf("Connect with: %s [command] [operation] -fqdn %s -username %s -password %s -insecure\n",
+			services.CLI_NAME, simulator.Address(), simulator.options.Username, simulator.options.Password)
+
+		signals := make(chan os.Signal, 1)
+		signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+		<-signals
+
+		simulator.Close()
+	default:
+		fmt.Println("Operation not supported")
+		command.printUsage()
+	}
+}
+
+func (command Command) validate() Command {
+	serveCmd := services.NewFlagSet(services.SERVE)
+
+	if len(os.Args) < 3 {
+		command.printUsage()
+	}
+
+	operation := os.Args[2]
+
+	var address string
+	var outcomes string
+	var options Options
+
+	if operation == services.SERVE {
+		serveCmd.StringVar(&address, "listen", "127.0.0.1:8443", "Address to listen on")
+		serveCmd.StringVar(&options.Username, "username", "admin", "Username accepted by the simulator")
+		serveCmd.StringVar(&options.Password, "password", "admin", "Password accepted by the simulator")
+		serveCmd.DurationVar(&options.TaskDuration, "task-duration", 0, "How long tasks stay IN_PROGRESS (Default: 1s)")
+		serveCmd.StringVar(&options.TaskOutcome, "task-outcome", "SUCCESS", "Final status of tasks, ex: SUCCESS, FAILED, PARTIAL_SUCCESS")
+		serveCmd.StringVar(&outcomes, "outcomes", "", "Final status per task type, ex: COMPONENT_SCAN=PARTIAL_SUCCESS,VM_SCAN=FAILED")
+		serveCmd.DurationVar(&options.TokenTTL, "token-ttl", 0, "Lifetime of session tokens (Default: 1h)")
+		serveCmd.IntVar(&options.PageSize, "page-size", 0, "Default page size of list endpoints (Default: 20)")
+		serveCmd.IntVar(&options.VirtualMachines, "vms", 0, "Number of virtual machines found on each vCenter (Default: 3)")
+
+		serveCmd.Parse(os.Args[3:])
+
+		options.Outcomes = map[string]string{}
+		for _, outcome := range strings.Split(outcomes, ",") {
+			if len(outcome) == 0 {
+				continue
+			}
+
+			parts := strings.SplitN(outcome, "=", 2)
+			if len(parts) != 2 {
+				fmt.Printf("Usage: '%s %s %s [flags]' \n", services.CLI_NAME, services.SIMULATOR_CMD, services.SERVE)
+				fmt.Println("Available Flags:")
+				serveCmd.PrintDefaults()
+				os.Exit(services.EXIT_USAGE)
+			}
+			options.Outcomes[strings.ToUpper(parts[0])] = strings.ToUpper(parts[1])
+		}
+	} else {
+		command.printUsage()
+	}
+
+	command = Command{address, options, operation}
+	return command
+}
+
+func (command Command) printUsage() {
+	services.PrintCommandUsage(services.SIMULATOR_CMD, services.EXIT_USAGE)
+}
@@ -0,0 +1,494 @@
+package simulator
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"gitlab.eng.vmware.com/vmware-navigator-practice/tooling/tanzu-apptx-cli/services"
+)
+
+// discovery routes a request under /discovery.
+func (simulator *Simulator) discovery(w http.ResponseWriter, r *http.Request, path []string) {
+	switch path[0] {
+	case services.SERVICE_ACCOUNTS:
+		simulator.serviceAccountsHandler(w, r, path[1:])
+	case services.VCENTERS:
+		simulator.vCentersHandler(w, r, path[1:])
+	case services.VRNIS:
+		simulator.vrnisHandler(w, r, path[1:])
+	case services.VIRTUAL_MACHINES:
+		simulator.virtualMachinesHandler(w, r, path[1:])
+	case services.COMPONENTS:
+		if r.Method != "GET" || len(path) != 1 {
+			writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+			return
+		}
+
+		items := []interface{}{}
+		for _, component := range simulator.components {
+			items = append(items, component)
+		}
+		simulator.paginate(w, r, services.COMPONENTS, items)
+	case services.APPLICATIONS:
+		if r.Method != "GET" || len(path) != 1 {
+			writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+			return
+		}
+
+		items := []interface{}{}
+		for _, application := range simulator.applications {
+			items = append(items, application)
+		}
+		simulator.paginate(w, r, services.APPLICATIONS, items)
+	case services.TASKS:
+		simulator.tasksHandler(w, r, path[1:])
+	default:
+		writeError(w, http.StatusNotFound, "no such endpoint")
+	}
+}
+
+func (simulator *Simulator) serviceAccountsHandler(w http.ResponseWriter, r *http.Request, path []string) {
+	switch {
+	case r.Method == "GET" && len(path) == 0:
+		alias := r.URL.Query().Get("alias")
+
+		items := []interface{}{}
+		for i := len(simulator.serviceAccounts) - 1; i >= 0; i-- {
+			if strings.Contains(simulator.serviceAccounts[i].Alias, alias) {
+				items = append(items, simulator.serviceAccounts[i])
+			}
+		}
+		simulator.paginate(w, r, "serviceAccounts", items)
+	case r.Method == "POST" && len(path) == 0:
+		request := serviceAccountRequest{}
+		if !decode(w, r, &request) {
+			return
+		}
+
+		if simulator.findServiceAccount(request.Alias, "") != nil {
+			writeError(w, http.StatusConflict, fmt.Sprintf("service account %q already exists", request.Alias))
+			return
+		}
+
+		created := &serviceAccount{UUID: simulator.newID("sa"), Alias: request.Alias, Username: request.Username, password: request.Password}
+		simulator.serviceAccounts = append(simulator.serviceAccounts, created)
+		writeJSON(w, http.StatusCreated, created)
+	case r.Method == "DELETE" && len(path) == 1:
+		for i, serviceAccount := range simulator.serviceAccounts {
+			if serviceAccount.UUID == path[0] {
+				simulator.serviceAccounts = append(simulator.serviceAccounts[:i], simulator.serviceAccounts[i+1:]...)
+				w.WriteHeader(http.StatusOK)
+				return
+			}
+		}
+		writeError(w, http.StatusNotFound, "no such service account")
+	case r.Method == "GET" && len(path) == 1 && path[0] == "defaults":
+		defaults := map[string]*serviceAccount{}
+		for saType, uuid := range simulator.defaults {
+			if found := simulator.findServiceAccount("", uuid); found != nil {
+				defaults[saType] = found
+			}
+		}
+		writeJSON(w, http.StatusOK, defaults)
+	case r.Method == "POST" && len(path) == 2 && path[0] == "defaults":
+		request := globalDefaultRequest{}
+		if !decode(w, r, &request) {
+			return
+		}
+
+		if simulator.findServiceAccount("", request.ServiceAccountUUID) == nil {
+			writeError(w, http.StatusBadRequest, "no such service account")
+			return
+		}
+
+		simulator.defaults[path[1]] = request.ServiceAccountUUID
+		w.WriteHeader(http.StatusOK)
+	case r.Method == "DELETE" && len(path) == 2 && path[0] == "defaults":
+		delete(simulator.defaults, path[1])
+		w.WriteHeader(http.StatusOK)
+	default:
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+	}
+}
+
+func (simulator *Simulator) findServiceAccount(alias string, uuid string) *serviceAccount {
+	for _, serviceAccount := range simulator.serviceAccounts {
+		if (len(alias) > 0 && serviceAccount.Alias == alias) || (len(uuid) > 0 && serviceAccount.UUID == uuid) {
+			return serviceAccount
+		}
+	}
+	return nil
+}
+
+func (simulator *Simulator) vCentersHandler(w http.ResponseWriter, r *http.Request, path []string) {
+	switch {
+	case r.Method == "GET" && len(path) == 0:
+		name := r.URL.Query().Get("vcName")
+		fqdn := r.URL.Query().Get("fqdn")
+
+		items := []interface{}{}
+		for _, vCenter := range simulator.vCenters {
+			if (len(name) == 0 || vCenter.VCName == name) && (len(fqdn) == 0 || vCenter.Fqdn == fqdn) {
+				items = append(items, vCenter)
+			}
+		}
+		simulator.paginate(w, r, services.VCENTERS, items)
+	case r.Method == "POST" && len(path) == 0:
+		request := vCenterRequest{}
+		if !decode(w, r, &request) {
+			return
+		}
+
+		for _, vCenter := range simulator.vCenters {
+			if vCenter.VCName == request.VCName || vCenter.Fqdn == request.Fqdn {
+				writeError(w, http.StatusConflict, fmt.Sprintf("vCenter %q is already registered", request.VCName))
+				return
+			}
+		}
+
+		if simulator.findServiceAccount("", request.VCServiceAccountUUID) == nil || len(request.CertificateThumbprint) == 0 {
+			writeError(w, http.StatusBadRequest, "a service account and the certificate thumbprint are required")
+			return
+		}
+
+		registered := &vCenter{Fqdn: request.Fqdn, VCenterUUID: simulator.newID("vc"), VCName: request.VCName, Datacenters: []interface{}{}}
+		simulator.submit(w, VCENTER_REGISTRATION, func() {
+			simulator.vCenters = append(simulator.vCenters, registered)
+		})
+	case len(path) >= 1:
+		var found *vCenter
+		index := 0
+		for i, vCenter := range simulator.vCenters {
+			if vCenter.VCenterUUID == path[0] {
+				found, index = vCenter, i
+			}
+		}
+
+		if found == nil {
+			writeError(w, http.StatusNotFound, "no such vCenter")
+			return
+		}
+
+		switch {
+		case r.Method == "DELETE" && len(path) == 1:
+			simulator.vCenters = append(simulator.vCenters[:index], simulator.vCenters[index+1:]...)
+			simulator.removeVirtualMachines(found.VCenterUUID)
+			w.WriteHeader(http.StatusOK)
+		case r.Method == "POST" && len(path) == 2 && path[1] == "sync":
+			simulator.submit(w, VCENTER_SYNC, nil)
+		case r.Method == "POST" && len(path) == 2 && path[1] == services.VIRTUAL_MACHINES:
+			simulator.submit(w, VM_SCAN, func() { simulator.scanVirtualMachines(found) })
+		case r.Method == "POST" && len(path) == 2 && path[1] == services.COMPONENTS:
+			simulator.submit(w, COMPONENT_SCAN, func() {
+				for _, virtualMachine := range simulator.virtualMachines {
+					if virtualMachine.vCenterUUID == found.VCenterUUID {
+						simulator.introspect(virtualMachine)
+					}
+				}
+			})
+		case r.Method == "POST" && len(path) == 2 && path[1] == "correlation":
+			simulator.submit(w, TOPOLOGY_DISCOVERY, func() { simulator.discoverTopology(found) })
+		default:
+			writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		}
+	default:
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+	}
+}
+
+// scanVirtualMachines adds the virtual machines of the vCenter the first time
+// it is scanned.
+func (simulator *Simulator) scanVirtualMachines(scanned *vCenter) {
+	for _, virtualMachine := range simulator.virtualMachines {
+		if virtualMachine.vCenterUUID == scanned.VCenterUUID {
+			return
+		}
+	}
+
+	for i := 1; i <= simulator.options.VirtualMachines; i++ {
+		name := fmt.Sprintf("%s-vm-%02d", scanned.VCName, i)
+		simulator.virtualMachines = append(simulator.virtualMachines, &virtualMachine{
+			ID:           simulator.newID("vm"),
+			Name:         name,
+			Network:      "VM Network",
+			Hostname:     name + ".example.com",
+			Datastore:    "datastore1",
+			IP:           fmt.Sprintf("10.0.%d.%d", len(simulator.vCenters), i),
+			NumCPU:       2 * i,
+			MemoryMB:     fmt.Sprint(1024 * i * i),
+			Services:     []string{"sshd", "tomcat"},
+			VcenterFqdn:  scanned.Fqdn,
+			DataCenter:   "Datacenter",
+			Cluster:      "Cluster",
+			ResourcePool: "Resources",
+			Folder:       "vm",
+			NumOfDisks:   1,
+			SizeOfDisks:  fmt.Sprint(16 * i),
+			vCenterUUID:  scanned.VCenterUUID,
+		})
+	}
+}
+
+func (simulator *Simulator) removeVirtualMachines(vCenterUUID string) {
+	var kept []*virtualMachine
+	for _, virtualMachine := range simulator.virtualMachines {
+		if virtualMachine.vCenterUUID != vCenterUUID {
+			kept = append(kept, virtualMachine)
+		}
+	}
+	simulator.virtualMachines = kept
+}
+
+// introspect records the components running on the virtual machine.
+func (simulator *Simulator) introspect(introspected *virtualMachine) {
+	now := time.Now().Format(time.RFC3339)
+
+	for _, component := range simulator.components {
+		if component.VMUUID == introspected.ID {
+			component.LastIntrospect = now
+			return
+		}
+	}
+
+	for _, name := range introspected.Services {
+		simulator.components = append(simulator.components, &component{
+			ID:                simulator.newID("component"),
+			VMName:            introspected.Name,
+			VMUUID:            introspected.ID,
+			Type:              name,
+			ProcessName:       name,
+			IsContainerizable: name != "sshd",
+			ServiceType:       "APP_SERVER",
+			CompName:          name + "@" + introspected.Name,
+			Owner:             "root",
+			LastIntrospect:    now,
+		})
+	}
+}
+
+// discoverTopology groups the components found on the vCenter into one
+// application.
+func (simulator *Simulator) discoverTopology(discovered *vCenter) {
+	discoveredApplication := &application{ID: simulator.newID("application"), Name: discovered.VCName + "-application"}
+
+	for _, virtualMachine := range simulator.virtualMachines {
+		if virtualMachine.vCenterUUID != discovered.VCenterUUID {
+			continue
+		}
+
+		group := componentsGroupedByVM{VMName: virtualMachine.Name}
+		for _, component := range simulator.components {
+			if component.VMUUID == virtualMachine.ID {
+				group.Components = append(group.Components, *component)
+			}
+		}
+
+		if len(group.Components) > 0 {
+			discoveredApplication.ComponentsGroupedByVMs = append(discoveredApplication.ComponentsGroupedByVMs, group)
+		}
+	}
+
+	if len(discoveredApplication.ComponentsGroupedByVMs) > 0 {
+		simulator.applications = append(simulator.applications, discoveredApplication)
+	}
+}
+
+func (simulator *Simulator) vrnisHandler(w http.ResponseWriter, r *http.Request, path []string) {
+	switch {
+	case r.Method == "GET" && len(path) == 0:
+		items := []*vrni{}
+		items = append(items, simulator.vrnis...)
+		writeJSON(w, http.StatusOK, items)
+	case (r.Method == "POST" && len(path) == 0) || (r.Method == "PUT" && len(path) == 1):
+		request := vrniRequest{}
+		if !decode(w, r, &request) {
+			return
+		}
+
+		instance := &vrni{ID: simulator.newID("vrni")}
+		if r.Method == "PUT" {
+			instance = simulator.findVRNI(path[0])
+			if instance == nil {
+				writeError(w, http.StatusNotFound, "no such vRNI")
+				return
+			}
+		} else {
+			for _, registered := range simulator.vrnis {
+				if registered.IP == request.Fqdn {
+					writeError(w, http.StatusConflict, fmt.Sprintf("vRNI %q is already registered", request.Fqdn))
+					return
+				}
+			}
+		}
+
+		if !simulator.updateVRNI(w, instance, request) {
+			return
+		}
+
+		if r.Method == "POST" {
+			simulator.vrnis = append(simulator.vrnis, instance)
+		}
+		w.WriteHeader(http.StatusOK)
+	case r.Method == "DELETE" && len(path) == 1:
+		for i, registered := range simulator.vrnis {
+			if registered.ID == path[0] {
+				simulator.vrnis = append(simulator.vrnis[:i], simulator.vrnis[i+1:]...)
+				w.WriteHeader(http.StatusNoContent)
+				return
+			}
+		}
+		writeError(w, http.StatusNotFound, "no such vRNI")
+	default:
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+	}
+}
+
+func (simulator *Simulator) findVRNI(id string) *vrni {
+	for _, registered := range simulator.vrnis {
+		if registered.ID == id {
+			return registered
+		}
+	}
+	return nil
+}
+
+// updateVRNI validates the request and copies it onto the instance, answering
+// 400 when it refers to unknown vCenters or service accounts.
+func (simulator *Simulator) updateVRNI(w http.ResponseWriter, instance *vrni, request vrniRequest) bool {
+	if len(request.CertificateThumbprint) == 0 {
+		writeError(w, http.StatusBadRequest, "the certificate thumbprint is required")
+		return false
+	}
+
+	var vCenters []vrniVCenter
+	for _, vCenterUUID := range request.VCenterUUIDs {
+		found := false
+		for _, vCenter := range simulator.vCenters {
+			if vCenter.VCenterUUID == vCenterUUID {
+				vCenters = append(vCenters, vrniVCenter{vCenter.Fqdn, vCenter.VCenterUUID, vCenter.VCName})
+				found = true
+			}
+		}
+
+		if !found {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("no such vCenter %q", vCenterUUID))
+			return false
+		}
+	}
+
+	instance.Alias = request.Alias
+	instance.IP = request.Fqdn
+	instance.IsSaaS = request.IsSaaS
+	instance.APIToken = request.APIToken
+	instance.ServiceAccountType = request.ServiceAccountType
+	if !request.IsSaaS && len(instance.ServiceAccountType) == 0 {
+		// On-premises instances registered without a type get LOCAL, so
+		// that clients cannot rely on reading back what they sent.
+		instance.ServiceAccountType = "LOCAL"
+	}
+	instance.VCenters = vCenters
+
+	if !request.IsSaaS {
+		serviceAccount := simulator.findServiceAccount("", request.ServiceAccountUUID)
+		if serviceAccount == nil {
+			writeError(w, http.StatusBadRequest, "no such service account")
+			return false
+		}
+		instance.ServiceAccount.UUID = serviceAccount.UUID
+		instance.ServiceAccount.Alias = serviceAccount.Alias
+	}
+
+	return true
+}
+
+func (simulator *Simulator) virtualMachinesHandler(w http.ResponseWriter, r *http.Request, path []string) {
+	switch {
+	case r.Method == "GET" && len(path) == 0:
+		query := r.URL.Query()
+		filters := map[string]func(*virtualMachine) string{
+			"vcenterFqdn":  func(vm *virtualMachine) string { return vm.VcenterFqdn },
+			"dataCenter":   func(vm *virtualMachine) string { return vm.DataCenter },
+			"cluster":      func(vm *virtualMachine) string { return vm.Cluster },
+			"resourcePool": func(vm *virtualMachine) string { return vm.ResourcePool },
+			"folder":       func(vm *virtualMachine) string { return vm.Folder },
+			"name":         func(vm *virtualMachine) string { return vm.Name },
+			"ip":           func(vm *virtualMachine) string { return vm.IP },
+		}
+
+		items := []interface{}{}
+		for _, virtualMachine := range simulator.virtualMachines {
+			matches := true
+			for parameter, field := range filters {
+				if value := query.Get(parameter); len(value) > 0 && field(virtualMachine) != value {
+					matches = false
+				}
+			}
+
+			if matches {
+				items = append(items, virtualMachine)
+			}
+		}
+		simulator.paginate(w, r, services.VIRTUAL_MACHINES, items)
+	case r.Method == "POST" && len(path) == 2 && path[1] == services.COMPONENTS:
+		for _, virtualMachine := range simulator.virtualMachines {
+			if virtualMachine.ID == path[0] {
+				introspected := virtualMachine
+				simulator.submit(w, INTROSPECTION, func() { simulator.introspect(introspected) })
+				return
+			}
+		}
+		writeError(w, http.StatusNotFound, "no such virtual machine")
+	default:
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+	}
+}
+
+func (simulator *Simulator) tasksHandler(w http.ResponseWriter, r *http.Request, path []string) {
+	switch {
+	case r.Method == "GET" && len(path) == 0:
+		status := r.URL.Query().Get("status")
+		taskType := r.URL.Query().Get("type")
+
+		items := []interface{}{}
+		for i := len(simulator.tasks) - 1; i >= 0; i-- {
+			simulated := simulator.tasks[i]
+			if (len(status) == 0 || strings.EqualFold(simulated.Status, status)) &&
+				(len(taskType) == 0 || strings.EqualFold(simulated.Type, taskType)) {
+				items = append(items, simulated.task)
+			}
+		}
+		simulator.paginate(w, r, services.TASKS, items)
+	case len(path) >= 1:
+		var found *simulatedTask
+		for _, simulated := range simulator.tasks {
+			if simulated.ID == path[0] {
+				found = simulated
+			}
+		}
+
+		if found == nil {
+			writeError(w, http.StatusNotFound, "no such task")
+			return
+		}
+
+		switch {
+		case r.Method == "GET" && len(path) == 1:
+			writeJSON(w, http.StatusOK, found.task)
+		case r.Method == "POST" && len(path) == 2 && path[1] == services.CANCEL:
+			if found.Status != "NOT_STARTED" && found.Status != "IN_PROGRESS" {
+				writeError(w, http.StatusConflict, "the task has already finished")
+				return
+			}
+
+			found.Status = "CANCELLED"
+			found.Message = "Cancelled by the user"
+			w.WriteHeader(http.StatusAccepted)
+		default:
+			writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		}
+	default:
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+	}
+}
@@ -0,0 +1,145 @@
+package simulator
+
+// The types below mirror the JSON documents exchanged with Application
+// Transformer. They are kept separate from the client models so that the
+// simulator catches a client drifting away from the API.
+
+type authRequest struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
+type refreshRequest struct {
+	RefreshToken string `json:"token"`
+}
+
+type serviceAccount struct {
+	UUID     string `json:"uuid"`
+	Alias    string `json:"alias"`
+	Username string `json:"username"`
+	password string
+}
+
+type serviceAccountRequest struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+	Alias    string `json:"alias"`
+}
+
+type globalDefaultRequest struct {
+	ServiceAccountUUID string `json:"serviceAccountUUID"`
+}
+
+type vCenter struct {
+	Fqdn        string        `json:"fqdn"`
+	VCenterUUID string        `json:"irisVcenterUUID"`
+	VCName      string        `json:"vcName"`
+	Datacenters []interface{} `json:"dataCenters"`
+}
+
+type vCenterRequest struct {
+	Fqdn                  string `json:"fqdn"`
+	VCName                string `json:"vcName"`
+	VCServiceAccountUUID  string `json:"vcServiceAccountUUID"`
+	CertificateThumbprint string `json:"certificateThumbprint"`
+}
+
+type vrniVCenter struct {
+	Fqdn        string `json:"fqdn"`
+	VCenterUUID string `json:"irisVcenterUUID"`
+	VCName      string `json:"vcName"`
+}
+
+type vrni struct {
+	Alias              string        `json:"alias"`
+	ID                 string        `json:"id"`
+	IP                 string        `json:"ip"`
+	ServiceAccountType string        `json:"vrniType"`
+	IsSaaS             bool          `json:"isSaaS"`
+	APIToken           string        `json:"apiToken"`
+	VCenters           []vrniVCenter `json:"vcenters"`
+	ServiceAccount     struct {
+		UUID  string `json:"uuid"`
+		Alias string `json:"alias"`
+	} `json:"serviceAccount"`
+}
+
+type vrniRequest struct {
+	Alias                 string   `json:"alias"`
+	Fqdn                  string   `json:"ip"`
+	APIToken              string   `json:"apiToken"`
+	IsSaaS                bool     `json:"isSaas"`
+	VCenterUUIDs          []string `json:"vcUuids"`
+	ServiceAccountUUID    string   `json:"serviceAccountUUID"`
+	CertificateThumbprint string   `json:"certificateThumbprint"`
+	ServiceAccountType    string   `json:"vrniType"`
+}
+
+type virtualMachine struct {
+	ID           string   `json:"id"`
+	Name         string   `json:"name"`
+	Network      string   `json:"network"`
+	Hostname     string   `json:"hostname"`
+	Datastore    string   `json:"datastore"`
+	IP           string   `json:"ip"`
+	NumCPU       int      `json:"numCPU"`
+	MemoryMB     string   `json:"memoryMB"`
+	Services     []string `json:"services"`
+	VcenterFqdn  string   `json:"vcenterFqdn"`
+	DataCenter   string   `json:"dataCenter"`
+	Cluster      string   `json:"cluster"`
+	ResourcePool string   `json:"resourcePool"`
+	Folder       string   `json:"folder"`
+	NumOfDisks   int      `json:"numOfDisks"`
+	SizeOfDisks  string   `json:"sizeOfDisks"`
+	vCenterUUID  string
+}
+
+type component struct {
+	ID                string `json:"id"`
+	VMName            string `json:"vmName"`
+	VMUUID            string `json:"vmUUID"`
+	Type              string `json:"type"`
+	ProcessName       string `json:"processName"`
+	IsContainerizable bool   `json:"isContainerizable"`
+	ServiceType       string `json:"serviceType"`
+	CompName          string `json:"compName"`
+	Owner             string `json:"owner"`
+	LastIntrospect    string `json:"lastIntrospect"`
+}
+
+type componentsGroupedByVM struct {
+	VMName     string      `json:"vmName"`
+	Components []component `json:"components"`
+}
+
+type application struct {
+	ID                     string                  `json:"id"`
+	Name                   string                  `json:"name"`
+	ComponentsGroupedByVMs []componentsGroupedByVM `json:"componentsGroupedByVMs"`
+}
+
+type taskSubmitted struct {
+	TaskID string `json:"task_id"`
+}
+
+type task struct {
+	ID              string  `json:"id"`
+	Type            string  `json:"type"`
+	Status          string  `json:"status"`
+	Message         string  `json:"message,omitempty"`
+	Created         int64   `json:"created"`
+	LastUpdated     int64   `json:"lastUpdated"`
+	PercentComplete float64 `json:"percentComplete,omitempty"`
+}
+
+type link struct {
+	Href string `json:"href"`
+}
+
+type page struct {
+	Size          int `json:"size"`
+	TotalElements int `json:"totalElements"`
+	TotalPages    int `json:"totalPages"`
+	Number        int `json:"number"`
+}
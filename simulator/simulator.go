@@ -0,0 +1,406 @@
+// Package simulator is an in-memory fake of the Application Transformer
+// discovery and auth-manager APIs, for exercising the CLI and the services
+// client without an appliance.
+//
+// In Go code, start one with New and point a client at its Address:
+//
+//	sim := simulator.New(simulator.Options{})
+//	defer sim.Close()
+//
+//	client, err := sim.Client()
+//
+// From the shell, run 'tanzu-apptx-cli simulator serve' and pass the printed
+// address to -fqdn together with -insecure.
+//
+// vCenters and vRNI instances are registered with the simulator address as
+// their FQDN, as the client connects to them to read their certificate.
+package simulator
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"gitlab.eng.vmware.com/vmware-navigator-practice/tooling/tanzu-apptx-cli/services"
+)
+
+// Task types, used as keys of Options.Outcomes.
+const (
+	VCENTER_REGISTRATION = "VCENTER_REGISTRATION"
+	VCENTER_SYNC         = "VCENTER_SYNC"
+	VM_SCAN              = "VM_SCAN"
+	COMPONENT_SCAN       = "COMPONENT_SCAN"
+	TOPOLOGY_DISCOVERY   = "TOPOLOGY_DISCOVERY"
+	INTROSPECTION        = "INTROSPECTION"
+)
+
+// Options configures a simulator. The zero value accepts admin/admin and
+// completes every task successfully after one second.
+type Options struct {
+	Username string
+	Password string
+	// TaskDuration is how long submitted tasks stay IN_PROGRESS.
+	TaskDuration time.Duration
+	// TaskOutcome is the final status of tasks, SUCCESS when empty.
+	TaskOutcome string
+	// Outcomes overrides TaskOutcome per task type, ex: COMPONENT_SCAN:
+	// PARTIAL_SUCCESS.
+	Outcomes map[string]string
+	// TokenTTL is the lifetime of session tokens, one hour when zero.
+	TokenTTL time.Duration
+	// PageSize is the default page size of list endpoints, 20 when zero.
+	PageSize int
+	// VirtualMachines is the number of virtual machines found by a scan of
+	// each vCenter, 3 when zero.
+	VirtualMachines int
+	// LinkBase prefixes the links of paginated responses, ex: the internal
+	// address of an appliance behind a proxy. Links are relative when empty.
+	LinkBase string
+}
+
+// Simulator serves the fake APIs over TLS, with HTTP/2 like the appliance.
+type Simulator struct {
+	Server  *httptest.Server
+	options Options
+
+	mutex           sync.Mutex
+	ids             int
+	tokens          map[string]time.Time
+	refreshTokens   map[string]bool
+	serviceAccounts []*serviceAccount
+	defaults        map[string]string
+	vCenters        []*vCenter
+	vrnis           []*vrni
+	virtualMachines []*virtualMachine
+	components      []*component
+	applications    []*application
+	tasks           []*simulatedTask
+}
+
+// simulatedTask is a task together with the time it finishes and the change
+// it applies to the inventory when it does.
+type simulatedTask struct {
+	task
+	finishes time.Time
+	outcome  string
+	apply    func()
+}
+
+// New starts a simulator on a random local port.
+func New(options Options) *Simulator {
+	simulator := newSimulator(options)
+	simulator.Server = httptest.NewUnstartedServer(simulator)
+	simulator.Server.EnableHTTP2 = true
+	simulator.Server.StartTLS()
+	return simulator
+}
+
+// Listen starts a simulator on the given address, ex: 127.0.0.1:8443.
+func Listen(address string, options Options) (*Simulator, error) {
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		return nil, err
+	}
+
+	simulator := newSimulator(options)
+	simulator.Server = httptest.NewUnstartedServer(simulator)
+	simulator.Server.Listener.Close()
+	simulator.Server.Listener = listener
+	simulator.Server.EnableHTTP2 = true
+	simulator.Server.StartTLS()
+	return simulator, nil
+}
+
+func newSimulator(options Options) *Simulator {
+	if len(options.Username) == 0 && len(options.Password) == 0 {
+		options.Username = "admin"
+		options.Password = "admin"
+	}
+
+	if options.TaskDuration == 0 {
+		options.TaskDuration = time.Second
+	}
+
+	if len(options.TaskOutcome) == 0 {
+		options.TaskOutcome = "SUCCESS"
+	}
+
+	if options.TokenTTL == 0 {
+		options.TokenTTL = time.Hour
+	}
+
+	if options.PageSize == 0 {
+		options.PageSize = 20
+	}
+
+	if options.VirtualMachines == 0 {
+		options.VirtualMachines = 3
+	}
+
+	return &Simulator{
+		options:       options,
+		tokens:        map[string]time.Time{},
+		refreshTokens: map[string]bool{},
+		defaults:      map[string]string{},
+	}
+}
+
+// Address returns the host:port to use as the appliance FQDN.
+func (simulator *Simulator) Address() string {
+	return simulator.Server.Listener.Addr().String()
+}
+
+// Close shuts the simulator down.
+func (simulator *Simulator) Close() {
+	simulator.Server.Close()
+}
+
+// Client returns a services client authenticated against the simulator. The
+// simulator certificate is trusted without being recorded in known hosts.
+func (simulator *Simulator) Client() (*services.Client, error) {
+	client, err := services.NewClient(services.Request{URL: simulator.Address(), Username: simulator.options.Username, Password: simulator.options.Password})
+	if err != nil {
+		return nil, err
+	}
+
+	err = client.SetTLSOptions(services.TLSOptions{Insecure: true, KnownHostsFile: os.DevNull})
+	if err != nil {
+		return nil, err
+	}
+
+	return client, client.Authenticate()
+}
+
+// SetOutcome changes the final status of the tasks of the given type
+// submitted from now on.
+func (simulator *Simulator) SetOutcome(taskType string, status string) {
+	simulator.mutex.Lock()
+	defer simulator.mutex.Unlock()
+
+	if simulator.options.Outcomes == nil {
+		simulator.options.Outcomes = map[string]string{}
+	}
+	simulator.options.Outcomes[taskType] = status
+}
+
+// ServeHTTP routes a request to the auth-manager or discovery handlers.
+func (simulator *Simulator) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	simulator.mutex.Lock()
+	defer simulator.mutex.Unlock()
+
+	simulator.finishTasks()
+
+	path := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+
+	switch {
+	case len(path) >= 2 && path[0] == services.AUTHMANAGER && path[1] == services.SESSION:
+		simulator.session(w, r, path[2:])
+	case len(path) >= 2 && path[0] == services.PREFIX:
+		if !simulator.authorized(r) {
+			writeError(w, http.StatusUnauthorized, "invalid or expired session token")
+			return
+		}
+		simulator.discovery(w, r, path[1:])
+	default:
+		writeError(w, http.StatusNotFound, "no such endpoint")
+	}
+}
+
+// session handles login, refresh and logout.
+func (simulator *Simulator) session(w http.ResponseWriter, r *http.Request, path []string) {
+	switch {
+	case r.Method == "POST" && len(path) == 0:
+		request := authRequest{}
+		if !decode(w, r, &request) {
+			return
+		}
+
+		if request.Username != simulator.options.Username || request.Password != simulator.options.Password {
+			writeError(w, http.StatusUnauthorized, "invalid username or password")
+			return
+		}
+
+		simulator.issueSession(w)
+	case r.Method == "POST" && len(path) == 1 && path[0] == services.REFRESH:
+		request := refreshRequest{}
+		if !decode(w, r, &request) {
+			return
+		}
+
+		if !simulator.refreshTokens[request.RefreshToken] {
+			writeError(w, http.StatusUnauthorized, "invalid refresh token")
+			return
+		}
+
+		delete(simulator.refreshTokens, request.RefreshToken)
+		simulator.issueSession(w)
+	case r.Method == "DELETE" && len(path) == 0:
+		if !simulator.authorized(r) {
+			writeError(w, http.StatusUnauthorized, "invalid or expired session token")
+			return
+		}
+
+		delete(simulator.tokens, bearer(r))
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+	}
+}
+
+// issueSession returns a new session token as a cookie and a refresh token in
+// the body. Session tokens are unsigned JWTs so that clients can read their
+// expiry.
+func (simulator *Simulator) issueSession(w http.ResponseWriter) {
+	expiry := time.Now().Add(simulator.options.TokenTTL)
+
+	header := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"none","typ":"JWT"}`))
+	claims := base64.RawURLEncoding.EncodeToString([]byte(fmt.Sprintf(`{"sub":%q,"exp":%d,"jti":%q}`,
+		simulator.options.Username, expiry.Unix(), simulator.newID("session"))))
+	token := header + "." + claims + ".simulator"
+
+	refreshToken := simulator.newID("refresh")
+
+	simulator.tokens[token] = expiry
+	simulator.refreshTokens[refreshToken] = true
+
+	http.SetCookie(w, &http.Cookie{Name: services.AUTH_TOKEN, Value: token, Path: "/", Secure: true, HttpOnly: true})
+	writeJSON(w, http.StatusOK, refreshRequest{RefreshToken: refreshToken})
+}
+
+// authorized reports whether the request carries a live session token.
+func (simulator *Simulator) authorized(r *http.Request) bool {
+	expiry, found := simulator.tokens[bearer(r)]
+	return found && time.Now().Before(expiry)
+}
+
+func bearer(r *http.Request) string {
+	return strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+}
+
+// newID returns a unique identifier with the given prefix.
+func (simulator *Simulator) newID(prefix string) string {
+	simulator.ids++
+	return fmt.Sprintf("%s-%04d", prefix, simulator.ids)
+}
+
+// submit creates a task of the given type. apply runs when the task finishes
+// with SUCCESS or PARTIAL_SUCCESS.
+func (simulator *Simulator) submit(w http.ResponseWriter, taskType string, apply func()) {
+	outcome := simulator.options.TaskOutcome
+	if status, found := simulator.options.Outcomes[taskType]; found {
+		outcome = status
+	}
+
+	now := time.Now()
+	simulated := &simulatedTask{
+		task: task{
+			ID:          simulator.newID("task"),
+			Type:        taskType,
+			Status:      "NOT_STARTED",
+			Created:     now.UnixNano() / int64(time.Millisecond),
+			LastUpdated: now.UnixNano() / int64(time.Millisecond),
+		},
+		finishes: now.Add(simulator.options.TaskDuration),
+		outcome:  outcome,
+		apply:    apply,
+	}
+
+	simulator.tasks = append(simulator.tasks, simulated)
+	writeJSON(w, http.StatusAccepted, taskSubmitted{simulated.ID})
+}
+
+// finishTasks advances running tasks to their current state.
+func (simulator *Simulator) finishTasks() {
+	now := time.Now()
+
+	for _, simulated := range simulator.tasks {
+		if simulated.Status != "NOT_STARTED" && simulated.Status != "IN_PROGRESS" {
+			continue
+		}
+
+		simulated.LastUpdated = now.UnixNano() / int64(time.Millisecond)
+
+		if now.Before(simulated.finishes) {
+			elapsed := now.Sub(time.Unix(0, simulated.Created*int64(time.Millisecond)))
+			simulated.Status = "IN_PROGRESS"
+			simulated.PercentComplete = 100 * elapsed.Seconds() / simulator.options.TaskDuration.Seconds()
+			continue
+		}
+
+		simulated.Status = simulated.outcome
+		simulated.PercentComplete = 100
+		if simulated.Status != "SUCCESS" {
+			simulated.Message = "Simulated " + strings.ToLower(simulated.Status)
+		}
+
+		if (simulated.Status == "SUCCESS" || simulated.Status == "PARTIAL_SUCCESS") && simulated.apply != nil {
+			simulated.apply()
+		}
+	}
+}
+
+// paginate writes the items of the requested page as a HAL document with the
+// items embedded under name.
+func (simulator *Simulator) paginate(w http.ResponseWriter, r *http.Request, name string, items []interface{}) {
+	size := simulator.options.PageSize
+	if value, err := strconv.Atoi(r.URL.Query().Get("size")); err == nil && value > 0 {
+		size = value
+	}
+
+	number := 0
+	if value, err := strconv.Atoi(r.URL.Query().Get("page")); err == nil && value > 0 {
+		number = value
+	}
+
+	start := number * size
+	if start > len(items) {
+		start = len(items)
+	}
+
+	end := start + size
+	if end > len(items) {
+		end = len(items)
+	}
+
+	document := map[string]interface{}{
+		"_embedded": map[string]interface{}{name: items[start:end]},
+		"page":      page{Size: size, TotalElements: len(items), TotalPages: (len(items) + size - 1) / size, Number: number},
+	}
+
+	if end < len(items) {
+		query := r.URL.Query()
+		query.Set("page", strconv.Itoa(number+1))
+		query.Set("size", strconv.Itoa(size))
+		document["_links"] = map[string]interface{}{"next": link{simulator.options.LinkBase + r.URL.Path + "?" + query.Encode()}}
+	}
+
+	writeJSON(w, http.StatusOK, document)
+}
+
+// decode reads the JSON request body into value, answering 400 when it is
+// malformed.
+func decode(w http.ResponseWriter, r *http.Request, value interface{}) bool {
+	if err := json.NewDecoder(r.Body).Decode(value); err != nil {
+		writeError(w, http.StatusBadRequest, "malformed request body: "+err.Error())
+		return false
+	}
+	return true
+}
+
+func writeJSON(w http.ResponseWriter, status int, value interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(value)
+}
+
+func writeError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, map[string]interface{}{"status": status, "message": message})
+}
@@ -0,0 +1,384 @@
+package simulator
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"gitlab.eng.vmware.com/vmware-navigator-practice/tooling/tanzu-apptx-cli/services"
+)
+
+// taskDuration is short enough for the tests to wait for the tasks to finish.
+const taskDuration = 10 * time.Millisecond
+
+// serve sends a request to the handlers of the simulator, with the session
+// token when there is one, and returns the response.
+func serve(t *testing.T, simulator *Simulator, method string, path string, token string, body interface{}) *httptest.ResponseRecorder {
+	t.Helper()
+
+	payload := []byte{}
+	if body != nil {
+		var err error
+		if payload, err = json.Marshal(body); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	request := httptest.NewRequest(method, path, bytes.NewReader(payload))
+	if len(token) > 0 {
+		request.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	response := httptest.NewRecorder()
+	simulator.ServeHTTP(response, request)
+	return response
+}
+
+// expect checks the status of a response and decodes its body into value,
+// when value is set.
+func expect(t *testing.T, response *httptest.ResponseRecorder, status int, value interface{}) {
+	t.Helper()
+
+	if response.Code != status {
+		t.Fatalf("expected status %d, got %d: %s", status, response.Code, response.Body.String())
+	}
+
+	if value != nil {
+		if err := json.Unmarshal(response.Body.Bytes(), value); err != nil {
+			t.Fatalf("failed to decode %s: %v", response.Body.String(), err)
+		}
+	}
+}
+
+// login opens a session and returns its token and refresh token.
+func login(t *testing.T, simulator *Simulator) (string, string) {
+	t.Helper()
+
+	response := serve(t, simulator, "POST", "/"+services.AUTHMANAGER+"/"+services.SESSION, "", authRequest{"admin", "admin"})
+	refresh := refreshRequest{}
+	expect(t, response, http.StatusOK, &refresh)
+
+	for _, cookie := range response.Result().Cookies() {
+		if cookie.Name == services.AUTH_TOKEN {
+			return cookie.Value, refresh.RefreshToken
+		}
+	}
+
+	t.Fatalf("expected the session token in the %s cookie", services.AUTH_TOKEN)
+	return "", ""
+}
+
+// discovery returns the path of a discovery endpoint.
+func discovery(parts ...string) string {
+	return "/" + services.PREFIX + "/" + strings.Join(parts, "/")
+}
+
+// finish submits a task with the request and waits until it finished.
+func finish(t *testing.T, simulator *Simulator, method string, path string, token string, body interface{}) task {
+	t.Helper()
+
+	submitted := taskSubmitted{}
+	expect(t, serve(t, simulator, method, path, token, body), http.StatusAccepted, &submitted)
+
+	time.Sleep(2 * taskDuration)
+
+	finished := task{}
+	expect(t, serve(t, simulator, "GET", discovery(services.TASKS, submitted.TaskID), token, nil), http.StatusOK, &finished)
+	return finished
+}
+
+// register creates a service account and registers a vCenter with it.
+func register(t *testing.T, simulator *Simulator, token string, name string) *vCenter {
+	t.Helper()
+
+	created := serviceAccount{}
+	expect(t, serve(t, simulator, "POST", discovery(services.SERVICE_ACCOUNTS), token, serviceAccountRequest{"administrator", "secret", name}), http.StatusCreated, &created)
+
+	request := vCenterRequest{Fqdn: name + ".example.com", VCName: name, VCServiceAccountUUID: created.UUID, CertificateThumbprint: "AA:BB"}
+	if finished := finish(t, simulator, "POST", discovery(services.VCENTERS), token, request); finished.Status != "SUCCESS" {
+		t.Fatalf("expected the registration to succeed, got %s", finished.Status)
+	}
+
+	for _, registered := range simulator.vCenters {
+		if registered.VCName == name {
+			return registered
+		}
+	}
+
+	t.Fatalf("expected the vCenter %s to be registered", name)
+	return nil
+}
+
+func TestSession(t *testing.T) {
+	simulator := newSimulator(Options{})
+
+	expect(t, serve(t, simulator, "POST", "/"+services.AUTHMANAGER+"/"+services.SESSION, "", authRequest{"admin", "wrong"}), http.StatusUnauthorized, nil)
+
+	token, refreshToken := login(t, simulator)
+	expect(t, serve(t, simulator, "GET", discovery(services.VCENTERS), token, nil), http.StatusOK, nil)
+
+	refreshPath := "/" + services.AUTHMANAGER + "/" + services.SESSION + "/" + services.REFRESH
+	expect(t, serve(t, simulator, "POST", refreshPath, "", refreshRequest{refreshToken}), http.StatusOK, nil)
+	expect(t, serve(t, simulator, "POST", refreshPath, "", refreshRequest{refreshToken}), http.StatusUnauthorized, nil)
+
+	expect(t, serve(t, simulator, "DELETE", "/"+services.AUTHMANAGER+"/"+services.SESSION, token, nil), http.StatusNoContent, nil)
+	expect(t, serve(t, simulator, "GET", discovery(services.VCENTERS), token, nil), http.StatusUnauthorized, nil)
+	expect(t, serve(t, simulator, "DELETE", "/"+services.AUTHMANAGER+"/"+services.SESSION, token, nil), http.StatusUnauthorized, nil)
+}
+
+func TestAuthorization(t *testing.T) {
+	simulator := newSimulator(Options{TokenTTL: taskDuration})
+	token, _ := login(t, simulator)
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		token  string
+		status int
+	}{
+		{"no token", "GET", discovery(services.VCENTERS), "", http.StatusUnauthorized},
+		{"unknown token", "GET", discovery(services.VCENTERS), "forged", http.StatusUnauthorized},
+		{"unknown endpoint", "GET", "/elsewhere", token, http.StatusNotFound},
+		{"unknown discovery endpoint", "GET", discovery("elsewhere"), token, http.StatusNotFound},
+		{"method not allowed", "PATCH", discovery(services.VCENTERS), token, http.StatusMethodNotAllowed},
+		{"malformed body", "POST", discovery(services.SERVICE_ACCOUNTS), token, http.StatusBadRequest},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			request := httptest.NewRequest(test.method, test.path, strings.NewReader("{"))
+			request.Header.Set("Authorization", "Bearer "+test.token)
+			response := httptest.NewRecorder()
+			simulator.ServeHTTP(response, request)
+			expect(t, response, test.status, nil)
+		})
+	}
+
+	time.Sleep(taskDuration)
+	expect(t, serve(t, simulator, "GET", discovery(services.VCENTERS), token, nil), http.StatusUnauthorized, nil)
+}
+
+func TestServiceAccounts(t *testing.T) {
+	simulator := newSimulator(Options{})
+	token, _ := login(t, simulator)
+
+	created := serviceAccount{}
+	expect(t, serve(t, simulator, "POST", discovery(services.SERVICE_ACCOUNTS), token, serviceAccountRequest{"administrator", "secret", "sa1"}), http.StatusCreated, &created)
+	expect(t, serve(t, simulator, "POST", discovery(services.SERVICE_ACCOUNTS), token, serviceAccountRequest{"administrator", "secret", "sa1"}), http.StatusConflict, nil)
+	expect(t, serve(t, simulator, "POST", discovery(services.SERVICE_ACCOUNTS), token, serviceAccountRequest{"administrator", "secret", "sa2"}), http.StatusCreated, nil)
+
+	list := struct {
+		Embedded struct {
+			ServiceAccounts []serviceAccount `json:"serviceAccounts"`
+		} `json:"_embedded"`
+	}{}
+	expect(t, serve(t, simulator, "GET", discovery(services.SERVICE_ACCOUNTS)+"?alias=sa1", token, nil), http.StatusOK, &list)
+	if len(list.Embedded.ServiceAccounts) != 1 || list.Embedded.ServiceAccounts[0].UUID != created.UUID {
+		t.Errorf("expected the alias to select sa1, got %+v", list.Embedded.ServiceAccounts)
+	}
+	if strings.Contains(serve(t, simulator, "GET", discovery(services.SERVICE_ACCOUNTS), token, nil).Body.String(), "secret") {
+		t.Error("expected the passwords to be left out of the list")
+	}
+
+	expect(t, serve(t, simulator, "POST", discovery(services.SERVICE_ACCOUNTS, "defaults", "VCENTER"), token, globalDefaultRequest{"unknown"}), http.StatusBadRequest, nil)
+	expect(t, serve(t, simulator, "POST", discovery(services.SERVICE_ACCOUNTS, "defaults", "VCENTER"), token, globalDefaultRequest{created.UUID}), http.StatusOK, nil)
+	if simulator.defaults["VCENTER"] != created.UUID {
+		t.Errorf("expected sa1 to be the VCENTER default, got %q", simulator.defaults["VCENTER"])
+	}
+
+	expect(t, serve(t, simulator, "DELETE", discovery(services.SERVICE_ACCOUNTS, created.UUID), token, nil), http.StatusOK, nil)
+	expect(t, serve(t, simulator, "DELETE", discovery(services.SERVICE_ACCOUNTS, created.UUID), token, nil), http.StatusNotFound, nil)
+}
+
+func TestVCenterTasks(t *testing.T) {
+	simulator := newSimulator(Options{TaskDuration: taskDuration, VirtualMachines: 2, Outcomes: map[string]string{TOPOLOGY_DISCOVERY: "FAILED"}})
+	token, _ := login(t, simulator)
+
+	expect(t, serve(t, simulator, "POST", discovery(services.VCENTERS), token, vCenterRequest{Fqdn: "vc1.example.com", VCName: "vc1"}), http.StatusBadRequest, nil)
+
+	registered := register(t, simulator, token, "vc1")
+	expect(t, serve(t, simulator, "POST", discovery(services.VCENTERS), token, vCenterRequest{Fqdn: "vc1.example.com", VCName: "vc1"}), http.StatusConflict, nil)
+
+	if finished := finish(t, simulator, "POST", discovery(services.VCENTERS, registered.VCenterUUID, services.VIRTUAL_MACHINES), token, nil); finished.Status != "SUCCESS" || finished.PercentComplete != 100 {
+		t.Errorf("expected the scan to succeed, got %+v", finished)
+	}
+	if len(simulator.virtualMachines) != 2 {
+		t.Fatalf("expected the scan to find 2 virtual machines, got %d", len(simulator.virtualMachines))
+	}
+
+	if finished := finish(t, simulator, "POST", discovery(services.VCENTERS, registered.VCenterUUID, services.COMPONENTS), token, nil); finished.Status != "SUCCESS" {
+		t.Errorf("expected the component scan to succeed, got %s", finished.Status)
+	}
+	if len(simulator.components) != 4 {
+		t.Errorf("expected 2 components per virtual machine, got %d", len(simulator.components))
+	}
+
+	// A failed task leaves the inventory as it was.
+	finished := finish(t, simulator, "POST", discovery(services.VCENTERS, registered.VCenterUUID, "correlation"), token, nil)
+	if finished.Status != "FAILED" || len(finished.Message) == 0 {
+		t.Errorf("expected the topology discovery to fail with a message, got %+v", finished)
+	}
+	if len(simulator.applications) != 0 {
+		t.Errorf("expected no application after a failed discovery, got %d", len(simulator.applications))
+	}
+
+	simulator.SetOutcome(TOPOLOGY_DISCOVERY, "PARTIAL_SUCCESS")
+	if finished := finish(t, simulator, "POST", discovery(services.VCENTERS, registered.VCenterUUID, "correlation"), token, nil); finished.Status != "PARTIAL_SUCCESS" {
+		t.Errorf("expected the topology discovery to partially succeed, got %s", finished.Status)
+	}
+	if len(simulator.applications) != 1 {
+		t.Errorf("expected a partial success to discover the application, got %d", len(simulator.applications))
+	}
+
+	expect(t, serve(t, simulator, "POST", discovery(services.VCENTERS, "unknown", "sync"), token, nil), http.StatusNotFound, nil)
+	expect(t, serve(t, simulator, "DELETE", discovery(services.VCENTERS, registered.VCenterUUID), token, nil), http.StatusOK, nil)
+	if len(simulator.vCenters) != 0 || len(simulator.virtualMachines) != 0 {
+		t.Errorf("expected the vCenter and its virtual machines to be removed, got %d and %d", len(simulator.vCenters), len(simulator.virtualMachines))
+	}
+}
+
+func TestTaskProgress(t *testing.T) {
+	simulator := newSimulator(Options{TaskDuration: time.Hour})
+	token, _ := login(t, simulator)
+
+	submitted := taskSubmitted{}
+	expect(t, serve(t, simulator, "POST", discovery(services.SERVICE_ACCOUNTS), token, serviceAccountRequest{"administrator", "secret", "sa"}), http.StatusCreated, nil)
+	request := vCenterRequest{Fqdn: "vc1.example.com", VCName: "vc1", VCServiceAccountUUID: simulator.serviceAccounts[0].UUID, CertificateThumbprint: "AA:BB"}
+	expect(t, serve(t, simulator, "POST", discovery(services.VCENTERS), token, request), http.StatusAccepted, &submitted)
+
+	running := task{}
+	expect(t, serve(t, simulator, "GET", discovery(services.TASKS, submitted.TaskID), token, nil), http.StatusOK, &running)
+	if running.Status != "IN_PROGRESS" || running.Type != VCENTER_REGISTRATION {
+		t.Errorf("expected a registration in progress, got %+v", running)
+	}
+	if len(simulator.vCenters) != 0 {
+		t.Error("expected the vCenter to be registered once the task finishes")
+	}
+
+	expect(t, serve(t, simulator, "GET", discovery(services.TASKS, "unknown"), token, nil), http.StatusNotFound, nil)
+}
+
+func TestListTasks(t *testing.T) {
+	simulator := newSimulator(Options{TaskDuration: taskDuration, Outcomes: map[string]string{VCENTER_SYNC: "FAILED"}})
+	token, _ := login(t, simulator)
+	registered := register(t, simulator, token, "vc1")
+
+	finish(t, simulator, "POST", discovery(services.VCENTERS, registered.VCenterUUID, "sync"), token, nil)
+	finish(t, simulator, "POST", discovery(services.VCENTERS, registered.VCenterUUID, services.VIRTUAL_MACHINES), token, nil)
+
+	tests := []struct {
+		query    string
+		expected []string
+	}{
+		{"", []string{VM_SCAN, VCENTER_SYNC, VCENTER_REGISTRATION}},
+		{"?status=failed", []string{VCENTER_SYNC}},
+		{"?type=VM_SCAN", []string{VM_SCAN}},
+		{"?status=SUCCESS&type=VCENTER_SYNC", nil},
+	}
+
+	for _, test := range tests {
+		t.Run(test.query, func(t *testing.T) {
+			list := struct {
+				Embedded struct {
+					Tasks []task `json:"tasks"`
+				} `json:"_embedded"`
+			}{}
+			expect(t, serve(t, simulator, "GET", discovery(services.TASKS)+test.query, token, nil), http.StatusOK, &list)
+
+			var types []string
+			for _, listed := range list.Embedded.Tasks {
+				types = append(types, listed.Type)
+			}
+			if strings.Join(types, ",") != strings.Join(test.expected, ",") {
+				t.Errorf("expected %v, got %v", test.expected, types)
+			}
+		})
+	}
+}
+
+func TestPaginate(t *testing.T) {
+	simulator := newSimulator(Options{TaskDuration: taskDuration, PageSize: 2, VirtualMachines: 5})
+	token, _ := login(t, simulator)
+	registered := register(t, simulator, token, "vc1")
+	finish(t, simulator, "POST", discovery(services.VCENTERS, registered.VCenterUUID, services.VIRTUAL_MACHINES), token, nil)
+
+	type listPage struct {
+		Embedded struct {
+			VirtualMachines []virtualMachine `json:"virtualMachines"`
+		} `json:"_embedded"`
+		Links struct {
+			Next *link `json:"next"`
+		} `json:"_links"`
+		Page page `json:"page"`
+	}
+
+	tests := []struct {
+		query string
+		names []string
+		next  string
+	}{
+		{"", []string{"vc1-vm-01", "vc1-vm-02"}, "page=1&size=2"},
+		{"?page=1", []string{"vc1-vm-03", "vc1-vm-04"}, "page=2&size=2"},
+		{"?page=2", []string{"vc1-vm-05"}, ""},
+		{"?page=9", nil, ""},
+		{"?size=4&page=1", []string{"vc1-vm-05"}, ""},
+		{"?size=3&name=vc1-vm-04", []string{"vc1-vm-04"}, ""},
+		{"?ip=10.0.1.2", []string{"vc1-vm-02"}, ""},
+	}
+
+	for _, test := range tests {
+		t.Run(test.query, func(t *testing.T) {
+			listed := listPage{}
+			expect(t, serve(t, simulator, "GET", discovery(services.VIRTUAL_MACHINES)+test.query, token, nil), http.StatusOK, &listed)
+
+			var names []string
+			for _, virtualMachine := range listed.Embedded.VirtualMachines {
+				names = append(names, virtualMachine.Name)
+			}
+			if strings.Join(names, ",") != strings.Join(test.names, ",") {
+				t.Errorf("expected %v, got %v", test.names, names)
+			}
+
+			if len(test.next) == 0 && listed.Links.Next != nil {
+				t.Errorf("expected no next page, got %s", listed.Links.Next.Href)
+			} else if len(test.next) > 0 && (listed.Links.Next == nil || !strings.HasSuffix(listed.Links.Next.Href, "?"+test.next)) {
+				t.Errorf("expected a link to the next page with %s, got %+v", test.next, listed.Links.Next)
+			}
+		})
+	}
+
+	listed := listPage{}
+	expect(t, serve(t, simulator, "GET", discovery(services.VIRTUAL_MACHINES), token, nil), http.StatusOK, &listed)
+	if listed.Page != (page{Size: 2, TotalElements: 5, TotalPages: 3, Number: 0}) {
+		t.Errorf("unexpected page metadata %+v", listed.Page)
+	}
+}
+
+func TestCancelTask(t *testing.T) {
+	simulator := newSimulator(Options{TaskDuration: taskDuration})
+	token, _ := login(t, simulator)
+	registered := register(t, simulator, token, "vc1")
+
+	submitted := taskSubmitted{}
+	expect(t, serve(t, simulator, "POST", discovery(services.VCENTERS, registered.VCenterUUID, services.VIRTUAL_MACHINES), token, nil), http.StatusAccepted, &submitted)
+	expect(t, serve(t, simulator, "POST", discovery(services.TASKS, submitted.TaskID, services.CANCEL), token, nil), http.StatusAccepted, nil)
+
+	// A cancelled task stays cancelled and leaves the inventory as it was.
+	time.Sleep(2 * taskDuration)
+	cancelled := task{}
+	expect(t, serve(t, simulator, "GET", discovery(services.TASKS, submitted.TaskID), token, nil), http.StatusOK, &cancelled)
+	if cancelled.Status != "CANCELLED" {
+		t.Errorf("expected the task to be cancelled, got %s", cancelled.Status)
+	}
+	if len(simulator.virtualMachines) != 0 {
+		t.Errorf("expected the cancelled scan to find no virtual machine, got %d", len(simulator.virtualMachines))
+	}
+
+	expect(t, serve(t, simulator, "POST", discovery(services.TASKS, submitted.TaskID, services.CANCEL), token, nil), http.StatusConflict, nil)
+	expect(t, serve(t, simulator, "POST", discovery(services.TASKS, "unknown", services.CANCEL), token, nil), http.StatusNotFound, nil)
+}